@@ -17,6 +17,7 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -25,14 +26,24 @@ import (
 	"time"
 
 	"github.com/kubeovn/ces-controller/pkg/as3"
+	"github.com/kubeovn/ces-controller/pkg/dns"
 	clientset "github.com/kubeovn/ces-controller/pkg/generated/clientset/versioned"
 	informers "github.com/kubeovn/ces-controller/pkg/generated/informers/externalversions"
+	"github.com/kubeovn/ces-controller/pkg/health"
+	"github.com/kubeovn/ces-controller/pkg/metrics"
 	"github.com/kubeovn/ces-controller/pkg/signals"
+	"github.com/kubeovn/ces-controller/pkg/webhook"
 
 	"github.com/kubeovn/ces-controller/pkg/controller"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
 	kubeinformers "k8s.io/client-go/informers"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1beta1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 	"k8s.io/klog/v2"
 )
 
@@ -47,6 +58,28 @@ var (
 	bigipCredsDir string
 	bigipConfDir  string
 
+	resolvConf string
+
+	webhookAddr    string
+	webhookCertDir string
+
+	metricsAddr       string
+	healthAddr        string
+	workerStuckPeriod time.Duration
+	batchWindow       time.Duration
+	gcInterval        time.Duration
+	gcDryRun          bool
+	endpointSlices    bool
+	kubeOVNSubnets    bool
+	driftInterval     time.Duration
+	driftMode         string
+
+	leaderElect              bool
+	leaderElectLeaseName     string
+	leaderElectLeaseDuration time.Duration
+	leaderElectRenewDeadline time.Duration
+	leaderElectRetryPeriod   time.Duration
+
 	license    string
 	licenseKey string
 )
@@ -93,6 +126,9 @@ func main() {
 	if bigipUsername == "" || bigipPassword == "" {
 		klog.Fatalf("Missing Big-IP credentials info")
 	}
+	if driftMode != controller.DriftModeReport && driftMode != controller.DriftModeRepair {
+		klog.Fatalf("Invalid drift mode %q, it should be %s or %s", driftMode, controller.DriftModeReport, controller.DriftModeRepair)
+	}
 
 	// set up signals so we handle the first shutdown signal gracefully
 	stopCh := signals.SetupSignalHandler()
@@ -135,31 +171,146 @@ func main() {
 	if err != nil {
 		klog.Fatalf("Error building AS3 clientset: %s", err.Error())
 	}
+	dynamicClient, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		klog.Fatalf("Error building dynamic client: %s", err.Error())
+	}
+
+	resolver, err := dns.NewResolver(resolvConf)
+	if err != nil {
+		klog.Warningf("The external services resolved by the controller will fail to resolve: %s", err.Error())
+	}
 
 	kubeInformerFactory := kubeinformers.NewSharedInformerFactory(kubeClient, time.Second*30)
 	as3InformerFactory := informers.NewSharedInformerFactory(as3Client, time.Second*30)
+	dynamicInformerFactory := dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, time.Second*30)
 
+	//only the informer of the watched kind is started by the factory
 	endpointsInformer := kubeInformerFactory.Core().V1().Endpoints()
+	var endpointSliceInformer discoveryinformers.EndpointSliceInformer
+	if endpointSlices {
+		endpointSliceInformer = kubeInformerFactory.Discovery().V1beta1().EndpointSlices()
+	}
+	podInformer := kubeInformerFactory.Core().V1().Pods()
+	namespaceInformer := kubeInformerFactory.Core().V1().Namespaces()
 	externalServiceInformer := as3InformerFactory.Kubeovn().V1alpha1().ExternalServices()
 	clusterEgressRuleInformer := as3InformerFactory.Kubeovn().V1alpha1().ClusterEgressRules()
 	namespaceEgressRuleInformer := as3InformerFactory.Kubeovn().V1alpha1().NamespaceEgressRules()
 	serviceEgressRuleInformer := as3InformerFactory.Kubeovn().V1alpha1().ServiceEgressRules()
 	externalIPRuleInformer := as3InformerFactory.Bigip().V1alpha1().ExternalIPRules()
+	//the calico crds may not exist, the ip pools are watched if a tenant is configured with the calico source
+	var ipPoolInformer kubeinformers.GenericInformer
+	if as3.IsNamespaceSourceUsed(as3.NamespaceSourceCalico) {
+		ipPoolInformer = dynamicInformerFactory.ForResource(controller.IPPoolResource)
+	}
+	var subnetInformer kubeinformers.GenericInformer
+	if kubeOVNSubnets && as3.IsNamespaceSourceUsed(as3.NamespaceSourceKubeOVN) {
+		subnetInformer = dynamicInformerFactory.ForResource(controller.SubnetResource)
+	}
 
 	controller := controller.NewController(kubeClient, as3Client,
-		endpointsInformer, externalServiceInformer, clusterEgressRuleInformer,
+		endpointsInformer, endpointSliceInformer, podInformer, namespaceInformer, externalServiceInformer, clusterEgressRuleInformer,
 		namespaceEgressRuleInformer, serviceEgressRuleInformer,
-		externalIPRuleInformer,
-		bigIpClient)
+		externalIPRuleInformer, ipPoolInformer, subnetInformer,
+		bigIpClient, resolver, driftInterval, driftMode, workerStuckPeriod, batchWindow,
+		gcInterval, gcDryRun)
 
 	// notice that there is no need to run Start methods in a separate goroutine. (i.e. go kubeInformerFactory.Start(stopCh)
 	// Start method is non-blocking and runs all registered informers in a dedicated goroutine.
 	kubeInformerFactory.Start(stopCh)
 	as3InformerFactory.Start(stopCh)
-	go bigIpClient.Work()
-	if err = controller.Run(stopCh); err != nil {
-		klog.Fatalf("Error running controller: %s", err.Error())
+	dynamicInformerFactory.Start(stopCh)
+	if webhookAddr != "" {
+		server := webhook.NewServer(webhookAddr, webhookCertDir, externalServiceInformer)
+		go func() {
+			if err := server.Run(stopCh); err != nil {
+				klog.Fatalf("Error running webhook server: %s", err.Error())
+			}
+		}()
+	}
+	if metricsAddr != "" {
+		go func() {
+			if err := metrics.Serve(metricsAddr, stopCh); err != nil {
+				klog.Fatalf("Error running metrics server: %s", err.Error())
+			}
+		}()
 	}
+	if healthAddr != "" {
+		liveness := []health.Check{
+			{Name: "workers", Check: controller.CheckWorkers},
+		}
+		readiness := []health.Check{
+			{Name: "caches", Check: controller.CheckCachesSynced},
+			{Name: "as3", Check: bigIpClient.CheckAS3},
+			{Name: "license", Check: bigIpClient.CheckLicense},
+			{Name: "common-tenant", Check: bigIpClient.CheckDefaultTenant},
+			{Name: "startup-reconcile", Check: controller.CheckStartupReconciled},
+		}
+		go func() {
+			if err := health.Serve(healthAddr, liveness, readiness, stopCh); err != nil {
+				klog.Fatalf("Error running health server: %s", err.Error())
+			}
+		}()
+	}
+
+	// only the leader declares the tenants on BIG-IP, the standbys keep their informer caches warm
+	// to take over as the leader fails
+	run := func(ctx context.Context) {
+		if err := as3.InitDefaultTenant(bigIpClient); err != nil {
+			klog.Fatalf("failed to initialize AS3 declaration: %v", err)
+		}
+		if err := controller.Run(ctx.Done()); err != nil {
+			klog.Fatalf("Error running controller: %s", err.Error())
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	if !leaderElect {
+		run(ctx)
+		return
+	}
+
+	id, err := os.Hostname()
+	if err != nil {
+		klog.Fatalf("Error getting hostname: %s", err.Error())
+	}
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      leaderElectLeaseName,
+			Namespace: controllerNamespace,
+		},
+		Client: kubeClient.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
+	}
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   leaderElectLeaseDuration,
+		RenewDeadline:   leaderElectRenewDeadline,
+		RetryPeriod:     leaderElectRetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: run,
+			OnStoppedLeading: func() {
+				select {
+				case <-stopCh:
+					klog.Infof("%s released the lease %s/%s", id, controllerNamespace, leaderElectLeaseName)
+				default:
+					klog.Fatalf("%s lost the lease %s/%s", id, controllerNamespace, leaderElectLeaseName)
+				}
+			},
+			OnNewLeader: func(identity string) {
+				if identity != id {
+					klog.Infof("%s is the leader, waiting for the lease", identity)
+				}
+			},
+		},
+		Name: leaderElectLeaseName,
+	})
 }
 
 func init() {
@@ -174,4 +325,22 @@ func init() {
 	flag.StringVar(&licenseKey, "license-key", "", "license key to be used for ces license.")
 	flag.StringVar(&bigipCredsDir, "bigip-creds-dir", "", "Directory that contains the BIG-IP username and password. To be used instead of username and password.")
 	flag.StringVar(&bigipConfDir, "bigip-conf-dir", "", "Directory that ces-conf.yaml file.")
+	flag.StringVar(&resolvConf, "resolv-conf", dns.DefaultResolvConf, "Optional, resolv.conf whose nameservers resolve the FQDNs of external services with Controller dnsResolution.")
+	flag.StringVar(&webhookAddr, "webhook-addr", "", "Optional, address to serve the validating webhook on, eg: :8443. The webhook is disabled if it is empty.")
+	flag.StringVar(&webhookCertDir, "webhook-cert-dir", "/ces/webhook-certs", "Directory that contains the tls.crt and tls.key of the validating webhook.")
+	flag.StringVar(&metricsAddr, "metrics-addr", ":9090", "Optional, address to serve the prometheus metrics on. The metrics are not served if it is empty.")
+	flag.StringVar(&healthAddr, "health-addr", ":8081", "Optional, address to serve the liveness on /healthz and the readiness on /readyz. They are not served if it is empty.")
+	flag.DurationVar(&workerStuckPeriod, "worker-stuck-period", 10*time.Minute, "Optional, period that a worker making no progress on its non-empty queue fails the liveness. The workers are not checked if it is 0.")
+	flag.DurationVar(&batchWindow, "address-list-batch-window", 2*time.Second, "Optional, window to collect the address list updates of a tenant by the endpoints, they are applied in one transaction and saved once. Each update is applied immediately if it is 0.")
+	flag.BoolVar(&endpointSlices, "endpoint-slices", false, "Optional, track the source addresses of the services by the discovery.k8s.io/v1beta1 EndpointSlices instead of the Endpoints, which are truncated at 1000 addresses.")
+	flag.BoolVar(&kubeOVNSubnets, "kube-ovn-subnets", false, "Optional, provide the source addresses of the namespaces of the kube-ovn source by the kubeovn.io/v1 Subnets bound to them, without their excludeIps, instead of the ovn.kubernetes.io/cidr annotation.")
+	flag.DurationVar(&gcInterval, "gc-interval", time.Hour, "Optional, interval to collect the objects of this cluster on BIG-IP whose rules are gone. They are not collected if it is 0.")
+	flag.BoolVar(&gcDryRun, "gc-dry-run", true, "Optional, the orphaned objects are only reported by logs and metrics if true, or removed from BIG-IP.")
+	flag.DurationVar(&driftInterval, "drift-interval", 5*time.Minute, "Optional, interval to check the drift of the tenants on BIG-IP from the desired state. The drift is not checked if it is 0.")
+	flag.BoolVar(&leaderElect, "leader-elect", true, "Optional, elect a leader by Lease before declaring the tenants on BIG-IP, enable it to run multiple replicas.")
+	flag.StringVar(&leaderElectLeaseName, "leader-elect-lease-name", "ces-controller", "Optional, name of the Lease in the CES_NAMESPACE namespace to elect the leader by.")
+	flag.DurationVar(&leaderElectLeaseDuration, "leader-elect-lease-duration", 15*time.Second, "Optional, duration that the standbys wait to take over the Lease after the leader stops renewing it.")
+	flag.DurationVar(&leaderElectRenewDeadline, "leader-elect-renew-deadline", 10*time.Second, "Optional, duration that the leader retries renewing the Lease before giving up the leadership.")
+	flag.DurationVar(&leaderElectRetryPeriod, "leader-elect-retry-period", 2*time.Second, "Optional, duration that the replicas wait between attempts of acquiring or renewing the Lease.")
+	flag.StringVar(&driftMode, "drift-mode", controller.DriftModeReport, "Optional, report or repair, the drift of the tenants is reported by metrics and events, and declared again if repair.")
 }
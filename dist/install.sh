@@ -11,9 +11,22 @@ BIGIP_INSECURE=${BIGIP_INSECURE:-true} # ignore Big-IP TLS error
 
 CES_NAMESPACE=${CES_NAMESPACE:-kube-system} # namespace in which the controller will be deployed
 CES_DEPLOMENT_NAME=${CES_DEPLOMENT_NAME:-ces-controller}
+CES_WEBHOOK_SERVICE=ces-controller-webhook
 
 echo "[Step 1] Create Secret"
 kubectl -n $CES_NAMESPACE create secret generic --from-literal "license=$LICENSE" --from-literal "licensekey=$LICENSEKEY" --from-literal "username=$BIGIP_USERNAME" --from-literal "password=$BIGIP_PASSWORD" bigip-creds
+# self-signed certificate of the validating webhook
+WEBHOOK_CERT_DIR=$(mktemp -d)
+openssl req -x509 -newkey rsa:2048 -nodes -days 3650 -subj "/CN=ces-controller-webhook-ca" \
+  -keyout $WEBHOOK_CERT_DIR/ca.key -out $WEBHOOK_CERT_DIR/ca.crt
+openssl req -newkey rsa:2048 -nodes -subj "/CN=$CES_WEBHOOK_SERVICE.$CES_NAMESPACE.svc" \
+  -keyout $WEBHOOK_CERT_DIR/tls.key -out $WEBHOOK_CERT_DIR/tls.csr
+echo "subjectAltName=DNS:$CES_WEBHOOK_SERVICE.$CES_NAMESPACE.svc" > $WEBHOOK_CERT_DIR/ext.cnf
+openssl x509 -req -days 3650 -in $WEBHOOK_CERT_DIR/tls.csr -CA $WEBHOOK_CERT_DIR/ca.crt -CAkey $WEBHOOK_CERT_DIR/ca.key \
+  -CAcreateserial -extfile $WEBHOOK_CERT_DIR/ext.cnf -out $WEBHOOK_CERT_DIR/tls.crt
+kubectl -n $CES_NAMESPACE create secret tls --cert=$WEBHOOK_CERT_DIR/tls.crt --key=$WEBHOOK_CERT_DIR/tls.key ces-webhook-certs
+WEBHOOK_CA_BUNDLE=$(base64 < $WEBHOOK_CERT_DIR/ca.crt | tr -d '\n')
+rm -rf $WEBHOOK_CERT_DIR
 echo "-------------------------------"
 echo ""
 
@@ -41,20 +54,43 @@ spec:
         - name: Addresses
           type: string
           jsonPath: .spec.addresses
+        - name: FQDNs
+          type: string
+          jsonPath: .spec.fqdns
+        - name: Ready
+          type: string
+          jsonPath: .status.conditions[?(@.type=="Ready")].status
       schema:
         openAPIV3Schema:
           type: object
           properties:
             spec:
               type: object
-              required:
-                - addresses
+              anyOf:
+                - required:
+                    - addresses
+                - required:
+                    - fqdns
               properties:
                 addresses:
                   type: array
                   items:
                     type: string
-                    format: "ip"
+                    anyOf:
+                      - format: ipv4
+                      - format: ipv6
+                      - format: cidr
+                fqdns:
+                  type: array
+                  items:
+                    type: string
+                    pattern: '^(\*\.)?([a-zA-Z0-9]([-a-zA-Z0-9]*[a-zA-Z0-9])?\.)+[a-zA-Z]{2,}\.?$'
+                dnsResolution:
+                  type: string
+                  enum:
+                    - AFM
+                    - Controller
+                  default: AFM
                 ports:
                   type: array
                   items:
@@ -69,6 +105,56 @@ spec:
                         pattern: "^[0-9]+(-[0-9]+)?(,[0-9]+(-[0-9]+)?)*$"
                       bandwidth:
                         type: string
+            status:
+              type: object
+              properties:
+                resolvedAddresses:
+                  type: array
+                  items:
+                    type: string
+                lastResolveTime:
+                  type: string
+                  format: date-time
+                conditions:
+                  type: array
+                  items:
+                    type: object
+                    required:
+                      - type
+                      - status
+                    properties:
+                      type:
+                        type: string
+                      status:
+                        type: string
+                        enum:
+                          - "True"
+                          - "False"
+                          - Unknown
+                      observedGeneration:
+                        type: integer
+                        format: int64
+                      lastTransitionTime:
+                        type: string
+                        format: date-time
+                      reason:
+                        type: string
+                      message:
+                        type: string
+                observedGeneration:
+                  type: integer
+                  format: int64
+                lastSyncTime:
+                  type: string
+                  format: date-time
+                lastError:
+                  type: string
+                bigipObjects:
+                  type: array
+                  items:
+                    type: string
+      subresources:
+        status: {}
 ---
 apiVersion: apiextensions.k8s.io/v1
 kind: CustomResourceDefinition
@@ -95,6 +181,9 @@ spec:
         - name: Status
           type: string
           jsonPath: .status.phase
+        - name: Ready
+          type: string
+          jsonPath: .status.conditions[?(@.type=="Ready")].status
       schema:
         openAPIV3Schema:
           type: object
@@ -103,7 +192,11 @@ spec:
               type: object
               required:
                 - action
-                - externalServices
+              anyOf:
+                - required:
+                    - externalServices
+                - required:
+                    - externalServiceSelector
               properties:
                 action:
                   type: string
@@ -114,15 +207,133 @@ spec:
                     - reject
                 logging:
                   type: boolean
+                priority:
+                  type: integer
+                  minimum: 1
+                  default: 1000
+                expiresAt:
+                  type: string
+                  format: date-time
+                schedule:
+                  type: object
+                  properties:
+                    dateValidStart:
+                      type: string
+                      format: date-time
+                    dateValidEnd:
+                      type: string
+                      format: date-time
+                    dailyHourStart:
+                      type: string
+                      pattern: '^([01][0-9]|2[0-3]):[0-5][0-9]$'
+                    dailyHourEnd:
+                      type: string
+                      pattern: '^(([01][0-9]|2[0-3]):[0-5][0-9]|24:00)$'
+                    daysOfWeek:
+                      type: array
+                      items:
+                        type: string
+                        enum:
+                          - monday
+                          - tuesday
+                          - wednesday
+                          - thursday
+                          - friday
+                          - saturday
+                          - sunday
+                namespaceSelector:
+                  type: object
+                  properties:
+                    matchLabels:
+                      type: object
+                      additionalProperties:
+                        type: string
+                    matchExpressions:
+                      type: array
+                      items:
+                        type: object
+                        required:
+                          - key
+                          - operator
+                        properties:
+                          key:
+                            type: string
+                          operator:
+                            type: string
+                          values:
+                            type: array
+                            items:
+                              type: string
                 externalServices:
                   type: array
                   items:
                     type: string
+                externalServiceSelector:
+                  type: object
+                  properties:
+                    matchLabels:
+                      type: object
+                      additionalProperties:
+                        type: string
+                    matchExpressions:
+                      type: array
+                      items:
+                        type: object
+                        required:
+                          - key
+                          - operator
+                        properties:
+                          key:
+                            type: string
+                          operator:
+                            type: string
+                          values:
+                            type: array
+                            items:
+                              type: string
             status:
+              type: object
               properties:
                 phase:
                   type: string
-              type: object
+                conditions:
+                  type: array
+                  items:
+                    type: object
+                    required:
+                      - type
+                      - status
+                    properties:
+                      type:
+                        type: string
+                      status:
+                        type: string
+                        enum:
+                          - "True"
+                          - "False"
+                          - Unknown
+                      observedGeneration:
+                        type: integer
+                        format: int64
+                      lastTransitionTime:
+                        type: string
+                        format: date-time
+                      reason:
+                        type: string
+                      message:
+                        type: string
+                observedGeneration:
+                  type: integer
+                  format: int64
+                lastSyncTime:
+                  type: string
+                  format: date-time
+                lastError:
+                  type: string
+                bigipObjects:
+                  type: array
+                  items:
+                    type: string
       subresources:
         status: {}
 ---
@@ -151,6 +362,9 @@ spec:
         - name: Status
           type: string
           jsonPath: .status.phase
+        - name: Ready
+          type: string
+          jsonPath: .status.conditions[?(@.type=="Ready")].status
       schema:
         openAPIV3Schema:
           type: object
@@ -159,7 +373,11 @@ spec:
               type: object
               required:
                 - action
-                - externalServices
+              anyOf:
+                - required:
+                    - externalServices
+                - required:
+                    - externalServiceSelector
               properties:
                 action:
                   type: string
@@ -170,15 +388,110 @@ spec:
                     - reject
                 logging:
                   type: boolean
+                priority:
+                  type: integer
+                  minimum: 1
+                  default: 1000
+                expiresAt:
+                  type: string
+                  format: date-time
+                schedule:
+                  type: object
+                  properties:
+                    dateValidStart:
+                      type: string
+                      format: date-time
+                    dateValidEnd:
+                      type: string
+                      format: date-time
+                    dailyHourStart:
+                      type: string
+                      pattern: '^([01][0-9]|2[0-3]):[0-5][0-9]$'
+                    dailyHourEnd:
+                      type: string
+                      pattern: '^(([01][0-9]|2[0-3]):[0-5][0-9]|24:00)$'
+                    daysOfWeek:
+                      type: array
+                      items:
+                        type: string
+                        enum:
+                          - monday
+                          - tuesday
+                          - wednesday
+                          - thursday
+                          - friday
+                          - saturday
+                          - sunday
                 externalServices:
                   type: array
                   items:
                     type: string
+                externalServiceSelector:
+                  type: object
+                  properties:
+                    matchLabels:
+                      type: object
+                      additionalProperties:
+                        type: string
+                    matchExpressions:
+                      type: array
+                      items:
+                        type: object
+                        required:
+                          - key
+                          - operator
+                        properties:
+                          key:
+                            type: string
+                          operator:
+                            type: string
+                          values:
+                            type: array
+                            items:
+                              type: string
             status:
+              type: object
               properties:
                 phase:
                   type: string
-              type: object
+                conditions:
+                  type: array
+                  items:
+                    type: object
+                    required:
+                      - type
+                      - status
+                    properties:
+                      type:
+                        type: string
+                      status:
+                        type: string
+                        enum:
+                          - "True"
+                          - "False"
+                          - Unknown
+                      observedGeneration:
+                        type: integer
+                        format: int64
+                      lastTransitionTime:
+                        type: string
+                        format: date-time
+                      reason:
+                        type: string
+                      message:
+                        type: string
+                observedGeneration:
+                  type: integer
+                  format: int64
+                lastSyncTime:
+                  type: string
+                  format: date-time
+                lastError:
+                  type: string
+                bigipObjects:
+                  type: array
+                  items:
+                    type: string
       subresources:
         status: {}
 ---
@@ -207,6 +520,9 @@ spec:
         - name: Status
           type: string
           jsonPath: .status.phase
+        - name: Ready
+          type: string
+          jsonPath: .status.conditions[?(@.type=="Ready")].status
       schema:
         openAPIV3Schema:
           type: object
@@ -215,8 +531,16 @@ spec:
               type: object
               required:
                 - action
-                - externalServices
-                - service
+              anyOf:
+                - required:
+                    - externalServices
+                - required:
+                    - externalServiceSelector
+              oneOf:
+                - required:
+                    - service
+                - required:
+                    - podSelector
               properties:
                 action:
                   type: string
@@ -227,17 +551,135 @@ spec:
                     - reject
                 logging:
                   type: boolean
+                priority:
+                  type: integer
+                  minimum: 1
+                  default: 1000
+                expiresAt:
+                  type: string
+                  format: date-time
+                schedule:
+                  type: object
+                  properties:
+                    dateValidStart:
+                      type: string
+                      format: date-time
+                    dateValidEnd:
+                      type: string
+                      format: date-time
+                    dailyHourStart:
+                      type: string
+                      pattern: '^([01][0-9]|2[0-3]):[0-5][0-9]$'
+                    dailyHourEnd:
+                      type: string
+                      pattern: '^(([01][0-9]|2[0-3]):[0-5][0-9]|24:00)$'
+                    daysOfWeek:
+                      type: array
+                      items:
+                        type: string
+                        enum:
+                          - monday
+                          - tuesday
+                          - wednesday
+                          - thursday
+                          - friday
+                          - saturday
+                          - sunday
                 service:
                   type: string
+                podSelector:
+                  type: object
+                  properties:
+                    matchLabels:
+                      type: object
+                      additionalProperties:
+                        type: string
+                    matchExpressions:
+                      type: array
+                      items:
+                        type: object
+                        required:
+                          - key
+                          - operator
+                        properties:
+                          key:
+                            type: string
+                          operator:
+                            type: string
+                          values:
+                            type: array
+                            items:
+                              type: string
                 externalServices:
                   type: array
                   items:
                     type: string
+                externalServiceSelector:
+                  type: object
+                  properties:
+                    matchLabels:
+                      type: object
+                      additionalProperties:
+                        type: string
+                    matchExpressions:
+                      type: array
+                      items:
+                        type: object
+                        required:
+                          - key
+                          - operator
+                        properties:
+                          key:
+                            type: string
+                          operator:
+                            type: string
+                          values:
+                            type: array
+                            items:
+                              type: string
             status:
+              type: object
               properties:
                 phase:
                   type: string
-              type: object
+                conditions:
+                  type: array
+                  items:
+                    type: object
+                    required:
+                      - type
+                      - status
+                    properties:
+                      type:
+                        type: string
+                      status:
+                        type: string
+                        enum:
+                          - "True"
+                          - "False"
+                          - Unknown
+                      observedGeneration:
+                        type: integer
+                        format: int64
+                      lastTransitionTime:
+                        type: string
+                        format: date-time
+                      reason:
+                        type: string
+                      message:
+                        type: string
+                observedGeneration:
+                  type: integer
+                  format: int64
+                lastSyncTime:
+                  type: string
+                  format: date-time
+                lastError:
+                  type: string
+                bigipObjects:
+                  type: array
+                  items:
+                    type: string
       subresources:
         status: {}
 ---
@@ -266,6 +708,9 @@ spec:
         - name: Services
           type: string
           jsonPath: .spec.services
+        - name: Ready
+          type: string
+          jsonPath: .status.conditions[?(@.type=="Ready")].status
       schema:
         openAPIV3Schema:
           type: object
@@ -308,6 +753,49 @@ spec:
                   items:
                     type: string
                   minItems: 1
+            status:
+              type: object
+              properties:
+                conditions:
+                  type: array
+                  items:
+                    type: object
+                    required:
+                      - type
+                      - status
+                    properties:
+                      type:
+                        type: string
+                      status:
+                        type: string
+                        enum:
+                          - "True"
+                          - "False"
+                          - Unknown
+                      observedGeneration:
+                        type: integer
+                        format: int64
+                      lastTransitionTime:
+                        type: string
+                        format: date-time
+                      reason:
+                        type: string
+                      message:
+                        type: string
+                observedGeneration:
+                  type: integer
+                  format: int64
+                lastSyncTime:
+                  type: string
+                  format: date-time
+                lastError:
+                  type: string
+                bigipObjects:
+                  type: array
+                  items:
+                    type: string
+      subresources:
+        status: {}
 EOF
 echo "-------------------------------"
 echo ""
@@ -333,6 +821,38 @@ rules:
       - get
       - watch
       - list
+  - apiGroups:
+      - discovery.k8s.io
+    resources:
+      - endpointslices
+    verbs:
+      - get
+      - watch
+      - list
+  - apiGroups:
+      - kubeovn.io
+    resources:
+      - subnets
+    verbs:
+      - get
+      - watch
+      - list
+  - apiGroups:
+      - crd.projectcalico.org
+    resources:
+      - ippools
+    verbs:
+      - get
+      - watch
+      - list
+  - apiGroups:
+      - ""
+    resources:
+      - pods
+    verbs:
+      - get
+      - watch
+      - list
   - apiGroups:
       - ""
     resources:
@@ -373,6 +893,7 @@ rules:
       - clusteregressrules/status
       - namespaceegressrules/status
       - serviceegressrules/status
+      - externalservices/status
     verbs:
       - get
       - watch
@@ -383,12 +904,21 @@ rules:
       - bigip.io
     resources:
       - externaliprules
+      - externaliprules/status
     verbs:
       - get
       - watch
       - list
       - update
       - patch
+  - apiGroups:
+      - coordination.k8s.io
+    resources:
+      - leases
+    verbs:
+      - get
+      - create
+      - update
 ---
 apiVersion: rbac.authorization.k8s.io/v1
 kind: ClusterRoleBinding
@@ -417,6 +947,7 @@ data:
   ces-conf.yaml: |-
     clusterName: k8s
     isSupportRouteDomain: false
+    isSupportIPv6: false
     ##AS3 basic configuration
     ##Multi-cluster docking single BIG-IP, controller Common init and remote log
     masterCluster: k8s
@@ -505,6 +1036,7 @@ data:
         virtualService:
           template: ''
           virtualAddress: "0.0.0.0"
+          virtualAddressV6: "::"
           icmpEcho: "disable"
           arpEnabled: false
           template: ''
@@ -523,7 +1055,7 @@ metadata:
   name: $CES_DEPLOMENT_NAME
   namespace: $CES_NAMESPACE
 spec:
-  replicas: 1
+  replicas: 2
   selector:
     matchLabels:
       app: ces-controller
@@ -553,10 +1085,48 @@ spec:
             - --bigip-insecure=$BIGIP_INSECURE
             - --bigip-creds-dir=/ces/bigip-creds
             - --bigip-conf-dir=/ces
+            - --webhook-addr=:8443
+            - --webhook-cert-dir=/ces/webhook-certs
+            - --metrics-addr=:9090
+            - --health-addr=:8081
+            - --worker-stuck-period=10m
+            - --address-list-batch-window=2s
+            - --gc-interval=1h
+            - --gc-dry-run=true
+            - --endpoint-slices=true
+            - --kube-ovn-subnets=true
+            - --drift-interval=5m
+            - --drift-mode=report
+            - --leader-elect=true
+            - --leader-elect-lease-duration=15s
+            - --leader-elect-renew-deadline=10s
+          ports:
+            - name: webhook
+              containerPort: 8443
+            - name: metrics
+              containerPort: 9090
+            - name: health
+              containerPort: 8081
+          livenessProbe:
+            httpGet:
+              path: /healthz
+              port: health
+            initialDelaySeconds: 30
+            periodSeconds: 30
+            failureThreshold: 3
+          readinessProbe:
+            httpGet:
+              path: /readyz
+              port: health
+            periodSeconds: 10
+            timeoutSeconds: 5
           volumeMounts:
             - name: bigip-creds
               mountPath: "/ces/bigip-creds"
               readOnly: true
+            - name: webhook-certs
+              mountPath: "/ces/webhook-certs"
+              readOnly: true
             - name: bigip-config
               mountPath: /ces
               readOnly: true
@@ -564,12 +1134,28 @@ spec:
         - name: bigip-creds
           secret:
             secretName: bigip-creds
+        - name: webhook-certs
+          secret:
+            secretName: ces-webhook-certs
         - name: bigip-config
           configMap:
             name: ces-controller-configmap
       dnsPolicy: ClusterFirst
       restartPolicy: Always
       terminationGracePeriodSeconds: 30
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: $CES_WEBHOOK_SERVICE
+  namespace: $CES_NAMESPACE
+spec:
+  selector:
+    app: ces-controller
+  ports:
+    - name: webhook
+      port: 443
+      targetPort: webhook
 EOF
 echo "-------------------------------"
 echo ""
@@ -577,3 +1163,48 @@ echo ""
 echo "[Step 5] Wait CES Controller to Be Ready"
 sleep 1s
 kubectl -n $CES_NAMESPACE wait pod --for=condition=Ready -l app=ces-controller
+echo "-------------------------------"
+echo ""
+
+echo "[Step 6] Apply Validating Webhook"
+cat << EOF | kubectl apply -f -
+apiVersion: admissionregistration.k8s.io/v1
+kind: ValidatingWebhookConfiguration
+metadata:
+  name: ces-controller
+webhooks:
+  - name: validate.ces.kubeovn.io
+    admissionReviewVersions:
+      - v1
+    sideEffects: None
+    failurePolicy: Ignore
+    timeoutSeconds: 10
+    clientConfig:
+      service:
+        name: $CES_WEBHOOK_SERVICE
+        namespace: $CES_NAMESPACE
+        path: /validate
+      caBundle: $WEBHOOK_CA_BUNDLE
+    rules:
+      - apiGroups:
+          - kubeovn.io
+        apiVersions:
+          - v1alpha1
+        operations:
+          - CREATE
+          - UPDATE
+        resources:
+          - externalservices
+          - clusteregressrules
+          - namespaceegressrules
+          - serviceegressrules
+      - apiGroups:
+          - bigip.io
+        apiVersions:
+          - v1alpha1
+        operations:
+          - CREATE
+          - UPDATE
+        resources:
+          - externaliprules
+EOF
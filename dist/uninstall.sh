@@ -5,7 +5,9 @@ CES_NAMESPACE=${CES_NAMESPACE:-kube-system} # namespace in which the controller
 CES_DEPLOMENT_NAME=${CES_DEPLOMENT_NAME:-ces-controller}
 
 echo "[Step 1] Delete CES Controller"
+kubectl delete --ignore-not-found validatingwebhookconfiguration ces-controller
 kubectl -n $CES_NAMESPACE delete --ignore-not-found deployment $CES_DEPLOMENT_NAME
+kubectl -n $CES_NAMESPACE delete --ignore-not-found service ces-controller-webhook
 echo "-------------------------------"
 echo ""
 
@@ -27,6 +29,7 @@ echo ""
 
 echo "[Step 4] Delete Secret"
 kubectl -n $CES_NAMESPACE delete --ignore-not-found secret bigip-creds
+kubectl -n $CES_NAMESPACE delete --ignore-not-found secret ces-webhook-certs
 echo "-------------------------------"
 echo ""
 
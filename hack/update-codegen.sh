@@ -31,6 +31,13 @@ bash "${CODEGEN_PKG}"/generate-groups.sh all \
   --output-base "$(dirname "${BASH_SOURCE[0]}")/../../../.." \
   --go-header-file "${SCRIPT_ROOT}"/hack/boilerplate.go.txt
 
+# the types shared by the API groups are in a package of no group, generate-groups.sh installed deepcopy-gen
+GOBIN="$(go env GOBIN)"
+"${GOBIN:-$(go env GOPATH)/bin}"/deepcopy-gen --input-dirs github.com/kubeovn/ces-controller/pkg/apis/common \
+  -O zz_generated.deepcopy --bounding-dirs github.com/kubeovn/ces-controller/pkg/apis \
+  --output-base "$(dirname "${BASH_SOURCE[0]}")/../../../.." \
+  --go-header-file "${SCRIPT_ROOT}"/hack/boilerplate.go.txt
+
 bash "${CODEGEN_PKG}"/generate-internal-groups.sh defaulter \
   github.com/kubeovn/ces-controller/pkg/generated github.com/kubeovn/ces-controller/pkg/apis github.com/kubeovn/ces-controller/pkg/apis \
   bigip.io:v1alpha1 \
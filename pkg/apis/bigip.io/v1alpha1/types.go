@@ -1,6 +1,10 @@
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
+)
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -10,7 +14,8 @@ type ExternalIPRule struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
 
-	Spec ExternalIPRuleSpec `json:"spec"`
+	Spec   ExternalIPRuleSpec   `json:"spec"`
+	Status ExternalIPRuleStatus `json:"status,omitempty"`
 }
 
 // DestinationMatch is a specification for an ExternalIPRule match
@@ -33,6 +38,11 @@ type ExternalIPRuleSpec struct {
 	Services          []string         `json:"services"`
 }
 
+// ExternalIPRuleStatus is the status for a ExternalIPRule resource
+type ExternalIPRuleStatus struct {
+	common.SyncStatus `json:",inline"`
+}
+
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
 
 // ExternalIPRuleList is a list of ExternalIPRule resources
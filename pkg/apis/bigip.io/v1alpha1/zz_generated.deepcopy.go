@@ -74,6 +74,7 @@ func (in *ExternalIPRule) DeepCopyInto(out *ExternalIPRule) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -154,3 +155,20 @@ func (in *ExternalIPRuleSpec) DeepCopy() *ExternalIPRuleSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalIPRuleStatus) DeepCopyInto(out *ExternalIPRuleStatus) {
+	*out = *in
+	in.SyncStatus.DeepCopyInto(&out.SyncStatus)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalIPRuleStatus.
+func (in *ExternalIPRuleStatus) DeepCopy() *ExternalIPRuleStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalIPRuleStatus)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,29 @@
+package common
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// Condition types of SyncStatus
+const (
+	// ConditionReady is True when the resource is in effect on BIG-IP
+	ConditionReady = "Ready"
+	// ConditionSynced is True when the last sync to BIG-IP succeeded
+	ConditionSynced = "Synced"
+	// ConditionDegraded is True when the resource is synced but partially in effect, eg: a referenced
+	// external service does not exist
+	ConditionDegraded = "Degraded"
+)
+
+// SyncStatus is how a CES resource is synced to BIG-IP
+type SyncStatus struct {
+	// Conditions are Ready, Synced and Degraded
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+	// ObservedGeneration is the generation of the resource last synced
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// LastSyncTime is the last time the resource is synced successfully
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+	// LastError is the error of the last failed sync, cleared by a successful one
+	LastError string `json:"lastError,omitempty"`
+	// BigIPObjects is the paths of the BIG-IP objects declared for the resource,
+	// eg: /Common/Shared/k8s_global_rule1_ext_exsvc1_rule_list
+	BigIPObjects []string `json:"bigipObjects,omitempty"`
+}
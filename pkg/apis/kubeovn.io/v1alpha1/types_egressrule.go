@@ -0,0 +1,15 @@
+package v1alpha1
+
+import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+// EgressRuleSchedule restricts an egress rule to a time window
+type EgressRuleSchedule struct {
+	// DateValidStart and DateValidEnd bound the dates the rule is active in
+	DateValidStart *metav1.Time `json:"dateValidStart,omitempty"`
+	DateValidEnd   *metav1.Time `json:"dateValidEnd,omitempty"`
+	// DailyHourStart and DailyHourEnd bound the hours of a day the rule is active in, eg: 01:00
+	DailyHourStart string `json:"dailyHourStart,omitempty"`
+	DailyHourEnd   string `json:"dailyHourEnd,omitempty"`
+	// DaysOfWeek is the days the rule is active in, eg: monday
+	DaysOfWeek []string `json:"daysOfWeek,omitempty"`
+}
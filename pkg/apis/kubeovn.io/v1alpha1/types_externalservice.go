@@ -1,6 +1,10 @@
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
+)
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -10,7 +14,8 @@ type ExternalService struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
 
-	Spec ExternalServiceSpec `json:"spec"`
+	Spec   ExternalServiceSpec   `json:"spec"`
+	Status ExternalServiceStatus `json:"status,omitempty"`
 }
 
 // ExternalService is a specification for an ExternalService port
@@ -23,8 +28,32 @@ type ExternalServicePort struct {
 
 // ExternalServiceSpec is the spec for a ExternalService resource
 type ExternalServiceSpec struct {
-	Addresses []string              `json:"addresses"`
-	Ports     []ExternalServicePort `json:"ports,omitempty"`
+	Addresses []string `json:"addresses,omitempty"`
+	// FQDNs is the domain names of the service, a wildcard such as *.example.com is always
+	// resolved by AFM
+	FQDNs []string `json:"fqdns,omitempty"`
+	// DNSResolution is where FQDNs are resolved, AFM or Controller, defaults to AFM
+	DNSResolution DNSResolution         `json:"dnsResolution,omitempty"`
+	Ports         []ExternalServicePort `json:"ports,omitempty"`
+}
+
+type DNSResolution string
+
+const (
+	// DNSResolutionAFM delegates FQDNs to AFM fqdn address lists
+	DNSResolutionAFM DNSResolution = "AFM"
+	// DNSResolutionController resolves FQDNs in the controller, the resolved addresses
+	// are refreshed as their TTLs expire
+	DNSResolutionController DNSResolution = "Controller"
+)
+
+type ExternalServiceStatus struct {
+	// ResolvedAddresses is the addresses of FQDNs resolved by the controller
+	ResolvedAddresses []string `json:"resolvedAddresses,omitempty"`
+	// LastResolveTime is the last time FQDNs are resolved by the controller, it is refreshed every
+	// 10 minutes at most while the resolved addresses are unchanged
+	LastResolveTime   *metav1.Time `json:"lastResolveTime,omitempty"`
+	common.SyncStatus `json:",inline"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -1,6 +1,10 @@
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
+)
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -18,12 +22,25 @@ type NamespaceEgressRule struct {
 type NamespaceEgressRuleSpec struct {
 	Action string `json:"action"`
 	//Subnet           string   `json:"subnet"`
-	Logging          bool     `json:"logging,omitempty"`
-	ExternalServices []string `json:"externalServices"`
+	Logging bool `json:"logging,omitempty"`
+	// Priority orders the rule in its firewall policy, a lower value is evaluated first.
+	// Defaults to 1000.
+	Priority uint32 `json:"priority,omitempty"`
+	// Schedule restricts the rule to a time window, the rule is always active if it is not set
+	Schedule *EgressRuleSchedule `json:"schedule,omitempty"`
+	// ExpiresAt makes the rule a temporary grant, the rule is removed from BIG-IP at that time
+	// and its phase becomes Expired, the rule resource itself is kept.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// ExternalServices references the external services by name
+	ExternalServices []string `json:"externalServices,omitempty"`
+	// ExternalServiceSelector references the external services by label in addition to ExternalServices,
+	// at least one of them is set.
+	ExternalServiceSelector *metav1.LabelSelector `json:"externalServiceSelector,omitempty"`
 }
 
 type NamespaceEgressRuleStatus struct {
-	Phase NamespaceEgressRulePhase `json:"phase,omitempty"`
+	Phase             NamespaceEgressRulePhase `json:"phase,omitempty"`
+	common.SyncStatus `json:",inline"`
 }
 
 type NamespaceEgressRulePhase string
@@ -31,6 +48,7 @@ type NamespaceEgressRulePhase string
 const (
 	NamespaceEgressRuleSuccess NamespaceEgressRulePhase = "Success"
 	NamespaceEgressRuleSyncing NamespaceEgressRulePhase = "Syncing"
+	NamespaceEgressRuleExpired NamespaceEgressRulePhase = "Expired"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -16,7 +16,11 @@ limitations under the License.
 
 package v1alpha1
 
-import metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
+)
 
 // +genclient
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -33,14 +37,31 @@ type ServiceEgressRule struct {
 
 // ServiceEgressRuleSpec is the spec for an F5TrafficControlRule resource
 type ServiceEgressRuleSpec struct {
-	Action           string   `json:"action"`
-	Logging          bool     `json:"logging,omitempty"`
-	Service          string   `json:"service"`
-	ExternalServices []string `json:"externalServices"`
+	Action  string `json:"action"`
+	Logging bool   `json:"logging,omitempty"`
+	// Priority orders the rule in its firewall policy, a lower value is evaluated first.
+	// Defaults to 1000.
+	Priority uint32 `json:"priority,omitempty"`
+	// Schedule restricts the rule to a time window, the rule is always active if it is not set
+	Schedule *EgressRuleSchedule `json:"schedule,omitempty"`
+	// ExpiresAt makes the rule a temporary grant, the rule is removed from BIG-IP at that time
+	// and its phase becomes Expired, the rule resource itself is kept.
+	ExpiresAt *metav1.Time `json:"expiresAt,omitempty"`
+	// Service selects the source pods through the Endpoints of the named Service.
+	Service string `json:"service,omitempty"`
+	// PodSelector selects the source pods by label in the rule namespace,
+	// used for workloads without a Service. Exactly one of Service and PodSelector is set.
+	PodSelector *metav1.LabelSelector `json:"podSelector,omitempty"`
+	// ExternalServices references the external services by name
+	ExternalServices []string `json:"externalServices,omitempty"`
+	// ExternalServiceSelector references the external services by label in addition to ExternalServices,
+	// at least one of them is set.
+	ExternalServiceSelector *metav1.LabelSelector `json:"externalServiceSelector,omitempty"`
 }
 
 type ServiceEgressRuleStatus struct {
-	Phase ServiceEgressRulePhase `json:"phase,omitempty"`
+	Phase             ServiceEgressRulePhase `json:"phase,omitempty"`
+	common.SyncStatus `json:",inline"`
 }
 
 type ServiceEgressRulePhase string
@@ -48,6 +69,7 @@ type ServiceEgressRulePhase string
 const (
 	ServiceEgressRuleSuccess ServiceEgressRulePhase = "Success"
 	ServiceEgressRuleSyncing ServiceEgressRulePhase = "Syncing"
+	ServiceEgressRuleExpired ServiceEgressRulePhase = "Expired"
 )
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -22,6 +22,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -31,7 +32,7 @@ func (in *ClusterEgressRule) DeepCopyInto(out *ClusterEgressRule) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -89,11 +90,30 @@ func (in *ClusterEgressRuleList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterEgressRuleSpec) DeepCopyInto(out *ClusterEgressRuleSpec) {
 	*out = *in
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(EgressRuleSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ExternalServices != nil {
 		in, out := &in.ExternalServices, &out.ExternalServices
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExternalServiceSelector != nil {
+		in, out := &in.ExternalServiceSelector, &out.ExternalServiceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -110,6 +130,7 @@ func (in *ClusterEgressRuleSpec) DeepCopy() *ClusterEgressRuleSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterEgressRuleStatus) DeepCopyInto(out *ClusterEgressRuleStatus) {
 	*out = *in
+	in.SyncStatus.DeepCopyInto(&out.SyncStatus)
 	return
 }
 
@@ -123,12 +144,42 @@ func (in *ClusterEgressRuleStatus) DeepCopy() *ClusterEgressRuleStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EgressRuleSchedule) DeepCopyInto(out *EgressRuleSchedule) {
+	*out = *in
+	if in.DateValidStart != nil {
+		in, out := &in.DateValidStart, &out.DateValidStart
+		*out = (*in).DeepCopy()
+	}
+	if in.DateValidEnd != nil {
+		in, out := &in.DateValidEnd, &out.DateValidEnd
+		*out = (*in).DeepCopy()
+	}
+	if in.DaysOfWeek != nil {
+		in, out := &in.DaysOfWeek, &out.DaysOfWeek
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EgressRuleSchedule.
+func (in *EgressRuleSchedule) DeepCopy() *EgressRuleSchedule {
+	if in == nil {
+		return nil
+	}
+	out := new(EgressRuleSchedule)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ExternalService) DeepCopyInto(out *ExternalService) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -207,6 +258,11 @@ func (in *ExternalServiceSpec) DeepCopyInto(out *ExternalServiceSpec) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.FQDNs != nil {
+		in, out := &in.FQDNs, &out.FQDNs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Ports != nil {
 		in, out := &in.Ports, &out.Ports
 		*out = make([]ExternalServicePort, len(*in))
@@ -225,13 +281,39 @@ func (in *ExternalServiceSpec) DeepCopy() *ExternalServiceSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExternalServiceStatus) DeepCopyInto(out *ExternalServiceStatus) {
+	*out = *in
+	if in.ResolvedAddresses != nil {
+		in, out := &in.ResolvedAddresses, &out.ResolvedAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastResolveTime != nil {
+		in, out := &in.LastResolveTime, &out.LastResolveTime
+		*out = (*in).DeepCopy()
+	}
+	in.SyncStatus.DeepCopyInto(&out.SyncStatus)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExternalServiceStatus.
+func (in *ExternalServiceStatus) DeepCopy() *ExternalServiceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExternalServiceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespaceEgressRule) DeepCopyInto(out *NamespaceEgressRule) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -289,11 +371,25 @@ func (in *NamespaceEgressRuleList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespaceEgressRuleSpec) DeepCopyInto(out *NamespaceEgressRuleSpec) {
 	*out = *in
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(EgressRuleSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
 	if in.ExternalServices != nil {
 		in, out := &in.ExternalServices, &out.ExternalServices
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExternalServiceSelector != nil {
+		in, out := &in.ExternalServiceSelector, &out.ExternalServiceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -310,6 +406,7 @@ func (in *NamespaceEgressRuleSpec) DeepCopy() *NamespaceEgressRuleSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NamespaceEgressRuleStatus) DeepCopyInto(out *NamespaceEgressRuleStatus) {
 	*out = *in
+	in.SyncStatus.DeepCopyInto(&out.SyncStatus)
 	return
 }
 
@@ -329,7 +426,7 @@ func (in *ServiceEgressRule) DeepCopyInto(out *ServiceEgressRule) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -387,11 +484,30 @@ func (in *ServiceEgressRuleList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceEgressRuleSpec) DeepCopyInto(out *ServiceEgressRuleSpec) {
 	*out = *in
+	if in.Schedule != nil {
+		in, out := &in.Schedule, &out.Schedule
+		*out = new(EgressRuleSchedule)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ExpiresAt != nil {
+		in, out := &in.ExpiresAt, &out.ExpiresAt
+		*out = (*in).DeepCopy()
+	}
+	if in.PodSelector != nil {
+		in, out := &in.PodSelector, &out.PodSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.ExternalServices != nil {
 		in, out := &in.ExternalServices, &out.ExternalServices
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.ExternalServiceSelector != nil {
+		in, out := &in.ExternalServiceSelector, &out.ExternalServiceSelector
+		*out = new(v1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -408,6 +524,7 @@ func (in *ServiceEgressRuleSpec) DeepCopy() *ServiceEgressRuleSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ServiceEgressRuleStatus) DeepCopyInto(out *ServiceEgressRuleStatus) {
 	*out = *in
+	in.SyncStatus.DeepCopyInto(&out.SyncStatus)
 	return
 }
 
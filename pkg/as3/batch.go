@@ -0,0 +1,129 @@
+package as3
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubeovn/ces-controller/pkg/metrics"
+)
+
+// AddressListBatcher collects the updates of the source address lists by the endpoints of each tenant over
+// a window, and applies the latest update of each address list in one transaction with a single save
+type AddressListBatcher struct {
+	client *Client
+	window time.Duration
+	//onFailed is called with the partition of the tenant whose updates failed to apply
+	onFailed func(partition string, err error)
+
+	lock sync.Mutex
+	//pending are the latest address lists of each tenant by url
+	pending map[string]map[string]BigIpAddressList
+}
+
+// NewAddressListBatcher returns an AddressListBatcher, the updates are applied immediately if window is 0
+func NewAddressListBatcher(client *Client, window time.Duration, onFailed func(partition string, err error)) *AddressListBatcher {
+	return &AddressListBatcher{
+		client:   client,
+		window:   window,
+		onFailed: onFailed,
+		pending:  map[string]map[string]BigIpAddressList{},
+	}
+}
+
+// UpdateBigIPSourceAddress updates the source address list of the endpoints of the service egress rule
+func (b *AddressListBatcher) UpdateBigIPSourceAddress(addrList BigIpAddressList, tntcfg *TenantConfig, namespace, ruleName, svcName string) error {
+	return b.update(addrList, tntcfg, getAs3SrcAddressAttr("svc", namespace, ruleName, svcName))
+}
+
+// UpdateBigIPSnatSourceAddress updates the source address list of the endpoints of the external ip rule
+func (b *AddressListBatcher) UpdateBigIPSnatSourceAddress(addrList BigIpAddressList, tntcfg *TenantConfig, namespace, ruleName, svcName string) error {
+	return b.update(addrList, tntcfg, getAs3SrcAddressAttr("snat", namespace, ruleName, svcName))
+}
+
+// UpdateNamespaceSourceAddress updates the source address list of the namespace egress rule to the addresses of
+// its namespace
+func (b *AddressListBatcher) UpdateNamespaceSourceAddress(addrs []string, tntcfg *TenantConfig, namespace, ruleName string) error {
+	return b.update(newBigIpAddressList(addrs), tntcfg, getAs3SrcAddressAttr("ns", namespace, ruleName, ""))
+}
+
+// UpdateClusterSourceAddress updates the source address list of the cluster egress rule to the addresses of the
+// namespaces it selects
+func (b *AddressListBatcher) UpdateClusterSourceAddress(addrs []string, tntcfg *TenantConfig, ruleName string) error {
+	return b.update(newBigIpAddressList(addrs), tntcfg, getAs3SrcAddressAttr("global", "", ruleName, ""))
+}
+
+// newBigIpAddressList returns the address list of addrs, an empty list has the placeholders as it is declared
+func newBigIpAddressList(addrs []string) BigIpAddressList {
+	if len(addrs) == 0 {
+		addrs = emptyAddressPlaceholders
+	}
+	list := BigIpAddressList{Addresses: make([]BigIpAddresses, 0, len(addrs))}
+	for _, addr := range addrs {
+		list.Addresses = append(list.Addresses, BigIpAddresses{Name: addr})
+	}
+	return list
+}
+
+func (b *AddressListBatcher) update(addrList BigIpAddressList, tntcfg *TenantConfig, srcAddressAttr string) error {
+	//the endpoints without ready addresses replace the stale addresses on BIG-IP with the placeholders
+	if len(addrList.Addresses) == 0 {
+		addrList = newBigIpAddressList(nil)
+	}
+	partition := tntcfg.Name
+	url := getAddressListURL(partition, srcAddressAttr)
+	if b.window <= 0 {
+		return b.apply(partition, map[string]BigIpAddressList{url: withRouteDomainAddressList(addrList, tntcfg)})
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	lists, ok := b.pending[partition]
+	if !ok {
+		//the first update of the tenant in the window schedules the flush
+		lists = map[string]BigIpAddressList{}
+		b.pending[partition] = lists
+		time.AfterFunc(b.window, func() {
+			b.flush(partition)
+		})
+	}
+	lists[url] = withRouteDomainAddressList(addrList, tntcfg)
+	return nil
+}
+
+// flush applies the pending address lists of the tenant of partition
+func (b *AddressListBatcher) flush(partition string) {
+	b.lock.Lock()
+	lists := b.pending[partition]
+	delete(b.pending, partition)
+	b.lock.Unlock()
+	if len(lists) == 0 {
+		return
+	}
+	if err := b.apply(partition, lists); err != nil {
+		b.onFailed(partition, err)
+	}
+}
+
+// apply updates the address lists of the tenant of partition by url in one transaction, and saves the
+// configuration once
+func (b *AddressListBatcher) apply(partition string, lists map[string]BigIpAddressList) error {
+	objs := make(map[string]interface{}, len(lists))
+	for url, list := range lists {
+		objs[url] = list
+	}
+	//the declaration of the tenant is not posted while the address lists are updated
+	b.client.Lock()
+	defer b.client.Unlock()
+	err := b.client.patchF5ResourcesInTransaction(objs)
+	metrics.EndpointUpdates.WithLabelValues(partition, metrics.Result(err)).Add(float64(len(lists)))
+	if err != nil {
+		klog.Errorf("failed to update %d address lists of tenant[%s]: %v", len(lists), partition, err)
+		return err
+	}
+	klog.Infof("updated %d address lists of tenant[%s]", len(lists), partition)
+	if err = b.client.storeDisk(); err != nil {
+		klog.Errorf("BIG-IP store disk error: %v", err)
+	}
+	return nil
+}
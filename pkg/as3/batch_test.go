@@ -0,0 +1,117 @@
+package as3
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// go test -mod=vendor -run="^TestAddressListBatcher$" -v
+func TestAddressListBatcher(t *testing.T) {
+	var lock sync.Mutex
+	requests := []string{}
+	patched := map[string]string{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == transactionURL:
+			w.Write([]byte(`{"transId":1389812351012345}`))
+		case r.URL.Path == transactionURL+"/1389812351012345":
+			w.Write([]byte(`{"transId":1389812351012345,"state":"COMPLETED"}`))
+		case r.Header.Get(transactionHeader) != "":
+			if r.Header.Get(transactionHeader) != "1389812351012345" {
+				t.Errorf("unexpected transaction %s", r.Header.Get(transactionHeader))
+			}
+			patched[r.URL.Path] = string(body)
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	initTenantConfig(As3Config{
+		ClusterName: "k8s",
+		Tenant:      []TenantConfig{{Name: DefaultPartition, Namespaces: "ns"}},
+	}, "kube-system")
+	client := NewClient(strings.TrimPrefix(srv.URL, "https://"), "admin", "admin", true)
+	failed := []string{}
+	b := NewAddressListBatcher(client, time.Hour, func(partition string, err error) {
+		failed = append(failed, partition)
+	})
+	tntcfg := &TenantConfig{Name: "k8s", RouteDomain: RouteDomain{Id: 2}}
+	addresses := func(ips ...string) BigIpAddressList {
+		list := BigIpAddressList{}
+		for _, ip := range ips {
+			list.Addresses = append(list.Addresses, BigIpAddresses{Name: ip})
+		}
+		return list
+	}
+	b.UpdateBigIPSourceAddress(addresses("10.0.0.1"), tntcfg, "ns", "rule", "svc")
+	b.UpdateBigIPSourceAddress(addresses("10.0.0.1", "10.0.0.2"), tntcfg, "ns", "rule", "svc")
+	b.UpdateBigIPSnatSourceAddress(addresses("10.0.0.3"), tntcfg, "ns", "eip", "svc")
+	b.UpdateBigIPSnatSourceAddress(addresses(), tntcfg, "ns", "eip", "svc")
+	b.UpdateNamespaceSourceAddress([]string{"10.0.1.1"}, tntcfg, "ns", "nsrule")
+	b.UpdateClusterSourceAddress(nil, tntcfg, "clsrule")
+	b.flush("k8s")
+
+	expectedRequests := []string{
+		"POST " + transactionURL,
+		"PATCH " + getAddressListURL("k8s", getAs3SrcAddressAttr("global", "", "clsrule", "")),
+		"PATCH " + getAddressListURL("k8s", getAs3SrcAddressAttr("ns", "ns", "nsrule", "")),
+		"PATCH " + getAddressListURL("k8s", getAs3SrcAddressAttr("snat", "ns", "eip", "svc")),
+		"PATCH " + getAddressListURL("k8s", getAs3SrcAddressAttr("svc", "ns", "rule", "svc")),
+		"PATCH " + transactionURL + "/1389812351012345",
+		"POST /mgmt/tm/sys/config",
+	}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("requests = %v, expected %v", requests, expectedRequests)
+	}
+	list := BigIpAddressList{}
+	json.Unmarshal([]byte(patched[getAddressListURL("k8s", getAs3SrcAddressAttr("svc", "ns", "rule", "svc"))]), &list)
+	if !reflect.DeepEqual(list, addresses("10.0.0.1%2", "10.0.0.2%2")) {
+		t.Errorf("address list = %v, expected the latest update", list)
+	}
+	//the list selecting no namespace keeps the placeholders as it is declared
+	list = BigIpAddressList{}
+	json.Unmarshal([]byte(patched[getAddressListURL("k8s", getAs3SrcAddressAttr("global", "", "clsrule", ""))]), &list)
+	if !reflect.DeepEqual(list, addresses("192.0.2.1%2", "100::1%2")) {
+		t.Errorf("address list = %v, expected the placeholders", list)
+	}
+	//the endpoints without addresses replace the stale addresses with the placeholders
+	list = BigIpAddressList{}
+	json.Unmarshal([]byte(patched[getAddressListURL("k8s", getAs3SrcAddressAttr("snat", "ns", "eip", "svc"))]), &list)
+	if !reflect.DeepEqual(list, addresses("192.0.2.1%2", "100::1%2")) {
+		t.Errorf("address list = %v, expected the placeholders", list)
+	}
+	if len(failed) != 0 {
+		t.Errorf("failed tenants = %v", failed)
+	}
+
+	//each update is applied in its own transaction and saved without the window
+	requests = []string{}
+	b = NewAddressListBatcher(client, 0, func(partition string, err error) {
+		failed = append(failed, partition)
+	})
+	if err := b.UpdateBigIPSourceAddress(addresses("10.0.0.4"), tntcfg, "ns", "rule", "svc"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	expectedRequests = []string{
+		"POST " + transactionURL,
+		"PATCH " + getAddressListURL("k8s", getAs3SrcAddressAttr("svc", "ns", "rule", "svc")),
+		"PATCH " + transactionURL + "/1389812351012345",
+		"POST /mgmt/tm/sys/config",
+	}
+	if !reflect.DeepEqual(requests, expectedRequests) {
+		t.Errorf("requests = %v, expected %v", requests, expectedRequests)
+	}
+}
@@ -26,11 +26,16 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"k8s.io/klog/v2"
+
+	"github.com/kubeovn/ces-controller/pkg/metrics"
 )
 
 // Client represents an AS3 client
@@ -42,6 +47,10 @@ type Client struct {
 	host string
 	*http.Client
 	sync.Mutex
+
+	//licenseVerified and defaultTenantInitialized are set to 1 once they are, for the readiness
+	licenseVerified          int32
+	defaultTenantInitialized int32
 }
 
 func NewClient(ip, username, password string, insecure bool) *Client {
@@ -64,6 +73,25 @@ func NewClient(ip, username, password string, insecure bool) *Client {
 	return client
 }
 
+// do sends req of the tenant to BIG-IP, and records its count and latency
+func (c *Client) do(req *http.Request, tenant string) (*http.Response, error) {
+	start := time.Now()
+	defer func() {
+		metrics.AS3Requests.WithLabelValues(req.Method, tenant).Inc()
+		metrics.AS3RequestDuration.WithLabelValues(req.Method, tenant).Observe(time.Since(start).Seconds())
+	}()
+	return c.Do(req)
+}
+
+// tenantOfURL returns the tenant of a BIG-IP resource url, eg: Common of /mgmt/tm/net/route-domain/~Common~0
+func tenantOfURL(url string) string {
+	parts := strings.Split(url, "~")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
 func (c *Client) post(data interface{}, tenants ...string) error {
 	b, err := json.Marshal(data)
 	if err != nil {
@@ -78,7 +106,7 @@ func (c *Client) post(data interface{}, tenants ...string) error {
 	klog.V(3).Infof("method = %s, url = %s, body = %s", req.Method, req.URL.String(), string(b))
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, strings.Join(tenants, ","))
 	if err != nil {
 		klog.Errorf("Failed to call AS3 API: %v", err)
 		return err
@@ -107,7 +135,7 @@ func (c *Client) Get(partition string) (string, error) {
 	}
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, partition)
 	if err != nil {
 		klog.Errorf("Failed to call AS3 API: %v", err)
 		return "", err
@@ -148,7 +176,7 @@ func (c *Client) PostRaw(data []byte) error {
 	klog.Infof("method = %s, url = %s, body = %s", req.Method, req.URL.String(), string(data))
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, "")
 	if err != nil {
 		klog.Errorf("Failed to call AS3 API: %v", err)
 		return err
@@ -187,7 +215,7 @@ func (c *Client) patch(patchItems ...PatchItem) error {
 	klog.Infof("request: method = %s, url = %s, body = %s", req.Method, req.URL.String(), string(b))
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, "")
 	if err != nil {
 		klog.Errorf("Failed to call AS3 API: %v", err)
 		return err
@@ -216,12 +244,17 @@ func handleResponse(statusCode int, response map[string]interface{}) error {
 	if results, ok := (response["results"]).([]interface{}); ok {
 		for _, value := range results {
 			v := value.(map[string]interface{})
+			if code := fmt.Sprint(v["code"]); code != "200" {
+				metrics.BigIPErrors.WithLabelValues(code).Inc()
+			}
 			klog.Errorf("Response from BIG-IP: code = %v, tenant = %v, message = %v, response = %v", v["code"], v["tenant"], v["message"], v["response"])
 		}
 	} else if err, ok := (response["error"]).(map[string]interface{}); ok {
+		metrics.BigIPErrors.WithLabelValues(fmt.Sprint(err["code"])).Inc()
 		//klog.Errorf("Big-IP Responded with error code: %v", err["code"])
 		return fmt.Errorf("Big-IP Responded with error code: %v", err["code"])
 	} else {
+		metrics.BigIPErrors.WithLabelValues(strconv.Itoa(statusCode)).Inc()
 		//klog.Errorf("Big-IP Responded with code: %v", response["code"])
 		return fmt.Errorf("Big-IP Responded with status code: %v", response["code"])
 	}
@@ -242,7 +275,7 @@ func (c *Client) patchF5Reource(obj interface{}, url string) error {
 	klog.V(3).Infof("method = %s, url = %s, body = %s", req.Method, req.URL.String(), string(data))
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, tenantOfURL(url))
 	if err != nil {
 		klog.Errorf("Failed to call BIG-IP API: %v", err)
 		return err
@@ -275,7 +308,7 @@ func (c *Client) getF5Resource(url string) (response map[string]interface{}, err
 	}
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, tenantOfURL(url))
 	if err != nil {
 		klog.Errorf("Failed to call BIG-IP API: %v", err)
 		return
@@ -310,7 +343,7 @@ func (c *Client) postF5Resouce(obj interface{}, url string) error {
 	klog.V(3).Infof("method = %s, url = %s, body = %s", req.Method, req.URL.String(), string(data))
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, tenantOfURL(url))
 	if err != nil {
 		klog.Errorf("Failed to call AS3 API: %v", err)
 		return err
@@ -335,7 +368,89 @@ func (c *Client) postF5Resouce(obj interface{}, url string) error {
 	return nil
 }
 
-func (c *Client) storeDisk() error {
+// requestF5Resource requests the BIG-IP resource of url with obj as the body, in the transaction of transID
+// if it is not empty
+func (c *Client) requestF5Resource(method, url string, obj interface{}, transID string) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, c.host+url, bytes.NewBuffer(data))
+	if err != nil {
+		klog.Errorf("Failed to create BIG-IP resouce request: %v", err)
+		return nil, err
+	}
+	klog.V(3).Infof("method = %s, url = %s, transaction = %s, body = %s", req.Method, req.URL.String(), transID, string(data))
+	req.SetBasicAuth(c.username, c.password)
+	if transID != "" {
+		req.Header.Set(transactionHeader, transID)
+	}
+
+	resp, err := c.do(req, tenantOfURL(url))
+	if err != nil {
+		klog.Errorf("Failed to call BIG-IP API: %v", err)
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		klog.Errorf("Failed to read response body: %v", err)
+		return nil, err
+	}
+	klog.V(3).Infof("response: body = %s", string(respBody))
+	//the transaction id overflows the precision of float64
+	var response map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(respBody))
+	decoder.UseNumber()
+	if err = decoder.Decode(&response); err != nil {
+		klog.Errorf("Failed to unmarshal response body: %v", err)
+		return nil, err
+	}
+	if err = handleResponse(resp.StatusCode, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// patchF5ResourcesInTransaction patches the BIG-IP resources of the urls in objs in one iControl REST transaction,
+// none of them is patched if the transaction fails
+func (c *Client) patchF5ResourcesInTransaction(objs map[string]interface{}) error {
+	if len(objs) == 0 {
+		return nil
+	}
+	trans, err := c.requestF5Resource(http.MethodPost, transactionURL, struct{}{}, "")
+	if err != nil {
+		return fmt.Errorf("failed to create transaction: %v", err)
+	}
+	transID := fmt.Sprint(trans["transId"])
+
+	urls := make([]string, 0, len(objs))
+	for url := range objs {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	for _, url := range urls {
+		if _, err = c.requestF5Resource(http.MethodPatch, url, objs[url], transID); err != nil {
+			c.requestF5Resource(http.MethodDelete, transactionURL+"/"+transID, struct{}{}, "")
+			return fmt.Errorf("failed to add %s to transaction[%s]: %v", url, transID, err)
+		}
+	}
+
+	result, err := c.requestF5Resource(http.MethodPatch, transactionURL+"/"+transID, map[string]string{"state": "VALIDATING"}, "")
+	if err != nil {
+		return fmt.Errorf("failed to commit transaction[%s]: %v", transID, err)
+	}
+	if state := fmt.Sprint(result["state"]); state != "COMPLETED" {
+		return fmt.Errorf("transaction[%s] is %s: %v", transID, state, result["failureReason"])
+	}
+	return nil
+}
+
+func (c *Client) storeDisk() (err error) {
+	defer func() {
+		metrics.StoreDisks.WithLabelValues(metrics.Result(err)).Inc()
+	}()
 	obj := struct {
 		Commond string `json:"command"`
 	}{
@@ -353,7 +468,7 @@ func (c *Client) storeDisk() error {
 	}
 	klog.V(3).Infof("method = %s, url = %s, body = %s", req.Method, req.URL.String(), string(data))
 	req.SetBasicAuth(c.username, c.password)
-	resp, err := c.Do(req)
+	resp, err := c.do(req, "")
 	if err != nil {
 		klog.Errorf("Failed to call BIG-IP API: %v", err)
 		return err
@@ -384,7 +499,7 @@ func (c *Client) getF5LicenseKey() (string, error) {
 	}
 	req.SetBasicAuth(c.username, c.password)
 
-	resp, err := c.Do(req)
+	resp, err := c.do(req, "")
 	if err != nil {
 		klog.Errorf("Failed to call bigdata API: %v", err)
 		return "", err
@@ -454,6 +569,7 @@ func (c *Client) VerifyLicense(license string, key string) error {
 		return fmt.Errorf("license is not ok")
 	}
 
+	atomic.StoreInt32(&c.licenseVerified, 1)
 	return nil
 }
 
@@ -27,6 +27,7 @@ const (
 	ClassLogDestination       = "Log_Destination"
 	ClassNatPolicy            = "NAT_Policy"
 	ClassNatSourceTranslation = "NAT_Source_Translation"
+	ClassFirewallSchedule     = "Firewall_Schedule"
 )
 
 const (
@@ -49,8 +50,13 @@ const (
 )
 
 const (
-	RuleTypeLabel = "cpaas.io/ruleType"
+	// transactionURL is the url of the iControl REST transactions
+	transactionURL = "/mgmt/tm/transaction"
+	// transactionHeader adds a request to the transaction of its value
+	transactionHeader = "X-F5-REST-Coordination-Id"
+)
 
+const (
 	RuleTypeGlobal    = "global"
 	RuleTypeNamespace = "namespace"
 	RuleTypeService   = "service"
@@ -61,8 +67,46 @@ const (
 )
 
 const (
+	// types of the drift of a BIG-IP object from the desired state
+	DriftMissing    = "missing"
+	DriftModified   = "modified"
+	DriftUnexpected = "unexpected"
+)
+
+const (
+	// DefaultRulePriority is the priority of egress rules which do not set one
+	DefaultRulePriority = 1000
+	// the priority of a rule is kept in the remark of its firewall rule list
+	rulePriorityRemarkPrefix = "priority="
+)
+
+const (
+	// dual stack cidrs are separated by comma, eg: 10.16.0.0/16,fd00:10:16::/64
 	NamespaceCidr = "ovn.kubernetes.io/cidr"
 )
 
+const (
+	// types of the provider of the source addresses of namespaces
+	NamespaceSourceKubeOVN    = "kube-ovn"
+	NamespaceSourceAnnotation = "annotation"
+	NamespaceSourceCalico     = "calico"
+	NamespaceSourcePodIP      = "pod-ip"
+)
+
+const (
+	// IPv6 objects are named after the IPv4 ones with the suffix
+	ipv6Suffix = "_v6"
+
+	defaultVirtualAddress   = "0.0.0.0"
+	defaultVirtualAddressV6 = "::"
+)
+
+// as3不允许addresses为nil或addresses的lenth为0, the placeholders are in the reserved ranges
+// of RFC 5737 and RFC 6666 so that no egress traffic of either family matches them
+var emptyAddressPlaceholders = []string{"192.0.2.1", "100::1"}
+
+// AS3 Firewall_Schedule date format, eg: 2021-01-01T00:00:00Z
+const scheduleDateFormat = "2006-01-02T15:04:05Z"
+
 // eg: Common/Shared/k8s
 const pathProfix = "/%s/Shared/%s"
@@ -0,0 +1,125 @@
+package as3
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// OwnerClusterEgressRule is the kind of the owner of the objects of a cluster egress rule
+	OwnerClusterEgressRule = "ClusterEgressRule"
+	// OwnerNamespaceEgressRule is the kind of the owner of the objects of a namespace egress rule
+	OwnerNamespaceEgressRule = "NamespaceEgressRule"
+	// OwnerServiceEgressRule is the kind of the owner of the objects of a service egress rule
+	OwnerServiceEgressRule = "ServiceEgressRule"
+	// OwnerExternalIPRule is the kind of the owner of the objects of an external ip rule
+	OwnerExternalIPRule = "ExternalIPRule"
+)
+
+// ObjectOwner is the resource which an object of this cluster is declared for
+type ObjectOwner struct {
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+// GetObjectOwner returns the owner of the object of attr parsed from its name, which is prefixed by the cluster,
+// the type and the namespace and name of the rule, eg: k8s_ns_project1_rule1_ext_saas_rule_list
+func GetObjectOwner(attr string) (ObjectOwner, bool) {
+	if !isClusterObject(attr, nil) {
+		return ObjectOwner{}, false
+	}
+	//the names of kubernetes resources have no underscore, the objects of the rules have suffixes after
+	//their names, unlike the policies, eg: k8s_ns_policy_rd
+	parts := strings.Split(strings.TrimPrefix(attr, GetCluster()+"_"), "_")
+	switch {
+	case parts[0] == "global" && len(parts) > 2:
+		return ObjectOwner{Kind: OwnerClusterEgressRule, Name: parts[1]}, true
+	case parts[0] == "ns" && len(parts) > 3:
+		return ObjectOwner{Kind: OwnerNamespaceEgressRule, Namespace: parts[1], Name: parts[2]}, true
+	case parts[0] == "svc" && len(parts) > 3:
+		return ObjectOwner{Kind: OwnerServiceEgressRule, Namespace: parts[1], Name: parts[2]}, true
+	case parts[0] == "snat" && len(parts) > 2:
+		return ObjectOwner{Kind: OwnerExternalIPRule, Namespace: parts[1], Name: parts[2]}, true
+	}
+	return ObjectOwner{}, false
+}
+
+// GetClusterObjectOwners returns the owners of the objects of this cluster declared in the tenant of partition
+// by their paths, the nat rules of the snat policy are included
+func (c *Client) GetClusterObjectOwners(partition string) (map[string]ObjectOwner, error) {
+	c.Lock()
+	defer c.Unlock()
+	app, err := c.getSharedApp(partition)
+	if err != nil || app == nil {
+		return nil, err
+	}
+	owners := map[string]ObjectOwner{}
+	for attr, value := range app {
+		if !isClusterObject(attr, value) {
+			continue
+		}
+		if owner, ok := GetObjectOwner(attr); ok {
+			owners[getAs3UsePathForPartition(partition, attr)] = owner
+		}
+	}
+	if value, ok := app[defaultSnatPolicy]; ok {
+		natPolicy := NatPolicy{}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, &natPolicy); err != nil {
+			return nil, err
+		}
+		for _, rule := range natPolicy.Rules {
+			if owner, ok := GetObjectOwner(rule.Name); ok {
+				owners[getAs3UsePathForPartition(partition, defaultSnatPolicy+"/"+rule.Name)] = owner
+			}
+		}
+	}
+	return owners, nil
+}
+
+// RemoveObjects removes the objects of paths from the tenant of partition on BIG-IP, with the references of them
+func (c *Client) RemoveObjects(partition string, paths []string) error {
+	c.Lock()
+	defer c.Unlock()
+	app, err := c.getSharedApp(partition)
+	if err != nil || app == nil {
+		return err
+	}
+	sort.Strings(paths)
+	if !deleteObjectPaths(partition, app, paths) {
+		return nil
+	}
+	sortFirewallPolicies(app)
+	if err = c.post(newAs3Obj(partition, app), partition); err != nil {
+		return fmt.Errorf("failed to request AS3 POST API: %v", err)
+	}
+	return nil
+}
+
+// getSharedApp returns the Shared application of the tenant of partition on BIG-IP, it is nil if the tenant
+// is not declared
+func (c *Client) getSharedApp(partition string) (map[string]interface{}, error) {
+	adcStr, err := c.Get(partition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant[%s], error: %v", partition, err)
+	}
+	srcAdc := map[string]interface{}{}
+	if err = validateJSONAndFetchObject(adcStr, &srcAdc); err != nil {
+		return nil, err
+	}
+	src := as3ADC(srcAdc).getAS3SharedApp(partition)
+	if src == nil {
+		return nil, nil
+	}
+	app := map[string]interface{}{}
+	if err = validateJSONAndFetchObject(src, &app); err != nil {
+		return nil, err
+	}
+	return app, nil
+}
@@ -0,0 +1,35 @@
+package as3
+
+import (
+	"testing"
+)
+
+// go test -mod=vendor -run="^TestGetObjectOwner$" -v
+func TestGetObjectOwner(t *testing.T) {
+	initTenantConfig(As3Config{
+		ClusterName: "k8s",
+		Tenant:      []TenantConfig{{Name: DefaultPartition, Namespaces: "project1"}},
+	}, "kube-system")
+	tests := []struct {
+		attr  string
+		owner ObjectOwner
+		ok    bool
+	}{
+		{getAs3RuleListAttr("global", "", "rule1", "saas"), ObjectOwner{Kind: OwnerClusterEgressRule, Name: "rule1"}, true},
+		{getAs3SrcAddressAttr("global", "", "rule1", ""), ObjectOwner{Kind: OwnerClusterEgressRule, Name: "rule1"}, true},
+		{getAs3RuleListAttr("ns", "project1", "rule-2", "saas"), ObjectOwner{Kind: OwnerNamespaceEgressRule, Namespace: "project1", Name: "rule-2"}, true},
+		{getAs3SrcAddressAttr("svc", "project1", "rule3", "web"), ObjectOwner{Kind: OwnerServiceEgressRule, Namespace: "project1", Name: "rule3"}, true},
+		{getAs3NatRuleListAttr("project1", "eip.1", ""), ObjectOwner{Kind: OwnerExternalIPRule, Namespace: "project1", Name: "eip.1"}, true},
+		{getAs3NatRuleListAttr("project1", "eip.1", "src_trans"), ObjectOwner{Kind: OwnerExternalIPRule, Namespace: "project1", Name: "eip.1"}, true},
+		{defaultSnatRule, ObjectOwner{}, false},
+		{getAllDenyRuleListAttr(), ObjectOwner{}, false},
+		{getAs3PolicyAttr("ns", "rd"), ObjectOwner{}, false},
+		{"other_ns_project1_rule1_ext_saas_rule_list", ObjectOwner{}, false},
+	}
+	for _, test := range tests {
+		owner, ok := GetObjectOwner(test.attr)
+		if owner != test.owner || ok != test.ok {
+			t.Errorf("GetObjectOwner(%s) = %v, %v, expected %v, %v", test.attr, owner, ok, test.owner, test.ok)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package as3
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// CheckAS3 returns an error if the AS3 info endpoint of BIG-IP is not reachable
+func (c *Client) CheckAS3() error {
+	_, err := c.getF5Resource("/mgmt/shared/appsvcs/info")
+	return err
+}
+
+// CheckLicense returns an error until the license is verified
+func (c *Client) CheckLicense() error {
+	if atomic.LoadInt32(&c.licenseVerified) == 0 {
+		return fmt.Errorf("license is not verified")
+	}
+	return nil
+}
+
+// CheckDefaultTenant returns an error until the Common tenant is declared on BIG-IP, by InitDefaultTenant
+// of this replica or the leader of the master cluster
+func (c *Client) CheckDefaultTenant() error {
+	if atomic.LoadInt32(&c.defaultTenantInitialized) == 1 {
+		return nil
+	}
+	as3Str, err := c.Get(DefaultPartition)
+	if err != nil {
+		return err
+	}
+	if as3Str == "{}" {
+		return fmt.Errorf("tenant[%s] is not initialized", DefaultPartition)
+	}
+	atomic.StoreInt32(&c.defaultTenantInitialized, 1)
+	return nil
+}
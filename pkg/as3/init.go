@@ -2,7 +2,9 @@ package as3
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync/atomic"
 
 	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
@@ -45,19 +47,33 @@ namespaces:
 `
 		return fmt.Errorf("No configured Common, please configured, eg: \n%s\n", msg)
 	}
+	return nil
+}
 
-	if getMasterCluster() == GetCluster() {
-		as3Str, err := client.Get(DefaultPartition)
-		if err != nil {
-			return fmt.Errorf("failed to get partition, due to: %v", err)
-		}
-		if as3Str == "{}" {
-			return client.post(initDefaultAS3(), DefaultPartition)
+// InitDefaultTenant declares the Common tenant on BIG-IP if it is not declared yet, by the master cluster
+func InitDefaultTenant(client *Client) error {
+	if getMasterCluster() != GetCluster() {
+		return nil
+	}
+	as3Str, err := client.Get(DefaultPartition)
+	if err != nil {
+		return fmt.Errorf("failed to get partition, due to: %v", err)
+	}
+	if as3Str == "{}" {
+		if err = client.post(initDefaultAS3(), DefaultPartition); err != nil {
+			return err
 		}
 	}
+	atomic.StoreInt32(&client.defaultTenantInitialized, 1)
 	return nil
 }
 
+// SetTenantConfig stores as3Config as if it is read from ces-conf.yaml, the external services of the cluster
+// egress rules are in cesNamespace
+func SetTenantConfig(as3Config As3Config, cesNamespace string) {
+	initTenantConfig(as3Config, cesNamespace)
+}
+
 func initTenantConfig(as3Config As3Config, cesNamespace string) {
 	//store cluster in sync.Map
 	registValue(schemaVersionKey, as3Config.SchemaVersion)
@@ -68,6 +84,7 @@ func initTenantConfig(as3Config As3Config, cesNamespace string) {
 		registValue(masterClusterKey, as3Config.MasterCluster)
 	}
 	registValue(isSupportRouteDomainKey, as3Config.IsSupportRouteDomain)
+	registValue(isSupportIPv6Key, as3Config.IsSupportIPv6)
 	registValue(logPoolKey, as3Config.LogPool)
 	registValue(as3IRulesListKey, as3Config.IRule)
 	//store ces serviceacount namespace, used cluster exsvc ns
@@ -123,6 +140,46 @@ func GetTenantConfigForParttition(partition string) *TenantConfig {
 	return tntcfg
 }
 
+// GetTenantPartitions returns the sorted partitions of the configured tenants, there is only Common if route
+// domain isn't supported
+func GetTenantPartitions() []string {
+	v := getValue(partitionCacheKey)
+	if v == nil {
+		return nil
+	}
+	cacheMap, ok := v.(map[string]*TenantConfig)
+	if !ok {
+		return nil
+	}
+	if !IsSupportRouteDomain() {
+		if _, ok = cacheMap[DefaultPartition]; !ok {
+			return nil
+		}
+		return []string{DefaultPartition}
+	}
+	partitions := make([]string, 0, len(cacheMap))
+	for partition := range cacheMap {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+	return partitions
+}
+
+// IsNamespaceSourceUsed returns whether any configured tenant gets the source addresses of its namespaces
+// from the provider of sourceType, the tenants without one use kube-ovn
+func IsNamespaceSourceUsed(sourceType string) bool {
+	for _, partition := range GetTenantPartitions() {
+		tntcfg := GetTenantConfigForParttition(partition)
+		if tntcfg == nil {
+			continue
+		}
+		if tntcfg.NamespaceSource.Type == sourceType || (tntcfg.NamespaceSource.Type == "" && sourceType == NamespaceSourceKubeOVN) {
+			return true
+		}
+	}
+	return false
+}
+
 func cacheTenantConfigForNamespace(namespace string, tntcfg TenantConfig) {
 	v := getValue(namespaceCacheKey)
 	if v == nil {
@@ -184,6 +241,15 @@ func IsSupportRouteDomain() bool {
 	return v.(bool)
 }
 
+// IsSupportIPv6 returns whether the IPv6 outbound virtual address is declared besides the IPv4 one
+func IsSupportIPv6() bool {
+	v := getValue(isSupportIPv6Key)
+	if v == nil {
+		return false
+	}
+	return v.(bool)
+}
+
 func getIRules() []string {
 	v := getValue(as3IRulesListKey)
 	if v == nil {
@@ -217,12 +283,13 @@ func skipDeleteShareApplicationClassOrAttr(partition, attr string) bool {
 		TemplateKey:              true,
 		getAs3VSAttr():           true,
 		getAs3VsVaAttr():         true,
+		getAs3VsVaV6Attr():       true,
 		getAs3GwPoolAttr():       true,
 		getAllDenyRuleListAttr(): true,
 	}
 	shareApp := as3Application{}
 	tntcfg := GetTenantConfigForParttition(partition)
-	ac := newAs3Post(nil, nil, nil, nil, nil, nil, nil, tntcfg)
+	ac := newAs3Post(nil, nil, nil, nil, nil, nil, nil, nil, tntcfg)
 	ac.newLogPoolDecl(shareApp)
 	for k, _ := range shareApp {
 		skipDeleteShareApplicationAttr[k] = true
@@ -235,6 +302,11 @@ func GetIRules() string {
 	return strings.Join(irules, ",")
 }
 
+// GetIRuleList returns the iRules which can be used as bandwidth of external service ports
+func GetIRuleList() []string {
+	return getIRules()
+}
+
 func GetClusterSvcExtNamespace() string {
 	clusterSvcExtNamespace := getValue(clusterSvcExtNamespaceKey)
 	if clusterSvcExtNamespace == nil {
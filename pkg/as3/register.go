@@ -8,6 +8,7 @@ const (
 	as3DefaultTemplateKey     = "__AS3_DEFAULT_TEMPLATE__"
 	currentClusterKey         = "__CLUSTER__"
 	isSupportRouteDomainKey   = "__IS_SUPPORT_ROUTE_DOMAIN__"
+	isSupportIPv6Key          = "__IS_SUPPORT_IPV6__"
 	logPoolKey                = "__LOG_POOL__"
 	schemaVersionKey          = "__SCHEMAVERSION__"
 	namespaceCacheKey         = "__NAMESPACE_CACHE_KEY__"
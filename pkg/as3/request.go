@@ -2,27 +2,28 @@ package as3
 
 import (
 	"fmt"
-	"sync"
-	"time"
+	"reflect"
 
 	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/metrics"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/klog/v2"
 )
 
-func (c *Client) As3Request(serviceEgressList *v1alpha1.ServiceEgressRuleList, namespaceEgressList *v1alpha1.NamespaceEgressRuleList,
+// As3Reconcile declares the Shared application of the tenant rendered from all of its resources, the objects of
+// this cluster which are not rendered are removed, and the declaration is posted only if it differs from BIG-IP
+func (c *Client) As3Reconcile(serviceEgressList *v1alpha1.ServiceEgressRuleList, namespaceEgressList *v1alpha1.NamespaceEgressRuleList,
 	clusterEgressList *v1alpha1.ClusterEgressRuleList, externalServiceList *v1alpha1.ExternalServiceList,
 	externalIPRuleList *snat.ExternalIPRuleList,
-	endpointList *corev1.EndpointsList, namespaceList *corev1.NamespaceList, tenantConfig *TenantConfig,
-	ty string, isDelete bool) error {
-	//Full synchronization will cause the latest data to be updated
+	endpointList *corev1.EndpointsList, podList *corev1.PodList, namespaceList *NamespaceList,
+	tenantConfig *TenantConfig) error {
 	c.Lock()
 	defer c.Unlock()
 	as3PostParam := newAs3Post(serviceEgressList, namespaceEgressList, clusterEgressList, externalServiceList, externalIPRuleList,
-		endpointList, namespaceList, tenantConfig)
-	deltaAdc := as3ADC{}
-	as3PostParam.generateAS3ResourceDeclaration(deltaAdc)
+		endpointList, podList, namespaceList, tenantConfig)
+	desiredAdc := as3ADC{}
+	as3PostParam.generateAS3ResourceDeclaration(desiredAdc)
 	partition := tenantConfig.Name
 	adcStr, err := c.Get(partition)
 	if err != nil {
@@ -33,150 +34,145 @@ func (c *Client) As3Request(serviceEgressList *v1alpha1.ServiceEgressRuleList, n
 	if err != nil {
 		return err
 	}
-	reqBody := fullResource(partition, isDelete, srcAdc, deltaAdc)
+	reqBody := reconcileResource(partition, srcAdc, desiredAdc)
 	if reqBody == nil {
-		klog.Info("as3 is not update")
-		return nil
-	}
-	err = c.post(reqBody, partition)
-	if err != nil {
-		err = fmt.Errorf("failed to request AS3 POST API: %v", err)
-		return err
-	}
-
-	if ty == RuleTypeGlobal {
-		//get route domian police
-		globalPolicyPath := getAs3UsePathForPartition(partition, getAs3PolicyAttr(RuleTypeGlobal, tenantConfig.RouteDomain.Name))
-		url := "/mgmt/tm/security/firewall/global-rules"
-		response, err := c.getF5Resource(url)
+		klog.Infof("tenant[%s] is up to date", partition)
+	} else {
+		err = c.post(reqBody, partition)
 		if err != nil {
-			return err
-		}
-		isExist := false
-		if val, ok := response[EnforcedPolicyKey]; ok {
-			fwEnforcedPolicy := val.(string)
-			if fwEnforcedPolicy == globalPolicyPath {
-				isExist = true
-			}
-		}
-		// created global policy
-		if !isExist {
-			globalPolicy := map[string]string{
-				EnforcedPolicyKey: globalPolicyPath,
-			}
-			err := c.patchF5Reource(globalPolicy, url)
-			if err != nil {
-				return err
-			}
-
-			err = c.storeDisk()
-			if err != nil {
-				return err
-			}
+			return fmt.Errorf("failed to request AS3 POST API: %v", err)
 		}
+	}
+	setAddressListMetrics(partition, as3ADC(desiredAdc).getAS3SharedApp(partition))
 
-	} else if ty == RuleTypeNamespace {
-		nsRouteDomainPolicePath := getAs3UsePathForPartition(partition, getAs3PolicyAttr("ns", tenantConfig.RouteDomain.Name))
-		//get route domian police
-		url := fmt.Sprintf("/mgmt/tm/net/route-domain/~%s~%s", tenantConfig.Name, tenantConfig.RouteDomain.Name)
-		response, err := c.getF5Resource(url)
-		if err != nil {
-			klog.Errorf("failed to get route domian %s, error:%v", tenantConfig.RouteDomain.Name, err)
+	if len(as3PostParam.clusterEgressList.Items) != 0 {
+		if err = c.enforceGlobalPolicy(tenantConfig); err != nil {
 			return err
 		}
-
-		isNsPolicyExist := false
-		if val, ok := response[FwEnforcedPolicyKey]; ok {
-			fwEnforcedPolicy := val.(string)
-			if fwEnforcedPolicy == nsRouteDomainPolicePath {
-				isNsPolicyExist = true
-			}
-		}
-		if !isNsPolicyExist {
-			// binding route domain policy
-			nsPolicy := map[string]string{
-				FwEnforcedPolicyKey: nsRouteDomainPolicePath,
-			}
-			err := c.patchF5Reource(nsPolicy, url)
-			if err != nil {
-				return err
-			}
-
-			err = c.storeDisk()
-			if err != nil {
-				return err
-			}
+	}
+	if len(as3PostParam.namespaceEgressList.Items) != 0 {
+		if err = c.enforceRouteDomainPolicy(tenantConfig); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-func (c *Client) updateBigIPSourceAddress(addrList BigIpAddressList, tntcfg *TenantConfig, srcAddressAttr string) error {
-	url := fmt.Sprintf("/mgmt/tm/security/firewall/address-list/~%s~Shared~%s", tntcfg.Name, srcAddressAttr)
-	if tntcfg.RouteDomain.Id != 0 {
-		for k := range addrList.Addresses {
-			addrList.Addresses[k].Name = addrList.Addresses[k].Name + "%10"
-		}
+// As3Drift returns the objects of the Shared application of the tenant on BIG-IP drifting from the declaration rendered
+// from all of its resources, as As3Reconcile would declare
+func (c *Client) As3Drift(serviceEgressList *v1alpha1.ServiceEgressRuleList, namespaceEgressList *v1alpha1.NamespaceEgressRuleList,
+	clusterEgressList *v1alpha1.ClusterEgressRuleList, externalServiceList *v1alpha1.ExternalServiceList,
+	externalIPRuleList *snat.ExternalIPRuleList,
+	endpointList *corev1.EndpointsList, podList *corev1.PodList, namespaceList *NamespaceList,
+	tenantConfig *TenantConfig) ([]Drift, error) {
+	c.Lock()
+	defer c.Unlock()
+	as3PostParam := newAs3Post(serviceEgressList, namespaceEgressList, clusterEgressList, externalServiceList, externalIPRuleList,
+		endpointList, podList, namespaceList, tenantConfig)
+	desiredAdc := as3ADC{}
+	as3PostParam.generateAS3ResourceDeclaration(desiredAdc)
+	partition := tenantConfig.Name
+	adcStr, err := c.Get(partition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tenant[%s], error: %v", partition, err)
+	}
+	srcAdc := map[string]interface{}{}
+	if err = validateJSONAndFetchObject(adcStr, &srcAdc); err != nil {
+		return nil, err
 	}
-	err := c.patchF5Reource(addrList, url)
+	desired := as3ADC(desiredAdc).getAS3SharedApp(partition)
+	src := as3ADC(srcAdc).getAS3SharedApp(partition)
+	if src == nil {
+		src = as3Application{}
+	}
+	originApp, reconciledApp := reconcileSharedApp(partition, src, desired)
+	if reconciledApp == nil {
+		return nil, fmt.Errorf("failed to reconcile tenant[%s]", partition)
+	}
+	return getDrifts(partition, originApp, reconciledApp), nil
+}
+
+// enforceGlobalPolicy enforces the global policy of the cluster egress rules on BIG-IP
+func (c *Client) enforceGlobalPolicy(tenantConfig *TenantConfig) error {
+	//get route domian police
+	globalPolicyPath := getAs3UsePathForPartition(tenantConfig.Name, getAs3PolicyAttr(RuleTypeGlobal, tenantConfig.RouteDomain.Name))
+	url := "/mgmt/tm/security/firewall/global-rules"
+	response, err := c.getF5Resource(url)
 	if err != nil {
-		err = fmt.Errorf("failed to request BIG-IP Patch API: %v", err)
 		return err
 	}
-	go process()
-	return nil
+	if val, ok := response[EnforcedPolicyKey]; ok {
+		if fwEnforcedPolicy, _ := val.(string); fwEnforcedPolicy == globalPolicyPath {
+			return nil
+		}
+	}
+	// created global policy
+	globalPolicy := map[string]string{
+		EnforcedPolicyKey: globalPolicyPath,
+	}
+	if err = c.patchF5Reource(globalPolicy, url); err != nil {
+		return err
+	}
+	return c.storeDisk()
 }
 
-func (c *Client) UpdateBigIPSourceAddress(addrList BigIpAddressList, tntcfg *TenantConfig, namespace, ruleName, svcName string) error {
-	srcAddressAttr := getAs3SrcAddressAttr("svc", namespace, ruleName, svcName)
-	return c.updateBigIPSourceAddress(addrList, tntcfg, srcAddressAttr)
+// enforceRouteDomainPolicy enforces the policy of the namespace egress rules on the route domain of the tenant
+func (c *Client) enforceRouteDomainPolicy(tenantConfig *TenantConfig) error {
+	nsRouteDomainPolicePath := getAs3UsePathForPartition(tenantConfig.Name, getAs3PolicyAttr("ns", tenantConfig.RouteDomain.Name))
+	//get route domian police
+	url := fmt.Sprintf("/mgmt/tm/net/route-domain/~%s~%s", tenantConfig.Name, tenantConfig.RouteDomain.Name)
+	response, err := c.getF5Resource(url)
+	if err != nil {
+		klog.Errorf("failed to get route domian %s, error:%v", tenantConfig.RouteDomain.Name, err)
+		return err
+	}
+	if val, ok := response[FwEnforcedPolicyKey]; ok {
+		if fwEnforcedPolicy, _ := val.(string); fwEnforcedPolicy == nsRouteDomainPolicePath {
+			return nil
+		}
+	}
+	// binding route domain policy
+	nsPolicy := map[string]string{
+		FwEnforcedPolicyKey: nsRouteDomainPolicePath,
+	}
+	if err = c.patchF5Reource(nsPolicy, url); err != nil {
+		return err
+	}
+	return c.storeDisk()
 }
 
-func (c *Client) UpdateBigIPSnatSourceAddress(addrList BigIpAddressList, tntcfg *TenantConfig, namespace, ruleName, svcName string) error {
-	srcAddressAttr := getAs3SrcAddressAttr("snat", namespace, ruleName, svcName)
-	return c.updateBigIPSourceAddress(addrList, tntcfg, srcAddressAttr)
+// getAddressListURL returns the url of the source address list of srcAddressAttr in the tenant
+func getAddressListURL(partition, srcAddressAttr string) string {
+	return fmt.Sprintf("/mgmt/tm/security/firewall/address-list/~%s~Shared~%s", partition, srcAddressAttr)
 }
 
-type syncFrequency struct {
-	updateTimes []time.Time
-	lock        sync.Mutex
+// withRouteDomainAddressList returns a copy of addrList with the route domain of the tenant suffixed, the list
+// is shared by the rules of the endpoints
+func withRouteDomainAddressList(addrList BigIpAddressList, tntcfg *TenantConfig) BigIpAddressList {
+	rdAddrList := BigIpAddressList{Addresses: make([]BigIpAddresses, 0, len(addrList.Addresses))}
+	for _, addr := range addrList.Addresses {
+		rdAddrList.Addresses = append(rdAddrList.Addresses, BigIpAddresses{
+			Name: withRouteDomain(addr.Name, tntcfg.RouteDomain.Id),
+		})
+	}
+	return rdAddrList
 }
 
-var syncFq = syncFrequency{}
-
-func (c *Client) frequency() {
-	syncFq.lock.Lock()
-	defer syncFq.lock.Unlock()
-	now := time.Now()
-	isUpdateEpFq := func() bool {
-		for _, v := range syncFq.updateTimes {
-			if now.Sub(v) > 2*60*time.Second {
-				return true
-			}
+// setAddressListMetrics sets the number of the address lists declared in the Shared application of the tenant,
+// and of their addresses
+func setAddressListMetrics(partition string, app as3Application) {
+	lists, addresses := 0, 0
+	for _, value := range app {
+		list, ok := value.(FirewallAddressList)
+		if !ok {
+			continue
 		}
-		return false
-	}
-	if len(syncFq.updateTimes) > 10 || isUpdateEpFq() {
-		err := c.storeDisk()
-		if err != nil {
-			klog.Errorf("BIG-IP store disk error: %v", err)
-			return
+		lists++
+		if !reflect.DeepEqual(list.Addresses, emptyAddressPlaceholders) {
+			addresses += len(list.Addresses)
 		}
-		syncFq.updateTimes = []time.Time{}
+		addresses += len(list.Fqdns)
 	}
-}
-
-func (c *Client) Work() {
-	go func() {
-		for {
-			c.frequency()
-			time.Sleep(30 * time.Second)
-		}
-	}()
-}
-
-func process() {
-	syncFq.lock.Lock()
-	defer syncFq.lock.Unlock()
-	syncFq.updateTimes = append(syncFq.updateTimes, time.Now())
+	metrics.TenantAddressLists.WithLabelValues(partition).Set(float64(lists))
+	metrics.TenantAddresses.WithLabelValues(partition).Set(float64(addresses))
 }
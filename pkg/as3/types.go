@@ -16,6 +16,8 @@ limitations under the License.
 
 package as3
 
+import corev1 "k8s.io/api/core/v1"
+
 // PatchItem represents a JSON patch item
 type PatchItem struct {
 	Op    string      `json:"op,omitempty"`
@@ -41,8 +43,9 @@ type FirewallPortList struct {
 
 // FirewallRuleList represents a firewall rule list
 type FirewallRuleList struct {
-	Class string         `json:"class,omitempty"`
-	Rules []FirewallRule `json:"rules,omitempty"`
+	Class  string         `json:"class,omitempty"`
+	Remark string         `json:"remark,omitempty"`
+	Rules  []FirewallRule `json:"rules,omitempty"`
 }
 
 // FirewallRule represents a firewall rule
@@ -55,6 +58,7 @@ type FirewallRule struct {
 	Source         FirewallSource `json:"source,omitempty"`
 	Action         string         `json:"action,omitempty"`
 	LoggingEnabled bool           `json:"loggingEnabled,omitempty"`
+	Schedule       *Use           `json:"schedule,omitempty"`
 }
 
 type IRule struct {
@@ -75,6 +79,16 @@ type Use struct {
 	Use string `json:"use"`
 }
 
+// FirewallSchedule restricts the firewall rules which use it to a time window
+type FirewallSchedule struct {
+	Class          string   `json:"class,omitempty"`
+	DateValidStart string   `json:"dateValidStart,omitempty"`
+	DateValidEnd   string   `json:"dateValidEnd,omitempty"`
+	DailyHourStart string   `json:"dailyHourStart,omitempty"`
+	DailyHourEnd   string   `json:"dailyHourEnd,omitempty"`
+	DaysOfWeek     []string `json:"daysOfWeek,omitempty"`
+}
+
 type FirewallPolicy struct {
 	Class string `json:"class,omitempty"`
 	Rules []Use  `json:"rules"`
@@ -130,6 +144,7 @@ type (
 		ClusterName          string         `mapstructure:"clusterName"`
 		MasterCluster        string         `mapstructure:"masterCluster"`
 		IsSupportRouteDomain bool           `mapstructure:"isSupportRouteDomain"`
+		IsSupportIPv6        bool           `mapstructure:"isSupportIPv6"`
 		IRule                []string       `mapstructure:"iRule"`
 		Tenant               []TenantConfig `mapstructure:"tenant"`
 		ExternalIPAddresses  []string       `mapstructure:"externalIPAddresses"`
@@ -152,6 +167,15 @@ type (
 		RouteDomain    RouteDomain    `mapstructure:"routeDomain"`
 		Gwpool         Gwpool         `mapstructure:"gwPool"`
 		VirtualService VirtualService `mapstructure:"virtualService"`
+		//the provider of the source addresses of the namespaces, default is kube-ovn
+		NamespaceSource NamespaceSource `mapstructure:"namespaceSource"`
+	}
+
+	NamespaceSource struct {
+		//kube-ovn, annotation, calico or pod-ip
+		Type string `mapstructure:"type"`
+		//the annotation key of the namespace cidrs for the annotation type
+		Annotation string `mapstructure:"annotation"`
 	}
 
 	RouteDomain struct {
@@ -172,9 +196,11 @@ type (
 
 	VirtualAddresses struct {
 		VirtualAddress string `mapstructure:"virtualAddress"`
-		IcmpEcho       string `mapstructure:"icmpEcho"`
-		ArpEnabled     bool   `mapstructure:"arpEnabled"`
-		template       string `mapstructure:"template"`
+		//IPv6 virtualAddress when isSupportIPv6, default is ::
+		VirtualAddressV6 string `mapstructure:"virtualAddressV6"`
+		IcmpEcho         string `mapstructure:"icmpEcho"`
+		ArpEnabled       bool   `mapstructure:"arpEnabled"`
+		template         string `mapstructure:"template"`
 	}
 )
 
@@ -188,6 +214,18 @@ type (
 	}
 )
 
+// Namespace is a namespace with the source addresses of its pods, provided by the namespace source of its
+// tenant
+type Namespace struct {
+	corev1.Namespace
+	Cidrs []string
+}
+
+// NamespaceList is a list of Namespace
+type NamespaceList struct {
+	Items []Namespace
+}
+
 // Full body request struct
 type (
 	as3JSONWithArbKeys map[string]interface{}
@@ -223,7 +261,11 @@ type (
 		namespace string
 		action    string
 		logging   bool
+		priority  uint32
+		schedule  *FirewallSchedule
 		srcAddr   []string
+		//source is selected by label, create the src address list even if nothing matches
+		srcSelected bool
 		//ep name
 		epName string
 		exsvcs []*exsvcDate
@@ -236,3 +278,10 @@ type changingRule struct {
 	patchBody PatchBody
 	value     interface{}
 }
+
+// Drift is an object of the Shared application on BIG-IP differing from the desired state, which is
+// missing, modified or unexpected on BIG-IP
+type Drift struct {
+	Path string
+	Type string
+}
@@ -3,14 +3,19 @@ package as3
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 
 	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/dns"
 	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 )
 
@@ -23,14 +28,16 @@ type as3Post struct {
 	externalServiceList *v1alpha1.ExternalServiceList
 	externalIPRuleList  *snat.ExternalIPRuleList
 	endpointList        *corev1.EndpointsList
-	namespaceList       *corev1.NamespaceList
+	podList             *corev1.PodList
+	namespaceList       *NamespaceList
 	tenantConfig        *TenantConfig
 }
 
 func newAs3Post(serviceEgressList *v1alpha1.ServiceEgressRuleList, namespaceEgressList *v1alpha1.NamespaceEgressRuleList,
 	clusterEgressList *v1alpha1.ClusterEgressRuleList, externalServiceList *v1alpha1.ExternalServiceList,
 	externalIPRuleList *snat.ExternalIPRuleList,
-	endpointList *corev1.EndpointsList, namespaceList *corev1.NamespaceList, tenantConfig *TenantConfig) *as3Post {
+	endpointList *corev1.EndpointsList, podList *corev1.PodList, namespaceList *NamespaceList,
+	tenantConfig *TenantConfig) *as3Post {
 	//init default value, make sure not nil pointer
 	ac := as3Post{
 		serviceEgressList:   &v1alpha1.ServiceEgressRuleList{},
@@ -39,7 +46,8 @@ func newAs3Post(serviceEgressList *v1alpha1.ServiceEgressRuleList, namespaceEgre
 		externalServiceList: &v1alpha1.ExternalServiceList{},
 		externalIPRuleList:  &snat.ExternalIPRuleList{},
 		endpointList:        &corev1.EndpointsList{},
-		namespaceList:       &corev1.NamespaceList{},
+		podList:             &corev1.PodList{},
+		namespaceList:       &NamespaceList{},
 		tenantConfig:        tenantConfig,
 	}
 
@@ -58,6 +66,9 @@ func newAs3Post(serviceEgressList *v1alpha1.ServiceEgressRuleList, namespaceEgre
 	if endpointList != nil {
 		ac.endpointList = endpointList
 	}
+	if podList != nil {
+		ac.podList = podList
+	}
 	if namespaceList != nil {
 		ac.namespaceList = namespaceList
 	}
@@ -160,21 +171,15 @@ func (ac *as3Post) newNatPoliciesDecl(sharedApp as3Application) {
 			newFirewallPortsList(destPortAttr, eipRule.Spec.DestinationMatch.Ports.Ports, sharedApp)
 		}
 
-		// src translation
-		srcTransAttr := getAs3NatRuleListAttr(eipRule.Namespace, eipRule.Name, "src_trans")
-		newNatSourceTranslation(srcTransAttr, eipRule.Spec.ExternalAddresses, sharedApp)
-
 		protocol := eipRule.Spec.DestinationMatch.Ports.Protocol
 		if protocol == "" {
 			protocol = "any"
 		}
 		natRule := NatRule{
-			Name:     getAs3NatRuleListAttr(eipRule.Namespace, eipRule.Name, ""),
 			Protocol: protocol,
 			Source: &Source{
 				AddressLists: make([]Use, 0, len(eipRule.Spec.Services)),
 			},
-			SourceTranslation: Use{Use: getAs3UsePathForPartition(ac.tenantConfig.Name, srcTransAttr)},
 		}
 		if destAddrAttr != "" {
 			natRule.Destination = &Destination{
@@ -219,24 +224,50 @@ func (ac *as3Post) newNatPoliciesDecl(sharedApp as3Application) {
 			})
 		}
 
-		natRules = append(natRules, natRule)
+		// src translation
+		srcTransAttr := getAs3NatRuleListAttr(eipRule.Namespace, eipRule.Name, "src_trans")
+		natRules = append(natRules, ac.newFamilyNatRules(natRule, getAs3NatRuleListAttr(eipRule.Namespace, eipRule.Name, ""),
+			srcTransAttr, eipRule.Spec.ExternalAddresses, sharedApp)...)
 	}
 
 	// 新增automap规则
 	// todo: AS3 不支持 sourceTranslation: "automap"
-	newNatSourceTranslation(defaultSnatTranslation, getExternalIPAddresses(), sharedApp)
-	natRules = append(natRules, NatRule{
-		Name:              defaultSnatRule,
-		Protocol:          "any",
-		SourceTranslation: Use{Use: getAs3UsePathForPartition(ac.tenantConfig.Name, defaultSnatTranslation)},
-	})
+	natRules = append(natRules, ac.newFamilyNatRules(NatRule{Protocol: "any"}, defaultSnatRule,
+		defaultSnatTranslation, getExternalIPAddresses(), sharedApp)...)
 	sharedApp[defaultSnatPolicy] = newNatPolicy(natRules)
 }
 
+// newFamilyNatRules returns natRule translated to the addresses of its family, a source translation
+// can not mix IPv4 and IPv6, so the IPv6 rule and translation are named with the suffix _v6
+func (ac *as3Post) newFamilyNatRules(natRule NatRule, name, srcTransAttr string, addresses []string, sharedApp as3Application) []NatRule {
+	v4, v6 := splitAddressFamily(addresses)
+	natRules := []NatRule{}
+	if len(v4) > 0 || len(v6) == 0 {
+		newNatSourceTranslation(srcTransAttr, v4, sharedApp)
+		natRule.Name = name
+		natRule.SourceTranslation = Use{Use: getAs3UsePathForPartition(ac.tenantConfig.Name, srcTransAttr)}
+		natRules = append(natRules, natRule)
+	}
+	if len(v6) > 0 {
+		newNatSourceTranslation(srcTransAttr+ipv6Suffix, v6, sharedApp)
+		natRule.Name = name + ipv6Suffix
+		natRule.SourceTranslation = Use{Use: getAs3UsePathForPartition(ac.tenantConfig.Name, srcTransAttr+ipv6Suffix)}
+		natRules = append(natRules, natRule)
+	}
+	return natRules
+}
+
 func (ac *as3Post) newPoliciesDecl(sharedApp as3Application) {
 	//create fw rule list map
 	policyMap := ac.newRulesDecl(sharedApp)
-	for tyns, ruleList := range policyMap {
+	//in order, the declaration is rendered the same from the same resources
+	keys := make([]string, 0, len(policyMap))
+	for tyns := range policyMap {
+		keys = append(keys, tyns)
+	}
+	sort.Strings(keys)
+	for _, tyns := range keys {
+		ruleList := policyMap[tyns]
 		ty, ns := strings.Split(tyns, "|")[0], strings.Split(tyns, "|")[1]
 		tntcfg := &TenantConfig{}
 		if ns == "" {
@@ -268,12 +299,19 @@ func (ac *as3Post) newRulesDecl(sharedApp as3Application) map[string][]Use {
 	*/
 	policyMap := map[string][]Use{}
 	for _, rule := range rules {
+		//app add schedule, shared by all firewall rules of the rule
+		as3ScheduleAttr := ""
+		if rule.schedule != nil && len(rule.exsvcs) != 0 {
+			as3ScheduleAttr = getAs3ScheduleAttr(rule.ty, rule.namespace, rule.name)
+			sharedApp[as3ScheduleAttr] = *rule.schedule
+		}
 		for _, evc := range rule.exsvcs {
 			fwrList := newFirewallRuleList()
+			fwrList.Remark = fmt.Sprintf("%s%d", rulePriorityRemarkPrefix, rule.priority)
 			as3SrcAddrAttr := ""
-			if rule.ty == "ns" || rule.ty == "svc" {
+			if rule.ty == "ns" || rule.ty == "svc" || rule.srcSelected {
 				//exsvc update, need not focus on
-				if len(rule.srcAddr) != 0 {
+				if len(rule.srcAddr) != 0 || rule.srcSelected {
 					//app add source address
 					as3SrcAddrAttr = getAs3SrcAddressAttr(rule.ty, rule.namespace, rule.name, rule.epName)
 					newFirewallAddressList(as3SrcAddrAttr, rule.srcAddr, sharedApp)
@@ -283,7 +321,13 @@ func (ac *as3Post) newRulesDecl(sharedApp as3Application) map[string][]Use {
 			as3DesAddrAttr := getAs3DestAddrAttr(rule.ty, rule.namespace, rule.name, evc.name)
 			newFirewallAddressList(as3DesAddrAttr, evc.destAddress, sharedApp)
 			//app add dest port
-			for key, ports := range evc.destPorts {
+			keys := make([]string, 0, len(evc.destPorts))
+			for key := range evc.destPorts {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				ports := evc.destPorts[key]
 				as3DestPortAddr := getAs3DestPortAttr(rule.ty, rule.namespace, rule.name, evc.name, key)
 				//app add port
 				if ports.protocol != "" {
@@ -291,7 +335,7 @@ func (ac *as3Post) newRulesDecl(sharedApp as3Application) map[string][]Use {
 				}
 				//rule list add rule
 				fwrList.Rules = append(fwrList.Rules, newFirewallRule(key, ports.protocol, rule.namespace, rule.action, evc.name, ports.irule,
-					as3DesAddrAttr, as3DestPortAddr, as3SrcAddrAttr, rule.logging))
+					as3DesAddrAttr, as3DestPortAddr, as3SrcAddrAttr, as3ScheduleAttr, rule.logging))
 			}
 			//app add rule list
 			ruleListAttr := getAs3RuleListAttr(rule.ty, rule.namespace, rule.name, evc.name)
@@ -330,7 +374,8 @@ func newNatPolicy(rules []NatRule) NatPolicy {
 	}
 }
 
-func newFirewallRule(fwrName, protocol, namespace, action, exsvcName, irule, destAddrAttr, destPortAttr, srcAddrAttr string, logging bool) FirewallRule {
+func newFirewallRule(fwrName, protocol, namespace, action, exsvcName, irule, destAddrAttr, destPortAttr, srcAddrAttr,
+	scheduleAttr string, logging bool) FirewallRule {
 	rule := FirewallRule{
 		Protocol: protocol,
 		Action:   action,
@@ -357,6 +402,11 @@ func newFirewallRule(fwrName, protocol, namespace, action, exsvcName, irule, des
 			Bigip: fmt.Sprintf("/Common/%s", irule),
 		}
 	}
+	if scheduleAttr != "" {
+		rule.Schedule = &Use{
+			getAs3UsePathForNamespace(namespace, scheduleAttr),
+		}
+	}
 	if srcAddrAttr != "" {
 		rule.Source = FirewallSource(FirewallDestination{
 			AddressLists: []Use{
@@ -369,6 +419,26 @@ func newFirewallRule(fwrName, protocol, namespace, action, exsvcName, irule, des
 	return rule
 }
 
+// newFirewallSchedule converts the schedule of egress rule, nil if the rule has no schedule
+func newFirewallSchedule(schedule *v1alpha1.EgressRuleSchedule) *FirewallSchedule {
+	if schedule == nil {
+		return nil
+	}
+	fs := &FirewallSchedule{
+		Class:          ClassFirewallSchedule,
+		DailyHourStart: schedule.DailyHourStart,
+		DailyHourEnd:   schedule.DailyHourEnd,
+		DaysOfWeek:     schedule.DaysOfWeek,
+	}
+	if schedule.DateValidStart != nil {
+		fs.DateValidStart = schedule.DateValidStart.UTC().Format(scheduleDateFormat)
+	}
+	if schedule.DateValidEnd != nil {
+		fs.DateValidEnd = schedule.DateValidEnd.UTC().Format(scheduleDateFormat)
+	}
+	return fs
+}
+
 func newFirewallAddressList(attr string, addresses []string, shareApp as3Application) {
 	// have domain, set fqdns
 	ips, dns := []string{}, []string{}
@@ -385,9 +455,8 @@ func newFirewallAddressList(attr string, addresses []string, shareApp as3Applica
 			ips = append(ips, addr)
 		}
 	}
-	// as3不允许addresses为nil或addresses的lenth为0。这里强制设置为1.1.1.1。
 	if len(ips) == 0 {
-		ips = []string{"1.1.1.1"}
+		ips = emptyAddressPlaceholders
 	}
 	shareApp[attr] = FirewallAddressList{
 		Class:     ClassFirewallAddressList,
@@ -463,12 +532,11 @@ func (ac *as3Post) newLogPoolDecl(sharedApp as3Application) {
 	numbers := []Member{}
 	if len(log.ServerAddresses) != 0 {
 		for _, v := range log.ServerAddresses {
-			ips := strings.Split(v, ":")
-			ip := ips[0]
-			port := 514
-			if len(ips) > 1 {
-				vs, err := strconv.Atoi(ips[1])
-				if err == nil {
+			// eg: 1.2.3.4:514, [fd00::1]:514 or a address only
+			ip, port := v, 514
+			if host, p, err := net.SplitHostPort(v); err == nil {
+				ip = host
+				if vs, err := strconv.Atoi(p); err == nil {
 					port = vs
 				}
 			}
@@ -498,7 +566,7 @@ func (ac *as3Post) newLogPoolDecl(sharedApp as3Application) {
 func (ac *as3Post) newVirtualAddressDecl(sharedApp as3Application) {
 	virtualAddress := ac.tenantConfig.VirtualService.VirtualAddresses.VirtualAddress
 	if len(virtualAddress) == 0 {
-		virtualAddress = "0.0.0.0"
+		virtualAddress = defaultVirtualAddress
 	}
 	//Enhance the ARP control ability of VS's virtualaddress
 	//virtualAddress of VA use first value if config one address in VirtualAddresses of VS
@@ -527,6 +595,35 @@ func (ac *as3Post) newVirtualAddressDecl(sharedApp as3Application) {
 		defaultVa.ArpEnabled = virtualAddresses.ArpEnabled
 	}
 	sharedApp[getAs3VsVaAttr()] = defaultVa
+
+	if IsSupportIPv6() {
+		virtualAddressV6 := ac.tenantConfig.VirtualService.VirtualAddresses.VirtualAddressV6
+		if len(virtualAddressV6) == 0 {
+			virtualAddressV6 = defaultVirtualAddressV6
+		}
+		sharedApp[getAs3VsVaV6Attr()] = &VirtualServerVa{
+			Class:          ClassServiceAddress,
+			VirtualAddress: virtualAddressV6,
+			IcmpEcho:       defaultVa.IcmpEcho,
+			ArpEnabled:     defaultVa.ArpEnabled,
+		}
+	}
+}
+
+// getVirtualAddressUses returns the virtual addresses of the outbound VS, AS3 creates a virtual
+// server for each of them
+func (ac *as3Post) getVirtualAddressUses() []Use {
+	uses := []Use{
+		{
+			getAs3UsePathForPartition(ac.tenantConfig.Name, getAs3VsVaAttr()),
+		},
+	}
+	if IsSupportIPv6() {
+		uses = append(uses, Use{
+			getAs3UsePathForPartition(ac.tenantConfig.Name, getAs3VsVaV6Attr()),
+		})
+	}
+	return uses
 }
 
 // Create AS3 Service for Route
@@ -552,11 +649,7 @@ func (ac *as3Post) newServiceDecl(sharedApp as3Application) {
 			if !enableSecurityLog {
 				delete(vs, "securityLogProfiles")
 			}
-			vs["virtualAddresses"] = []Use{
-				{
-					getAs3UsePathForPartition(ac.tenantConfig.Name, getAs3VsVaAttr()),
-				},
-			}
+			vs["virtualAddresses"] = ac.getVirtualAddressUses()
 			sharedApp[getAs3VSAttr()] = vs
 			return
 		}
@@ -566,11 +659,7 @@ func (ac *as3Post) newServiceDecl(sharedApp as3Application) {
 		Layer4:                 "any",
 		TranslateServerAddress: false,
 		TranslateServerPort:    false,
-		VirtualAddresses: []Use{
-			{
-				getAs3UsePathForPartition(ac.tenantConfig.Name, getAs3VsVaAttr()),
-			},
-		},
+		VirtualAddresses:       ac.getVirtualAddressUses(),
 		PolicyFirewallEnforced: Use{
 			svcPolicyPath,
 		},
@@ -689,17 +778,19 @@ func (ac *as3Post) dealRule() []ruleData {
 		//clusteregress
 		for _, clsRule := range ac.clusterEgressList.Items {
 			rule := ruleData{
-				ty:      "global",
-				name:    clsRule.Name,
-				action:  clsRule.Spec.Action,
-				logging: clsRule.Spec.Logging,
+				ty:       "global",
+				name:     clsRule.Name,
+				action:   clsRule.Spec.Action,
+				logging:  clsRule.Spec.Logging,
+				priority: getRulePriority(clsRule.Spec.Priority),
+				schedule: newFirewallSchedule(clsRule.Spec.Schedule),
 			}
-			for _, clsExSvcName := range clsRule.Spec.ExternalServices {
-				for _, exsvc := range ac.externalServiceList.Items {
-					if clsExSvcName == exsvc.Name && exsvc.Namespace == GetClusterSvcExtNamespace() {
-						rule.exsvcs = append(rule.exsvcs, dealExsvc(exsvc))
-					}
-				}
+			rule.exsvcs = ac.dealRuleExsvcs(GetClusterSvcExtNamespace(), clsRule.Spec.ExternalServices,
+				clsRule.Spec.ExternalServiceSelector)
+			if clsRule.Spec.NamespaceSelector != nil {
+				//scope to the selected namespaces, keep the source list even if nothing matches
+				rule.srcSelected = true
+				rule.srcAddr = getNamespaceAddresses(ac.namespaceList.Items, clsRule.Spec.NamespaceSelector)
 			}
 			rules = append(rules, rule)
 		}
@@ -713,17 +804,13 @@ func (ac *as3Post) dealRule() []ruleData {
 			namespace: nsRule.Namespace,
 			action:    nsRule.Spec.Action,
 			logging:   nsRule.Spec.Logging,
+			priority:  getRulePriority(nsRule.Spec.Priority),
+			schedule:  newFirewallSchedule(nsRule.Spec.Schedule),
 		}
-		for _, clsExSvcName := range nsRule.Spec.ExternalServices {
-			for _, exsvc := range ac.externalServiceList.Items {
-				if clsExSvcName == exsvc.Name && exsvc.Namespace == nsRule.Namespace {
-					rule.exsvcs = append(rule.exsvcs, dealExsvc(exsvc))
-				}
-			}
-		}
+		rule.exsvcs = ac.dealRuleExsvcs(nsRule.Namespace, nsRule.Spec.ExternalServices, nsRule.Spec.ExternalServiceSelector)
 		for _, ns := range ac.namespaceList.Items {
 			if ns.Name == nsRule.Namespace {
-				rule.srcAddr = []string{ns.Annotations[NamespaceCidr]}
+				rule.srcAddr = ns.Cidrs
 			}
 		}
 		rules = append(rules, rule)
@@ -736,13 +823,16 @@ func (ac *as3Post) dealRule() []ruleData {
 			namespace: svcRule.Namespace,
 			action:    svcRule.Spec.Action,
 			logging:   svcRule.Spec.Logging,
+			priority:  getRulePriority(svcRule.Spec.Priority),
+			schedule:  newFirewallSchedule(svcRule.Spec.Schedule),
 		}
-		for _, clsExSvcName := range svcRule.Spec.ExternalServices {
-			for _, exsvc := range ac.externalServiceList.Items {
-				if clsExSvcName == exsvc.Name && exsvc.Namespace == svcRule.Namespace {
-					rule.exsvcs = append(rule.exsvcs, dealExsvc(exsvc))
-				}
-			}
+		rule.exsvcs = ac.dealRuleExsvcs(svcRule.Namespace, svcRule.Spec.ExternalServices, svcRule.Spec.ExternalServiceSelector)
+		if svcRule.Spec.PodSelector != nil {
+			//pods selected by label, keep the source list even if no pod is running
+			rule.srcSelected = true
+			rule.srcAddr = getPodAddresses(ac.podList.Items, svcRule.Namespace, svcRule.Spec.PodSelector)
+			rules = append(rules, rule)
+			continue
 		}
 		for _, ep := range ac.endpointList.Items {
 			if ep.Namespace == svcRule.Namespace && ep.Name == svcRule.Spec.Service {
@@ -759,10 +849,275 @@ func (ac *as3Post) dealRule() []ruleData {
 	return rules
 }
 
+// getPodAddresses returns the ips of the running pods in namespace matched by selector
+func getPodAddresses(pods []corev1.Pod, namespace string, selector *metav1.LabelSelector) []string {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		klog.Errorf("invalid pod selector %v: %v", selector, err)
+		return nil
+	}
+	addrs := []string{}
+	for _, pod := range pods {
+		if pod.Namespace != namespace || !sel.Matches(labels.Set(pod.Labels)) {
+			continue
+		}
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		// dual stack pods have an ip of each family
+		if len(pod.Status.PodIPs) == 0 {
+			addrs = append(addrs, pod.Status.PodIP)
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			addrs = append(addrs, podIP.IP)
+		}
+	}
+	return addrs
+}
+
+// dealRuleExsvcs returns the external services in namespace referenced by egress rule names or selector
+func (ac *as3Post) dealRuleExsvcs(namespace string, names []string, selector *metav1.LabelSelector) []*exsvcDate {
+	exsvcs := []*exsvcDate{}
+	for _, exsvc := range ac.externalServiceList.Items {
+		if exsvc.Namespace == namespace && MatchExternalService(names, selector, &exsvc) {
+			exsvcs = append(exsvcs, dealExsvc(exsvc))
+		}
+	}
+	return exsvcs
+}
+
+// MatchExternalService returns whether egress rule references exsvc by names or externalServiceSelector,
+// the namespace of exsvc is not checked
+func MatchExternalService(names []string, selector *metav1.LabelSelector, exsvc *v1alpha1.ExternalService) bool {
+	for _, name := range names {
+		if name == exsvc.Name {
+			return true
+		}
+	}
+	if selector == nil {
+		return false
+	}
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		klog.Errorf("invalid external service selector %v: %v", selector, err)
+		return false
+	}
+	return sel.Matches(labels.Set(exsvc.Labels))
+}
+
+// getObjectPaths returns the paths of the objects in app declared for the egress rules and external ip
+// rules of the request, the objects of a resource are named with its prefix
+func (ac *as3Post) getObjectPaths(app as3Application) []string {
+	prefixes := []string{}
+	if ac.tenantConfig.Name == DefaultPartition {
+		for _, clsRule := range ac.clusterEgressList.Items {
+			prefixes = append(prefixes, getAs3ObjectPrefix("global", "", clsRule.Name))
+		}
+	}
+	for _, nsRule := range ac.namespaceEgressList.Items {
+		prefixes = append(prefixes, getAs3ObjectPrefix("ns", nsRule.Namespace, nsRule.Name))
+	}
+	for _, svcRule := range ac.serviceEgressList.Items {
+		prefixes = append(prefixes, getAs3ObjectPrefix("svc", svcRule.Namespace, svcRule.Name))
+	}
+	for _, eipRule := range ac.externalIPRuleList.Items {
+		prefixes = append(prefixes, getAs3NatRuleListAttr(eipRule.Namespace, eipRule.Name, ""))
+	}
+	paths := []string{}
+	for attr := range app {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(attr, prefix+"_") {
+				paths = append(paths, getAs3UsePathForPartition(ac.tenantConfig.Name, attr))
+				break
+			}
+		}
+	}
+	//nat rules are named in the nat policy
+	if natPolicy, ok := app[defaultSnatPolicy].(NatPolicy); ok {
+		for _, rule := range natPolicy.Rules {
+			for _, eipRule := range ac.externalIPRuleList.Items {
+				name := getAs3NatRuleListAttr(eipRule.Namespace, eipRule.Name, "")
+				if rule.Name == name || rule.Name == name+ipv6Suffix {
+					paths = append(paths, getAs3UsePathForPartition(ac.tenantConfig.Name, defaultSnatPolicy)+"/"+rule.Name)
+					break
+				}
+			}
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// GetObjectPaths returns the paths of the objects declared in the tenant for the egress rules and external ip
+// rules of the lists, they are rendered without the other resources of the tenant
+func GetObjectPaths(serviceEgressList *v1alpha1.ServiceEgressRuleList, namespaceEgressList *v1alpha1.NamespaceEgressRuleList,
+	clusterEgressList *v1alpha1.ClusterEgressRuleList, externalServiceList *v1alpha1.ExternalServiceList,
+	externalIPRuleList *snat.ExternalIPRuleList,
+	endpointList *corev1.EndpointsList, podList *corev1.PodList, namespaceList *NamespaceList,
+	tenantConfig *TenantConfig) []string {
+	ac := newAs3Post(serviceEgressList, namespaceEgressList, clusterEgressList, externalServiceList, externalIPRuleList,
+		endpointList, podList, namespaceList, tenantConfig)
+	adc := as3ADC{}
+	ac.generateAS3ResourceDeclaration(adc)
+	return ac.getObjectPaths(adc.getAS3SharedApp(tenantConfig.Name))
+}
+
+// deleteObjectPaths removes the objects of paths in partition from srcApp, with the references of
+// them in firewall and nat policies, and returns whether srcApp is changed
+func deleteObjectPaths(partition string, srcApp map[string]interface{}, paths []string) bool {
+	removed, natRules := map[string]bool{}, map[string]bool{}
+	for _, path := range paths {
+		k := strings.Split(path, "/")
+		if len(k) < 4 || k[1] != partition {
+			continue
+		}
+		attr := k[3]
+		if attr == defaultSnatPolicy && len(k) == 5 {
+			natRules[k[4]] = true
+			continue
+		}
+		if _, ok := srcApp[attr]; !ok || skipDeleteShareApplicationClassOrAttr(partition, attr) {
+			continue
+		}
+		delete(srcApp, attr)
+		removed[attr] = true
+	}
+	removePolicyRules(srcApp, removed)
+
+	if value, ok := srcApp[defaultSnatPolicy]; ok && len(natRules) != 0 {
+		natPolicy := NatPolicy{}
+		if data, err := json.Marshal(value); err == nil && json.Unmarshal(data, &natPolicy) == nil {
+			rules := []NatRule{}
+			for _, rule := range natPolicy.Rules {
+				if !natRules[rule.Name] {
+					rules = append(rules, rule)
+				}
+			}
+			if len(rules) != len(natPolicy.Rules) {
+				natPolicy.Rules = rules
+				srcApp[defaultSnatPolicy] = natPolicy
+				removed[defaultSnatPolicy] = true
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return false
+	}
+	clearUpUnreferencePolicy(srcApp)
+	return true
+}
+
+// GetExternalServiceObjectPaths returns the paths of the objects declared for exsvc by an egress rule,
+// ty is global, ns or svc
+func GetExternalServiceObjectPaths(ty, namespace, ruleName string, exsvc v1alpha1.ExternalService) []string {
+	if ty == "global" {
+		namespace = ""
+	}
+	if namespace != "" && GetTenantConfigForNamespace(namespace) == nil {
+		return nil
+	}
+	attrs := []string{
+		getAs3RuleListAttr(ty, namespace, ruleName, exsvc.Name),
+		getAs3DestAddrAttr(ty, namespace, ruleName, exsvc.Name),
+	}
+	for key, ports := range dealExsvc(exsvc).destPorts {
+		if ports.protocol != "" {
+			attrs = append(attrs, getAs3DestPortAttr(ty, namespace, ruleName, exsvc.Name, key))
+		}
+	}
+	paths := []string{}
+	for _, attr := range attrs {
+		paths = append(paths, getAs3UsePathForNamespace(namespace, attr))
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// getNamespaceAddresses returns the cidrs of the namespaces matched by selector
+func getNamespaceAddresses(namespaces []Namespace, selector *metav1.LabelSelector) []string {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		klog.Errorf("invalid namespace selector %v: %v", selector, err)
+		return nil
+	}
+	addrs := []string{}
+	for _, ns := range namespaces {
+		if !sel.Matches(labels.Set(ns.Labels)) {
+			continue
+		}
+		addrs = append(addrs, ns.Cidrs...)
+	}
+	return addrs
+}
+
+// SplitNamespaceCidr returns the cidrs of the namespace cidr annotation, a dual stack namespace
+// has a cidr of each family
+func SplitNamespaceCidr(cidr string) []string {
+	cidrs := []string{}
+	for _, c := range strings.Split(cidr, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cidrs = append(cidrs, c)
+		}
+	}
+	return cidrs
+}
+
+// isIPv6Address returns whether addr is IPv6, addr is an ip, cidr or range, eg: 10.1.1.1-10.1.1.9
+func isIPv6Address(addr string) bool {
+	addr = strings.SplitN(addr, "-", 2)[0]
+	if ip, _, err := net.ParseCIDR(addr); err == nil {
+		return ip.To4() == nil
+	}
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.To4() == nil
+}
+
+// splitAddressFamily splits addresses into IPv4 and IPv6 ones
+func splitAddressFamily(addresses []string) (v4, v6 []string) {
+	v4, v6 = []string{}, []string{}
+	for _, addr := range addresses {
+		if isIPv6Address(addr) {
+			v6 = append(v6, addr)
+		} else {
+			v4 = append(v4, addr)
+		}
+	}
+	return v4, v6
+}
+
+// withRouteDomain appends the route domain id to the ip of addr, eg: 10.16.0.2%2, 10.16.0.0%2/16, fd00::2%2
+func withRouteDomain(addr string, id int) string {
+	if id == 0 {
+		return addr
+	}
+	if i := strings.Index(addr, "/"); i >= 0 {
+		return fmt.Sprintf("%s%%%d%s", addr[:i], id, addr[i:])
+	}
+	return fmt.Sprintf("%s%%%d", addr, id)
+}
+
+// getExsvcDestAddresses returns the destination addresses of the external service, fqdns are
+// left to AFM unless they are resolved by the controller
+func getExsvcDestAddresses(exsvc v1alpha1.ExternalService) []string {
+	addrs := append([]string{}, exsvc.Spec.Addresses...)
+	resolved := exsvc.Spec.DNSResolution == v1alpha1.DNSResolutionController
+	for _, fqdn := range exsvc.Spec.FQDNs {
+		// wildcard can not be resolved
+		if resolved && !dns.IsWildcard(fqdn) {
+			continue
+		}
+		addrs = append(addrs, fqdn)
+	}
+	if resolved {
+		addrs = append(addrs, exsvc.Status.ResolvedAddresses...)
+	}
+	return addrs
+}
+
 func dealExsvc(exsvc v1alpha1.ExternalService) *exsvcDate {
 	sv := &exsvcDate{
 		name:        exsvc.Name,
-		destAddress: exsvc.Spec.Addresses,
+		destAddress: getExsvcDestAddresses(exsvc),
 	}
 	ptlMap := make(map[string]portIrule)
 	for _, pt := range exsvc.Spec.Ports {
@@ -822,14 +1177,29 @@ func getAs3DestAddrAttr(ty, namespace, ruleName, exsvcName string) string {
 func getAs3SrcAddressAttr(ty, namespace, ruleName, endpointName string) string {
 	ty_ns := ty + "_" + namespace
 	if ty == "global" {
-		return ""
+		//global rule scoped by namespace selector
+		return fmt.Sprintf("%s_%s_%s_src_address", GetCluster(), ty, ruleName)
 	}
-	if ty == "ns" {
+	//ns rule, or svc rule whose source pods are selected by label
+	if ty == "ns" || endpointName == "" {
 		return fmt.Sprintf("%s_%s_%s_src_address", GetCluster(), ty_ns, ruleName)
 	}
 	return fmt.Sprintf("%s_%s_%s_ep_%s_src_address", GetCluster(), ty_ns, ruleName, endpointName)
 }
 
+func getAs3ScheduleAttr(ty, namespace, ruleName string) string {
+	ty_ns := ty + "_" + namespace
+	if ty == "global" {
+		ty_ns = ty
+	}
+	return fmt.Sprintf("%s_%s_%s_schedule", GetCluster(), ty_ns, ruleName)
+}
+
+// getAs3ObjectPrefix returns the prefix shared by the objects of a rule
+func getAs3ObjectPrefix(ty, namespace, ruleName string) string {
+	return strings.TrimSuffix(getAs3ScheduleAttr(ty, namespace, ruleName), "_schedule")
+}
+
 func getAs3RuleListAttr(ty, namespace, ruleName, exsvcName string) string {
 	ty_ns := ty + "_" + namespace
 	if ty == "global" {
@@ -873,6 +1243,10 @@ func getAs3VsVaAttr() string {
 	return fmt.Sprintf("%s_outbound_va", getMasterCluster())
 }
 
+func getAs3VsVaV6Attr() string {
+	return getAs3VsVaAttr() + ipv6Suffix
+}
+
 func getExternalIPAddresses() []string {
 	return getValue(externalIPAddressesKey).([]string)
 }
@@ -1062,23 +1436,89 @@ func policyPatchJson(src, delta interface{}, path string, patchBody PatchBody, i
 	})
 }
 
-func fullResource(partition string, isDelete bool, srcAdc, deltaAdc as3ADC) interface{} {
+// reconcileResource returns the declaration of partition with the Shared application rendered in desiredAdc,
+// the objects of this cluster which are not rendered are removed from srcAdc and the ones of the other clusters
+// sharing the partition are kept, nil is returned if srcAdc is already as desired
+func reconcileResource(partition string, srcAdc, desiredAdc as3ADC) interface{} {
 	src := srcAdc.getAS3SharedApp(partition)
-	delta := deltaAdc.getAS3SharedApp(partition)
-	if src == nil && !isDelete {
-		return newAs3Obj(partition, delta)
+	desired := desiredAdc.getAS3SharedApp(partition)
+	if src == nil {
+		sortFirewallPolicies(desired)
+		return newAs3Obj(partition, desired)
 	}
-	//originApp: save old as3
-	originApp, srcApp, deltaApp := map[string]interface{}{}, map[string]interface{}{}, map[string]interface{}{}
-	if err := validateJSONAndFetchObject(src, &originApp); err != nil {
+	originApp, reconciledApp := reconcileSharedApp(partition, src, desired)
+	if reconciledApp == nil {
 		return nil
 	}
-	if err := validateJSONAndFetchObject(src, &srcApp); err != nil {
+	if !isDiff(originApp, reconciledApp) && !isDiff(reconciledApp, originApp) {
 		return nil
 	}
-	if err := validateJSONAndFetchObject(delta, &deltaApp); err != nil {
-		return srcAdc
+	return newAs3Obj(partition, reconciledApp)
+}
+
+// reconcileSharedApp returns the Shared application src of partition as it is on BIG-IP, and the one reconciled to desired
+func reconcileSharedApp(partition string, src, desired as3Application) (map[string]interface{}, map[string]interface{}) {
+	originApp, srcApp, desiredApp := map[string]interface{}{}, map[string]interface{}{}, map[string]interface{}{}
+	if err := validateJSONAndFetchObject(src, &originApp); err != nil {
+		return nil, nil
 	}
+	if err := validateJSONAndFetchObject(src, &srcApp); err != nil {
+		return nil, nil
+	}
+	if err := validateJSONAndFetchObject(desired, &desiredApp); err != nil {
+		return nil, nil
+	}
+	pruneClusterObjects(srcApp, desiredApp)
+	//the pruned policies are typed, merge into them as they are on BIG-IP
+	reconciledApp := map[string]interface{}{}
+	if err := validateJSONAndFetchObject(srcApp, &reconciledApp); err != nil {
+		return nil, nil
+	}
+	mergeSharedApp(partition, false, reconciledApp, desiredApp)
+	//the nat policy is typed to keep the objects referenced by it
+	if natPolicy, ok := reconciledApp[defaultSnatPolicy].(map[string]interface{}); ok {
+		reconciledApp[defaultSnatPolicy] = natPolicyMergeFullJson(natPolicy, NatPolicy{}, false)
+	}
+	sortFirewallPolicies(reconciledApp)
+	clearUpUnreferencePolicy(reconciledApp)
+	//normalize the typed objects to compare with BIG-IP
+	normalizedApp := map[string]interface{}{}
+	if err := validateJSONAndFetchObject(reconciledApp, &normalizedApp); err != nil {
+		return nil, nil
+	}
+	return originApp, normalizedApp
+}
+
+// getDrifts returns the objects of originApp on BIG-IP of partition drifting from reconciledApp, sorted by path
+func getDrifts(partition string, originApp, reconciledApp map[string]interface{}) []Drift {
+	drifts := []Drift{}
+	for attr, value := range reconciledApp {
+		if _, ok := value.(map[string]interface{}); !ok {
+			continue
+		}
+		origin, ok := originApp[attr]
+		if !ok {
+			drifts = append(drifts, Drift{Path: getAs3UsePathForPartition(partition, attr), Type: DriftMissing})
+		} else if !reflect.DeepEqual(origin, value) {
+			drifts = append(drifts, Drift{Path: getAs3UsePathForPartition(partition, attr), Type: DriftModified})
+		}
+	}
+	for attr, value := range originApp {
+		if _, ok := value.(map[string]interface{}); !ok {
+			continue
+		}
+		if _, ok := reconciledApp[attr]; !ok {
+			drifts = append(drifts, Drift{Path: getAs3UsePathForPartition(partition, attr), Type: DriftUnexpected})
+		}
+	}
+	sort.Slice(drifts, func(i, j int) bool {
+		return drifts[i].Path < drifts[j].Path
+	})
+	return drifts
+}
+
+// mergeSharedApp merges the objects of deltaApp into srcApp, or removes them from srcApp if isDelete
+func mergeSharedApp(partition string, isDelete bool, srcApp, deltaApp map[string]interface{}) {
 	for deltaKey, deltaValue := range deltaApp {
 		if srcValue, ok := srcApp[deltaKey]; ok {
 			switch deltaKey {
@@ -1086,7 +1526,7 @@ func fullResource(partition string, isDelete bool, srcAdc, deltaAdc as3ADC) inte
 				// 不用考虑删除
 				srcApp[deltaKey] = natPolicyMergeFullJson(srcValue, deltaValue, isDelete)
 				continue
-			case defaultSnatTranslation:
+			case defaultSnatTranslation, defaultSnatTranslation + ipv6Suffix:
 				// 不用考虑删除
 				srcApp[deltaKey] = srcValue
 				continue
@@ -1119,11 +1559,67 @@ func fullResource(partition string, isDelete bool, srcAdc, deltaAdc as3ADC) inte
 			}
 		}
 	}
-	clearUpUnreferencePolicy(srcApp)
-	if !isDiff(originApp, srcApp) && !isDelete {
-		return nil
+}
+
+// pruneClusterObjects removes the objects and nat rules of this cluster in srcApp which are not in desiredApp,
+// with the references of them in firewall policies
+func pruneClusterObjects(srcApp, desiredApp map[string]interface{}) {
+	removed := map[string]bool{}
+	for key, value := range srcApp {
+		if _, ok := desiredApp[key]; ok || !isClusterObject(key, value) {
+			continue
+		}
+		delete(srcApp, key)
+		removed[key] = true
+	}
+	removePolicyRules(srcApp, removed)
+
+	value, ok := srcApp[defaultSnatPolicy]
+	if !ok {
+		return
+	}
+	srcPolicy, desiredPolicy := NatPolicy{}, NatPolicy{}
+	if data, err := json.Marshal(value); err != nil || json.Unmarshal(data, &srcPolicy) != nil {
+		return
+	}
+	if data, err := json.Marshal(desiredApp[defaultSnatPolicy]); err == nil {
+		json.Unmarshal(data, &desiredPolicy)
+	}
+	desiredRules := map[string]bool{}
+	for _, rule := range desiredPolicy.Rules {
+		desiredRules[rule.Name] = true
+	}
+	rules := []NatRule{}
+	for _, rule := range srcPolicy.Rules {
+		if desiredRules[rule.Name] || !isClusterObject(rule.Name, nil) {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) != len(srcPolicy.Rules) {
+		srcPolicy.Rules = rules
+		srcApp[defaultSnatPolicy] = srcPolicy
 	}
-	return newAs3Obj(partition, srcApp)
+}
+
+// isClusterObject returns whether the object of attr, or the nat rule named attr if value is nil, is declared for a
+// resource of this cluster, the policies and the objects shared by the clusters are not
+func isClusterObject(attr string, value interface{}) bool {
+	if strings.HasPrefix(attr, defaultSnatRule) || strings.HasPrefix(attr, defaultSnatTranslation) ||
+		attr == defaultSnatPolicy || attr == getAllDenyRuleListAttr() {
+		return false
+	}
+	if value != nil {
+		obj, ok := value.(map[string]interface{})
+		if !ok || obj[ClassKey] == ClassFirewallPolicy {
+			return false
+		}
+	}
+	for _, ty := range []string{"global", "ns", "svc", "snat"} {
+		if strings.HasPrefix(attr, fmt.Sprintf("%s_%s_", GetCluster(), ty)) {
+			return true
+		}
+	}
+	return false
 }
 
 func natPolicyMergeFullJson(src, delta interface{}, isDelete bool) interface{} {
@@ -1145,6 +1641,22 @@ func natPolicyMergeFullJson(src, delta interface{}, isDelete bool) interface{} {
 		return src
 	}
 
+	// a rule translated to a single family now, drop the rule of the other family
+	if !isDelete {
+		deltaNames := map[string]bool{}
+		for _, deltaRule := range deltaPolicy.Rules {
+			deltaNames[deltaRule.Name] = true
+		}
+		for i := len(srcPolicy.Rules) - 1; i >= 0; i-- {
+			name := srcPolicy.Rules[i].Name
+			base := strings.TrimSuffix(name, ipv6Suffix)
+			if deltaNames[name] || !(deltaNames[base] || deltaNames[base+ipv6Suffix]) {
+				continue
+			}
+			srcPolicy.Rules = append(srcPolicy.Rules[:i], srcPolicy.Rules[i+1:]...)
+		}
+	}
+
 	for _, deltaRule := range deltaPolicy.Rules {
 		isExist := false
 		for i := len(srcPolicy.Rules) - 1; i >= 0; i-- {
@@ -1153,7 +1665,7 @@ func natPolicyMergeFullJson(src, delta interface{}, isDelete bool) interface{} {
 				isExist = true
 
 				// 跳过automap
-				if srcRule.Name == defaultSnatRule {
+				if strings.HasPrefix(srcRule.Name, defaultSnatRule) {
 					srcPolicy.Rules[i] = deltaRule
 					continue
 				}
@@ -1174,14 +1686,11 @@ func natPolicyMergeFullJson(src, delta interface{}, isDelete bool) interface{} {
 
 	// todo: rule排序
 
-	//automap needs to be at the end
-	last := len(srcPolicy.Rules) - 1
-	for i := last; i >= 0; i-- {
-		if strings.Contains(srcPolicy.Rules[i].Name, defaultSnatRule) {
-			srcPolicy.Rules[i], srcPolicy.Rules[last] = srcPolicy.Rules[last], srcPolicy.Rules[i]
-			break
-		}
-	}
+	//automap of both families needs to be at the end
+	sort.SliceStable(srcPolicy.Rules, func(i, j int) bool {
+		return !strings.Contains(srcPolicy.Rules[i].Name, defaultSnatRule) &&
+			strings.Contains(srcPolicy.Rules[j].Name, defaultSnatRule)
+	})
 
 	return srcPolicy
 }
@@ -1224,17 +1733,112 @@ func policyMergeFullJson(src, delta interface{}, isDelete bool) interface{} {
 			srcPolicy.Rules = append(srcPolicy.Rules, deltaRule)
 		}
 	}
-	//deny all needs to be at the end
-	last := len(srcPolicy.Rules) - 1
-	for i := last; i >= 0; i-- {
-		if strings.Contains(srcPolicy.Rules[i].Use, getAllDenyRuleListAttr()) {
-			denyAllRule := srcPolicy.Rules[i].Use
-			srcPolicy.Rules[i].Use = srcPolicy.Rules[last].Use
-			srcPolicy.Rules[last].Use = denyAllRule
-			break
+	//order by priority and deny all at the end, see sortFirewallPolicies
+	return srcPolicy
+}
+
+// removePolicyRules removes the references of the removed rule lists from the firewall policies in app
+func removePolicyRules(srcApp map[string]interface{}, removed map[string]bool) {
+	if len(removed) == 0 {
+		return
+	}
+	for key, value := range srcApp {
+		policy := FirewallPolicy{}
+		switch v := value.(type) {
+		case FirewallPolicy:
+			policy = v
+		case map[string]interface{}:
+			if v[ClassKey] != ClassFirewallPolicy {
+				continue
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			if err = json.Unmarshal(data, &policy); err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+		rules := []Use{}
+		for _, rule := range policy.Rules {
+			if !removed[getOriginAttrOfUsePath(rule.Use)] {
+				rules = append(rules, rule)
+			}
 		}
+		policy.Rules = rules
+		srcApp[key] = policy
 	}
-	return srcPolicy
+}
+
+// sortFirewallPolicies orders the rule lists of every firewall policy in app by priority,
+// rule lists with the same priority keep their order and deny all is always the last one
+func sortFirewallPolicies(app map[string]interface{}) {
+	for key, value := range app {
+		policy := FirewallPolicy{}
+		switch v := value.(type) {
+		case FirewallPolicy:
+			policy = v
+		case map[string]interface{}:
+			if v[ClassKey] != ClassFirewallPolicy {
+				continue
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			if err = json.Unmarshal(data, &policy); err != nil {
+				continue
+			}
+		default:
+			continue
+		}
+		priorities := make(map[string]uint64, len(policy.Rules))
+		for _, rule := range policy.Rules {
+			priorities[rule.Use] = getRuleListPriority(app, rule.Use)
+		}
+		//the rules of the same priority are ordered by their rule lists, so the policy is rendered the same
+		//whatever order they are merged in, and deny all stays the last
+		sort.Slice(policy.Rules, func(i, j int) bool {
+			pi, pj := priorities[policy.Rules[i].Use], priorities[policy.Rules[j].Use]
+			if pi != pj {
+				return pi < pj
+			}
+			return policy.Rules[i].Use < policy.Rules[j].Use
+		})
+		app[key] = policy
+	}
+}
+
+// getRuleListPriority returns the priority recorded in the remark of the rule list referenced by use
+func getRuleListPriority(app map[string]interface{}, use string) uint64 {
+	if strings.Contains(use, getAllDenyRuleListAttr()) {
+		return math.MaxUint64
+	}
+	ruleList := FirewallRuleList{}
+	data, err := json.Marshal(app[getOriginAttrOfUsePath(use)])
+	if err != nil {
+		return DefaultRulePriority
+	}
+	if err = json.Unmarshal(data, &ruleList); err != nil {
+		return DefaultRulePriority
+	}
+	if !strings.HasPrefix(ruleList.Remark, rulePriorityRemarkPrefix) {
+		return DefaultRulePriority
+	}
+	priority, err := strconv.ParseUint(strings.TrimPrefix(ruleList.Remark, rulePriorityRemarkPrefix), 10, 32)
+	if err != nil {
+		return DefaultRulePriority
+	}
+	return priority
+}
+
+func getRulePriority(priority uint32) uint32 {
+	if priority == 0 {
+		return DefaultRulePriority
+	}
+	return priority
 }
 
 func clearUpUnreferencePolicy(shareApp map[string]interface{}) {
@@ -1310,8 +1914,14 @@ func clearUpUnreferencePolicy(shareApp map[string]interface{}) {
 						}
 					}
 				}
+				//schedule
+				if schedule, ok := rule.(map[string]interface{})["schedule"].(map[string]interface{}); ok {
+					if use, ok := schedule["use"].(string); ok {
+						flag1[getOriginAttrOfUsePath(use)] = true
+					}
+				}
 			}
-		case ClassFirewallAddressList, ClassFirewallPortList, ClassNatPolicy:
+		case ClassFirewallAddressList, ClassFirewallPortList, ClassNatPolicy, ClassFirewallSchedule:
 			flag2[key] = true
 		case ClassSecurityLogProfile, ClassLogPublisher:
 			if !isConfigLogProfile() {
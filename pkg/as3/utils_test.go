@@ -5,7 +5,9 @@ import (
 	"flag"
 	"fmt"
 	"k8s.io/klog/v2"
+	"reflect"
 	"testing"
+	"time"
 
 	kubeovnv1alpha1 "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
 	corev1 "k8s.io/api/core/v1"
@@ -1937,14 +1939,13 @@ func TestMockClusteEgressRule(t *testing.T) {
 	initTenantConfig(as3cfg, "kube-system")
 	tntcfg := GetTenantConfigForParttition(DefaultPartition)
 
-	as3post := newAs3Post(nil, nil, &clusterEgressList, &externalServiceList, nil, nil, nil, tntcfg)
+	as3post := newAs3Post(nil, nil, &clusterEgressList, &externalServiceList, nil, nil, nil, nil, tntcfg)
 	as3 := initDefaultAS3()
 	printObj(as3)
 	srcAdc := as3[DeclarationKey].(as3ADC)
 	adc := as3ADC{}
 	as3post.generateAS3ResourceDeclaration(adc)
-	body := fullResource(DefaultPartition, false, srcAdc, adc)
-	printObj(body)
+	srcAdc = reconcileMockResource(t, DefaultPartition, srcAdc, adc)
 
 	//add the same clusteregressrule at above as3
 	clusterEgressList = kubeovnv1alpha1.ClusterEgressRuleList{
@@ -2007,21 +2008,15 @@ func TestMockClusteEgressRule(t *testing.T) {
 			},
 		},
 	}
-	as3post = newAs3Post(nil, nil, &clusterEgressList, &externalServiceList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(nil, nil, &clusterEgressList, &externalServiceList, nil, nil, nil, nil, tntcfg)
 	deltaAdc := as3ADC{}
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
 
-	var srcAs3 map[string]interface{}
-	err := validateJSONAndFetchObject(body, &srcAs3)
-	if err != nil {
-		t.Error(err)
+	if body := reconcileResource(DefaultPartition, srcAdc, deltaAdc); body != nil {
+		t.Errorf("the same clusteregressrule is declared, nothing should be declared")
 	}
-	srcAdc = as3ADC(srcAs3[DeclarationKey].(map[string]interface{}))
-	body = fullResource(DefaultPartition, false, srcAdc, deltaAdc)
 
-	printObj(body)
-
-	//add diff clusteregressrule
+	//replace with diff clusteregressrule
 	clusterEgressList = kubeovnv1alpha1.ClusterEgressRuleList{
 		Items: []kubeovnv1alpha1.ClusterEgressRule{
 			{
@@ -2063,38 +2058,40 @@ func TestMockClusteEgressRule(t *testing.T) {
 			},
 		},
 	}
-	as3post = newAs3Post(nil, nil, &clusterEgressList, &externalServiceList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(nil, nil, &clusterEgressList, &externalServiceList, nil, nil, nil, nil, tntcfg)
 	deltaAdc = as3ADC{}
-	srcAs3 = map[string]interface{}{}
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
-	err = validateJSONAndFetchObject(body, &srcAs3)
-	if err != nil {
-		t.Error(err)
+	srcAdc = reconcileMockResource(t, DefaultPartition, srcAdc, deltaAdc)
+	app := srcAdc.getAS3SharedApp(DefaultPartition)
+	if _, ok := app[getAs3RuleListAttr("global", "", "test", "exsvc-test1")]; ok {
+		t.Errorf("the rule list of the replaced clusteregressrule should be deleted")
 	}
-	srcAdc = as3ADC(srcAs3[DeclarationKey].(map[string]interface{}))
-	body = fullResource(DefaultPartition, false, srcAdc, deltaAdc)
-	printObj(body)
-
-	//delete clusteregressrule
-	srcAs3 = map[string]interface{}{}
-	err = validateJSONAndFetchObject(body, &srcAs3)
-	if err != nil {
-		t.Error(err)
+	if _, ok := app[getAs3RuleListAttr("global", "", "test3", "exsvc-test3")]; !ok {
+		t.Errorf("the rule list of the diff clusteregressrule should be declared")
 	}
-	srcAdc = as3ADC(srcAs3[DeclarationKey].(map[string]interface{}))
-	body = fullResource(DefaultPartition, true, srcAdc, deltaAdc)
-	printObj(body)
 
-	//delete only one clusteregressrule
-	as3post = newAs3Post(nil, nil, &clusterEgressList, &externalServiceList, nil, nil, nil, tntcfg)
-	srcAdc = as3ADC{}
+	//delete clusteregressrule
+	as3post = newAs3Post(nil, nil, nil, &externalServiceList, nil, nil, nil, nil, tntcfg)
 	deltaAdc = as3ADC{}
-	as3post.generateAS3ResourceDeclaration(srcAdc)
-	printObj(srcAdc)
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
-	body = fullResource(DefaultPartition, true, srcAdc, deltaAdc)
-	printObj(body)
+	srcAdc = reconcileMockResource(t, DefaultPartition, srcAdc, deltaAdc)
+	if _, ok := srcAdc.getAS3SharedApp(DefaultPartition)[getAs3RuleListAttr("global", "", "test3", "exsvc-test3")]; ok {
+		t.Errorf("the rule list of the deleted clusteregressrule should be deleted")
+	}
+}
 
+// reconcileMockResource reconciles srcAdc to desiredAdc of partition, and returns the ADC as it is declared on BIG-IP
+func reconcileMockResource(t *testing.T, partition string, srcAdc, desiredAdc as3ADC) as3ADC {
+	body := reconcileResource(partition, srcAdc, desiredAdc)
+	printObj(body)
+	if body == nil {
+		return srcAdc
+	}
+	declared := map[string]interface{}{}
+	if err := validateJSONAndFetchObject(body, &declared); err != nil {
+		t.Fatal(err)
+	}
+	return as3ADC(declared[DeclarationKey].(map[string]interface{}))
 }
 
 func TestMockNamespaceEgressRule(t *testing.T) {
@@ -2199,22 +2196,18 @@ func TestMockNamespaceEgressRule(t *testing.T) {
 		},
 	}
 
-	namespaceList := corev1.NamespaceList{
-		Items: []corev1.Namespace{
+	namespaceList := NamespaceList{
+		Items: []Namespace{
 			{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "project1",
-					Annotations: map[string]string{
-						NamespaceCidr: "10.1.0.1/16",
-					},
-				},
+				Namespace: corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "project1"}},
+				Cidrs:     []string{"10.1.0.1/16"},
 			},
 		},
 	}
 	initTenantConfig(as3cfg, "kube-system")
 	tntcfg := GetTenantConfigForParttition(DefaultPartition)
 
-	as3post := newAs3Post(nil, &namespaceEgressRuleList, nil, &externalServiceList, nil, nil, &namespaceList, tntcfg)
+	as3post := newAs3Post(nil, &namespaceEgressRuleList, nil, &externalServiceList, nil, nil, nil, &namespaceList, tntcfg)
 
 	as3 := initDefaultAS3()
 	printObj(as3)
@@ -2227,36 +2220,33 @@ func TestMockNamespaceEgressRule(t *testing.T) {
 	srcAdc := as3ADC(srcAs3[DeclarationKey].(map[string]interface{}))
 	deltaAdc := as3ADC{}
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
-	body := fullResource("Common", false, srcAdc, deltaAdc)
 	t.Log("==================>init namespaceegressrule")
-	printObj(body)
+	srcAdc = reconcileMockResource(t, "Common", srcAdc, deltaAdc)
 
 	//add same namespaceegressrule
 	t.Log("==================>add same namespaceegressrule")
-	srcAs3 = map[string]interface{}{}
-	err = validateJSONAndFetchObject(body, &srcAs3)
-	if err != nil {
-		t.Error(err)
+	if body := reconcileResource("Common", srcAdc, deltaAdc); body != nil {
+		t.Errorf("the same namespaceegressrule is declared, nothing should be declared")
 	}
-	srcAdc = as3ADC(srcAs3[DeclarationKey].(map[string]interface{}))
-	body = fullResource("Common", false, srcAdc, deltaAdc)
-	printObj(body)
 
 	//surpport rd in common
 	t.Log("==================>surpport rd")
 	as3cfg.IsSupportRouteDomain = true
 	initTenantConfig(as3cfg, "kube-system")
 	tntcfg = GetTenantConfigForParttition("project1")
-	as3post = newAs3Post(nil, &namespaceEgressRuleList, nil, &externalServiceList, nil, nil, &namespaceList, tntcfg)
+	as3post = newAs3Post(nil, &namespaceEgressRuleList, nil, &externalServiceList, nil, nil, nil, &namespaceList, tntcfg)
 	deltaAdc = as3ADC{}
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
-	body = fullResource("project1", false, srcAdc, deltaAdc)
-	printObj(body)
+	rdAdc := reconcileMockResource(t, "project1", srcAdc, deltaAdc)
 
 	//surpport rd in common
 	t.Log("==================>delete partition")
-	body = fullResource("project1", true, srcAdc, deltaAdc)
-	printObj(body)
+	deltaAdc = as3ADC{}
+	newAs3Post(nil, nil, nil, &externalServiceList, nil, nil, nil, &namespaceList, tntcfg).generateAS3ResourceDeclaration(deltaAdc)
+	rdAdc = reconcileMockResource(t, "project1", rdAdc, deltaAdc)
+	if _, ok := rdAdc.getAS3SharedApp("project1")[getAs3RuleListAttr("ns", "project1", "test", "exsvc-test1")]; ok {
+		t.Errorf("the rule list of the deleted namespaceegressrule should be deleted")
+	}
 
 	//add diff namespaceegressrule
 	t.Log("==================>add diff namespaceegressrule")
@@ -2319,27 +2309,26 @@ func TestMockNamespaceEgressRule(t *testing.T) {
 			},
 		},
 	}
-	namespaceList = corev1.NamespaceList{
-		Items: []corev1.Namespace{
+	namespaceList = NamespaceList{
+		Items: []Namespace{
 			{
-				ObjectMeta: metav1.ObjectMeta{
-					Name: "project2",
-					Annotations: map[string]string{
-						NamespaceCidr: "10.1.0.1/16",
-					},
-				},
+				Namespace: corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "project2"}},
+				Cidrs:     []string{"10.1.0.1/16"},
 			},
 		},
 	}
 	tntcfg = GetTenantConfigForParttition(DefaultPartition)
-	as3post1 := newAs3Post(nil, &namespaceEgressRuleList, nil, &externalServiceList, nil, nil, &namespaceList, tntcfg)
+	as3post1 := newAs3Post(nil, &namespaceEgressRuleList, nil, &externalServiceList, nil, nil, nil, &namespaceList, tntcfg)
 	deltaAdc = as3ADC{}
 	as3post1.generateAS3ResourceDeclaration(deltaAdc)
-	body = fullResource("Common", false, srcAdc, deltaAdc)
-	printObj(body)
+	srcAdc = reconcileMockResource(t, "Common", srcAdc, deltaAdc)
 	//delete namespaceegressrule
-	body = fullResource("Common", true, srcAdc, deltaAdc)
-	printObj(body)
+	deltaAdc = as3ADC{}
+	newAs3Post(nil, nil, nil, &externalServiceList, nil, nil, nil, &namespaceList, tntcfg).generateAS3ResourceDeclaration(deltaAdc)
+	srcAdc = reconcileMockResource(t, "Common", srcAdc, deltaAdc)
+	if _, ok := srcAdc.getAS3SharedApp("Common")[getAs3RuleListAttr("ns", "project2", "test2", "exsvc-test3")]; ok {
+		t.Errorf("the rule list of the deleted namespaceegressrule should be deleted")
+	}
 }
 
 func TestMockServiceEgressRule(t *testing.T) {
@@ -2423,15 +2412,12 @@ func TestMockServiceEgressRule(t *testing.T) {
 	}
 	initTenantConfig(as3cfg, "dwb-test")
 	as3 := initDefaultAS3()
-	adc := as3[DeclarationKey].(as3ADC)[DefaultPartition]
-	srcAdc := map[string]interface{}{}
-	validateJSONAndFetchObject(adc, &srcAdc)
+	srcAdc := as3[DeclarationKey].(as3ADC)
 	tntcfg := GetTenantConfigForParttition("dwb-test")
 	deltaSrc := as3ADC{}
-	post := newAs3Post(&svcgrList, nil, nil, &exsvcList, nil, &epList, nil, tntcfg)
+	post := newAs3Post(&svcgrList, nil, nil, &exsvcList, nil, &epList, nil, nil, tntcfg)
 	post.generateAS3ResourceDeclaration(deltaSrc)
-	body := fullResource(DefaultPartition, false, srcAdc, deltaSrc)
-	printObj(body)
+	reconcileMockResource(t, tntcfg.Name, srcAdc, deltaSrc)
 }
 
 func TestMockExtenalService(t *testing.T) {
@@ -2496,14 +2482,15 @@ func TestMockExtenalService(t *testing.T) {
 	tntcfg := GetTenantConfigForParttition(DefaultPartition)
 	as3 := initDefaultAS3()
 	adc := as3[DeclarationKey].(as3ADC)
-	as3post := newAs3Post(&svcRuleList, &nsRuleList, &cgRuleList, &exsvcList, nil, nil, nil, tntcfg)
+	as3post := newAs3Post(&svcRuleList, &nsRuleList, &cgRuleList, &exsvcList, nil, nil, nil, nil, tntcfg)
 	as3post.generateAS3ResourceDeclaration(adc)
 	deltaAdc := as3ADC{}
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
 	printObj(deltaAdc)
 	//delete exsvc
-	body := fullResource("Common", true, adc, deltaAdc)
-	printObj(body)
+	deltaAdc = as3ADC{}
+	newAs3Post(nil, nil, nil, nil, nil, nil, nil, nil, tntcfg).generateAS3ResourceDeclaration(deltaAdc)
+	reconcileMockResource(t, "Common", adc, deltaAdc)
 
 	//There are bwt and no bwt at the same time
 	t.Log("test: There are bwt and no bwt at the same time")
@@ -2534,7 +2521,7 @@ func TestMockExtenalService(t *testing.T) {
 			},
 		},
 	}
-	as3post = newAs3Post(&svcRuleList, &nsRuleList, &cgRuleList, &exsvcList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(&svcRuleList, &nsRuleList, &cgRuleList, &exsvcList, nil, nil, nil, nil, tntcfg)
 	adc = as3ADC{}
 	as3post.generateAS3ResourceDeclaration(adc)
 	printObj(adc)
@@ -2556,17 +2543,16 @@ func TestMockExtenalService(t *testing.T) {
 			},
 		},
 	}
-	as3post = newAs3Post(&svcRuleList, &nsRuleList, &cgRuleList, &exsvcList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(&svcRuleList, &nsRuleList, &cgRuleList, &exsvcList, nil, nil, nil, nil, tntcfg)
 	adc = as3ADC{}
 	as3post.generateAS3ResourceDeclaration(adc)
 	printObj(adc)
 
 	//There are not ports, only has address, delete exsvc
 	t.Log("There are not ports, only has address, delete exsvc")
-	deltaAdc1 := map[string]interface{}{}
-	validateJSONAndFetchObject(adc, &deltaAdc1)
-	body = fullResource(DefaultPartition, true, adc, deltaAdc1)
-	printObj(body)
+	deltaAdc = as3ADC{}
+	newAs3Post(nil, nil, nil, nil, nil, nil, nil, nil, tntcfg).generateAS3ResourceDeclaration(deltaAdc)
+	reconcileMockResource(t, DefaultPartition, adc, deltaAdc)
 
 	//modify protocol
 	printObj("modify protocol:")
@@ -2614,7 +2600,7 @@ func TestMockExtenalService(t *testing.T) {
 			},
 		},
 	}
-	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, nil, tntcfg)
 	adc = as3ADC{}
 	as3post.generateAS3ResourceDeclaration(adc)
 	exsvcList = kubeovnv1alpha1.ExternalServiceList{
@@ -2645,11 +2631,10 @@ func TestMockExtenalService(t *testing.T) {
 			},
 		},
 	}
-	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, nil, tntcfg)
 	deltaAdc = as3ADC{}
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
-	body = fullResource(DefaultPartition, false, adc, deltaAdc)
-	printObj(body)
+	reconcileMockResource(t, DefaultPartition, adc, deltaAdc)
 
 	//one rule , mult exsvc, delete one exsvc
 	printObj("one rule , mult exsvc, delete one exsvc")
@@ -2700,7 +2685,7 @@ func TestMockExtenalService(t *testing.T) {
 			},
 		},
 	}
-	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, nil, tntcfg)
 	adc, deltaAdc = as3ADC{}, as3ADC{}
 	as3post.generateAS3ResourceDeclaration(adc)
 	printObj(adc)
@@ -2728,12 +2713,17 @@ func TestMockExtenalService(t *testing.T) {
 		},
 	}
 
-	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, tntcfg)
+	as3post = newAs3Post(nil, nil, &cgRuleList, &exsvcList, nil, nil, nil, nil, tntcfg)
 	as3post.generateAS3ResourceDeclaration(deltaAdc)
 	printObj(deltaAdc)
 
-	body = fullResource(DefaultPartition, true, adc, deltaAdc)
-	printObj(body)
+	app := reconcileMockResource(t, DefaultPartition, adc, deltaAdc).getAS3SharedApp(DefaultPartition)
+	if _, ok := app[getAs3RuleListAttr("global", "", "test1", "exsvc1")]; ok {
+		t.Errorf("the rule list of the deleted exsvc should be deleted")
+	}
+	if _, ok := app[getAs3RuleListAttr("global", "", "test1", "exsvc2")]; !ok {
+		t.Errorf("the rule list of the kept exsvc should be declared")
+	}
 }
 
 func TestRomteLog(t *testing.T) {
@@ -2912,6 +2902,476 @@ func TestNewAddress(t *testing.T) {
 	printObj(app)
 }
 
+func TestGetPodAddresses(t *testing.T) {
+	newPod := func(name, ns, app string, phase corev1.PodPhase, ip string) corev1.Pod {
+		return corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: ns,
+				Labels:    map[string]string{"app": app},
+			},
+			Status: corev1.PodStatus{
+				Phase: phase,
+				PodIP: ip,
+			},
+		}
+	}
+	pods := []corev1.Pod{
+		newPod("job-1", "dwb-test", "job", corev1.PodRunning, "10.16.0.2"),
+		newPod("job-2", "dwb-test", "job", corev1.PodPending, ""),
+		newPod("job-3", "dwb-test", "job", corev1.PodSucceeded, "10.16.0.3"),
+		newPod("web-1", "dwb-test", "web", corev1.PodRunning, "10.16.0.4"),
+		newPod("job-1", "other", "job", corev1.PodRunning, "10.16.0.5"),
+	}
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "job"}}
+	addrs := getPodAddresses(pods, "dwb-test", selector)
+	if !reflect.DeepEqual(addrs, []string{"10.16.0.2"}) {
+		t.Errorf("expect [10.16.0.2], got %v", addrs)
+	}
+}
+
+func TestGetNamespaceAddresses(t *testing.T) {
+	newNs := func(name, env, cidr string) Namespace {
+		return Namespace{
+			Namespace: corev1.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   name,
+					Labels: map[string]string{"env": env},
+				},
+			},
+			Cidrs: SplitNamespaceCidr(cidr),
+		}
+	}
+	namespaces := []Namespace{
+		newNs("prod-1", "prod", "10.16.0.0/16"),
+		newNs("prod-2", "prod", ""),
+		newNs("dev-1", "dev", "10.17.0.0/16"),
+	}
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}}
+	addrs := getNamespaceAddresses(namespaces, selector)
+	if !reflect.DeepEqual(addrs, []string{"10.16.0.0/16"}) {
+		t.Errorf("expect [10.16.0.0/16], got %v", addrs)
+	}
+}
+
+func TestSortFirewallPolicies(t *testing.T) {
+	initTenantConfig(As3Config{ClusterName: "k8s", MasterCluster: "k8s"}, "")
+	denyAll := getAs3UsePathForPartition(DefaultPartition, getAllDenyRuleListAttr())
+	app := map[string]interface{}{
+		"k8s_svc_policy_rd": map[string]interface{}{
+			"class": ClassFirewallPolicy,
+			"rules": []interface{}{
+				map[string]interface{}{"use": "/Common/Shared/rule_e"},
+				map[string]interface{}{"use": "/Common/Shared/rule_a"},
+				map[string]interface{}{"use": denyAll},
+				map[string]interface{}{"use": "/Common/Shared/rule_b"},
+				map[string]interface{}{"use": "/Common/Shared/rule_c"},
+				map[string]interface{}{"use": "/Common/Shared/rule_d"},
+			},
+		},
+		"rule_a": map[string]interface{}{"class": ClassFirewallRuleList},
+		"rule_b": map[string]interface{}{"class": ClassFirewallRuleList, "remark": "priority=10"},
+		"rule_c": FirewallRuleList{Class: ClassFirewallRuleList, Remark: "priority=2000"},
+		"rule_d": map[string]interface{}{"class": ClassFirewallRuleList, "remark": "priority=1000"},
+		"rule_e": map[string]interface{}{"class": ClassFirewallRuleList, "remark": "priority=10"},
+	}
+	sortFirewallPolicies(app)
+	policy := app["k8s_svc_policy_rd"].(FirewallPolicy)
+	//the rules of the same priority are ordered by use
+	expect := []Use{
+		{"/Common/Shared/rule_b"},
+		{"/Common/Shared/rule_e"},
+		{"/Common/Shared/rule_a"},
+		{"/Common/Shared/rule_d"},
+		{"/Common/Shared/rule_c"},
+		{denyAll},
+	}
+	if !reflect.DeepEqual(policy.Rules, expect) {
+		t.Errorf("expect %v, got %v", expect, policy.Rules)
+	}
+}
+
+func TestFirewallSchedule(t *testing.T) {
+	start := metav1.NewTime(time.Date(2021, 6, 1, 8, 0, 0, 0, time.FixedZone("CST", 8*3600)))
+	schedule := newFirewallSchedule(&kubeovnv1alpha1.EgressRuleSchedule{
+		DateValidStart: &start,
+		DailyHourStart: "01:00",
+		DailyHourEnd:   "04:00",
+		DaysOfWeek:     []string{"monday", "friday"},
+	})
+	if schedule.DateValidStart != "2021-06-01T00:00:00Z" || schedule.DateValidEnd != "" {
+		t.Errorf("unexpected schedule date range %s-%s", schedule.DateValidStart, schedule.DateValidEnd)
+	}
+
+	app := map[string]interface{}{
+		"rule_list": map[string]interface{}{
+			"class": ClassFirewallRuleList,
+			"rules": []interface{}{
+				map[string]interface{}{
+					"destination": map[string]interface{}{},
+					"schedule":    map[string]interface{}{"use": "/Common/Shared/used_schedule"},
+				},
+			},
+		},
+		"used_schedule":   map[string]interface{}{"class": ClassFirewallSchedule},
+		"unused_schedule": map[string]interface{}{"class": ClassFirewallSchedule},
+	}
+	clearUpUnreferencePolicy(app)
+	if _, ok := app["used_schedule"]; !ok {
+		t.Errorf("referenced schedule should be kept")
+	}
+	if _, ok := app["unused_schedule"]; ok {
+		t.Errorf("unreferenced schedule should be removed")
+	}
+}
+
+func TestReconcileSharedApp(t *testing.T) {
+	initTenantConfig(As3Config{ClusterName: "k8s"}, "")
+	policyAttr := getAs3PolicyAttr("ns", "")
+	kept := getAs3RuleListAttr("ns", "project1", "rule1", "exsvc1")
+	stale := getAs3RuleListAttr("ns", "project1", "rule1", "exsvc2")
+	other := "other_ns_project1_rule1_ext_exsvc2_rule_list"
+	ruleList := func() map[string]interface{} {
+		return map[string]interface{}{"class": ClassFirewallRuleList, "rules": []interface{}{}}
+	}
+	srcApp := as3Application{
+		policyAttr: map[string]interface{}{
+			"class": ClassFirewallPolicy,
+			"rules": []interface{}{
+				map[string]interface{}{"use": "/project1/Shared/" + kept},
+				map[string]interface{}{"use": "/project1/Shared/" + stale},
+				map[string]interface{}{"use": "/project1/Shared/" + other},
+			},
+		},
+		kept:  ruleList(),
+		stale: ruleList(),
+		other: ruleList(),
+	}
+	desiredApp := as3Application{
+		policyAttr: FirewallPolicy{Class: ClassFirewallPolicy, Rules: []Use{{"/project1/Shared/" + kept}}},
+		kept:       ruleList(),
+	}
+
+	originApp, app := reconcileSharedApp("project1", srcApp, desiredApp)
+	if _, ok := originApp[stale]; !ok {
+		t.Errorf("rule list %s should be in the origin app", stale)
+	}
+	if _, ok := app[stale]; ok {
+		t.Errorf("rule list %s should be pruned", stale)
+	}
+	if _, ok := app[kept]; !ok {
+		t.Errorf("rule list %s should be kept", kept)
+	}
+	if _, ok := app[other]; !ok {
+		t.Errorf("rule list %s of other cluster should be kept", other)
+	}
+	uses := []string{}
+	for _, rule := range app[policyAttr].(map[string]interface{})["rules"].([]interface{}) {
+		uses = append(uses, getOriginAttrOfUsePath(rule.(map[string]interface{})["use"].(string)))
+	}
+	if expect := []string{kept, other}; !reflect.DeepEqual(uses, expect) {
+		t.Errorf("expect %v, got %v", expect, uses)
+	}
+
+	//the rule lists of the rule removed from desired are all pruned
+	delete(desiredApp, kept)
+	desiredApp[policyAttr] = FirewallPolicy{Class: ClassFirewallPolicy, Rules: []Use{}}
+	_, app = reconcileSharedApp("project1", srcApp, desiredApp)
+	if _, ok := app[kept]; ok {
+		t.Errorf("rule list %s should be pruned when the rule is removed", kept)
+	}
+}
+
+func TestMatchExternalService(t *testing.T) {
+	exsvc := &kubeovnv1alpha1.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "saas-vendor",
+			Labels: map[string]string{"category": "saas"},
+		},
+	}
+	if !MatchExternalService([]string{"saas-vendor"}, nil, exsvc) {
+		t.Errorf("exsvc should be matched by name")
+	}
+	if !MatchExternalService(nil, &metav1.LabelSelector{MatchLabels: map[string]string{"category": "saas"}}, exsvc) {
+		t.Errorf("exsvc should be matched by selector")
+	}
+	if MatchExternalService([]string{"other"}, &metav1.LabelSelector{MatchLabels: map[string]string{"category": "db"}}, exsvc) {
+		t.Errorf("exsvc should not be matched")
+	}
+}
+
+func TestGetExsvcDestAddresses(t *testing.T) {
+	exsvc := kubeovnv1alpha1.ExternalService{
+		Spec: kubeovnv1alpha1.ExternalServiceSpec{
+			Addresses: []string{"1.1.1.2"},
+			FQDNs:     []string{"api.example.com", "*.cdn.example.com"},
+		},
+		Status: kubeovnv1alpha1.ExternalServiceStatus{
+			ResolvedAddresses: []string{"93.184.216.34"},
+		},
+	}
+	addrs := getExsvcDestAddresses(exsvc)
+	if !reflect.DeepEqual(addrs, []string{"1.1.1.2", "api.example.com", "*.cdn.example.com"}) {
+		t.Errorf("fqdns should be left to AFM, got %v", addrs)
+	}
+	exsvc.Spec.DNSResolution = kubeovnv1alpha1.DNSResolutionController
+	addrs = getExsvcDestAddresses(exsvc)
+	if !reflect.DeepEqual(addrs, []string{"1.1.1.2", "*.cdn.example.com", "93.184.216.34"}) {
+		t.Errorf("fqdns should be resolved by controller, got %v", addrs)
+	}
+	if len(exsvc.Spec.Addresses) != 1 {
+		t.Errorf("spec addresses should not be changed")
+	}
+}
+
+func TestAddressFamily(t *testing.T) {
+	cidrs := SplitNamespaceCidr("10.16.0.0/16, fd00:10:16::/64")
+	if !reflect.DeepEqual(cidrs, []string{"10.16.0.0/16", "fd00:10:16::/64"}) {
+		t.Errorf("unexpected namespace cidrs %v", cidrs)
+	}
+	v4, v6 := splitAddressFamily([]string{"10.1.1.1", "fd00::1", "10.1.1.2-10.1.1.9", "fd00:1::/64"})
+	if !reflect.DeepEqual(v4, []string{"10.1.1.1", "10.1.1.2-10.1.1.9"}) || !reflect.DeepEqual(v6, []string{"fd00::1", "fd00:1::/64"}) {
+		t.Errorf("unexpected address family %v %v", v4, v6)
+	}
+	for addr, expected := range map[string]string{
+		"10.16.0.2":    "10.16.0.2%2",
+		"10.16.0.0/16": "10.16.0.0%2/16",
+		"fd00::2":      "fd00::2%2",
+		"fd00:10::/64": "fd00:10::%2/64",
+	} {
+		if rd := withRouteDomain(addr, 2); rd != expected {
+			t.Errorf("expected %s, got %s", expected, rd)
+		}
+	}
+	if rd := withRouteDomain("10.16.0.2", 0); rd != "10.16.0.2" {
+		t.Errorf("route domain 0 should not be appended, got %s", rd)
+	}
+}
+
+func TestNewFamilyNatRules(t *testing.T) {
+	ac := newAs3Post(nil, nil, nil, nil, nil, nil, nil, nil, &TenantConfig{Name: DefaultPartition})
+	sharedApp := as3Application{}
+	rules := ac.newFamilyNatRules(NatRule{Protocol: "any"}, "rule", "trans", []string{"192.168.21.68", "fd00::68"}, sharedApp)
+	if len(rules) != 2 || rules[0].Name != "rule" || rules[1].Name != "rule_v6" {
+		t.Fatalf("expected a nat rule of each family, got %v", rules)
+	}
+	if rules[1].SourceTranslation.Use != "/Common/Shared/trans_v6" {
+		t.Errorf("unexpected IPv6 translation %s", rules[1].SourceTranslation.Use)
+	}
+	if trans := sharedApp["trans_v6"].(NatSourceTranslation); !reflect.DeepEqual(trans.Addresses, []string{"fd00::68"}) {
+		t.Errorf("unexpected IPv6 translation addresses %v", trans.Addresses)
+	}
+
+	sharedApp = as3Application{}
+	rules = ac.newFamilyNatRules(NatRule{Protocol: "any"}, "rule", "trans", []string{"192.168.21.68"}, sharedApp)
+	if len(rules) != 1 || rules[0].Name != "rule" || len(sharedApp) != 1 {
+		t.Errorf("expected an IPv4 nat rule only, got %v", rules)
+	}
+}
+
+func TestGetObjectPaths(t *testing.T) {
+	initTenantConfig(As3Config{ClusterName: "k8s"}, "")
+	clsRules := &kubeovnv1alpha1.ClusterEgressRuleList{
+		Items: []kubeovnv1alpha1.ClusterEgressRule{{ObjectMeta: metav1.ObjectMeta{Name: "allow"}}},
+	}
+	ac := newAs3Post(nil, nil, clsRules, nil, nil, nil, nil, nil, &TenantConfig{Name: DefaultPartition})
+	ruleList := getAs3RuleListAttr("global", "", "allow", "saas")
+	schedule := getAs3ScheduleAttr("global", "", "allow")
+	app := as3Application{
+		ruleList: nil,
+		schedule: nil,
+		getAs3RuleListAttr("global", "", "deny", "saas"): nil,
+	}
+	paths := ac.getObjectPaths(app)
+	expected := []string{"/Common/Shared/" + ruleList, "/Common/Shared/" + schedule}
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %v, got %v", expected, paths)
+	}
+}
+
+func TestDeleteObjectPaths(t *testing.T) {
+	initTenantConfig(As3Config{ClusterName: "k8s"}, "")
+	ruleList := getAs3RuleListAttr("ns", "project1", "rule1", "exsvc1")
+	destAddr := getAs3DestAddrAttr("ns", "project1", "rule1", "exsvc1")
+	otherList := getAs3RuleListAttr("ns", "project1", "rule2", "exsvc1")
+	natRule := getAs3NatRuleListAttr("project1", "eip1", "")
+	srcApp := map[string]interface{}{
+		"k8s_ns_policy_rd": map[string]interface{}{
+			"class": ClassFirewallPolicy,
+			"rules": []interface{}{
+				map[string]interface{}{"use": "/project1/Shared/" + ruleList},
+				map[string]interface{}{"use": "/project1/Shared/" + otherList},
+			},
+		},
+		ruleList:  map[string]interface{}{"class": ClassFirewallRuleList},
+		destAddr:  map[string]interface{}{"class": ClassFirewallAddressList},
+		otherList: map[string]interface{}{"class": ClassFirewallRuleList, "rules": []interface{}{}},
+		defaultSnatPolicy: map[string]interface{}{
+			"class": ClassNatPolicy,
+			"rules": []interface{}{
+				map[string]interface{}{"name": natRule},
+				map[string]interface{}{"name": natRule + ipv6Suffix},
+			},
+		},
+	}
+	paths := []string{
+		"/project1/Shared/" + ruleList,
+		"/project1/Shared/" + destAddr,
+		"/project1/Shared/" + defaultSnatPolicy + "/" + natRule,
+		"/project2/Shared/" + otherList,
+	}
+	if !deleteObjectPaths("project1", srcApp, paths) {
+		t.Fatalf("objects should be deleted")
+	}
+	if _, ok := srcApp[ruleList]; ok {
+		t.Errorf("recorded rule list should be deleted")
+	}
+	if _, ok := srcApp[destAddr]; ok {
+		t.Errorf("recorded address list should be deleted")
+	}
+	if _, ok := srcApp[otherList]; !ok {
+		t.Errorf("rule list of other partition should be kept")
+	}
+	policy := srcApp["k8s_ns_policy_rd"].(FirewallPolicy)
+	if len(policy.Rules) != 1 || policy.Rules[0].Use != "/project1/Shared/"+otherList {
+		t.Errorf("unexpected policy rules %v", policy.Rules)
+	}
+	natPolicy := srcApp[defaultSnatPolicy].(NatPolicy)
+	if len(natPolicy.Rules) != 1 || natPolicy.Rules[0].Name != natRule+ipv6Suffix {
+		t.Errorf("unexpected nat rules %v", natPolicy.Rules)
+	}
+	if deleteObjectPaths("project1", srcApp, paths[:2]) {
+		t.Errorf("nothing should be deleted again")
+	}
+}
+
+func TestReconcileResource(t *testing.T) {
+	initTenantConfig(As3Config{
+		ClusterName:         "k8s",
+		ExternalIPAddresses: []string{"192.168.1.1"},
+		Tenant:              []TenantConfig{{Name: DefaultPartition, Namespaces: "project1"}},
+	}, "kube-system")
+	tntcfg := GetTenantConfigForParttition(DefaultPartition)
+	render := func(names ...string) as3ADC {
+		nsRules := &kubeovnv1alpha1.NamespaceEgressRuleList{}
+		for _, name := range names {
+			nsRules.Items = append(nsRules.Items, kubeovnv1alpha1.NamespaceEgressRule{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "project1"},
+				Spec:       kubeovnv1alpha1.NamespaceEgressRuleSpec{Action: "accept", ExternalServices: []string{"saas"}},
+			})
+		}
+		exsvcs := &kubeovnv1alpha1.ExternalServiceList{
+			Items: []kubeovnv1alpha1.ExternalService{{
+				ObjectMeta: metav1.ObjectMeta{Name: "saas", Namespace: "project1"},
+				Spec:       kubeovnv1alpha1.ExternalServiceSpec{Addresses: []string{"1.1.1.1"}},
+			}},
+		}
+		adc := as3ADC{}
+		newAs3Post(nil, nsRules, nil, exsvcs, nil, nil, nil, nil, tntcfg).generateAS3ResourceDeclaration(adc)
+		return adc
+	}
+	toAdc := func(decl interface{}) as3ADC {
+		adc := map[string]interface{}{}
+		if err := validateJSONAndFetchObject(decl.(as3)[DeclarationKey], &adc); err != nil {
+			t.Fatal(err)
+		}
+		return adc
+	}
+
+	decl := reconcileResource(DefaultPartition, as3ADC{}, render("rule1", "rule2"))
+	if decl == nil {
+		t.Fatalf("the tenant should be declared")
+	}
+	srcAdc := toAdc(decl)
+	//objects of another cluster sharing the tenant
+	otherList := "other_ns_project1_rule1_ext_saas_rule_list"
+	app := srcAdc.getAS3SharedApp(DefaultPartition)
+	app[otherList] = map[string]interface{}{"class": ClassFirewallRuleList, "rules": []interface{}{}}
+	policyAttr := getAs3PolicyAttr("ns", "")
+	policy := app[policyAttr].(map[string]interface{})
+	policy["rules"] = append(policy["rules"].([]interface{}), map[string]interface{}{"use": "/Common/Shared/" + otherList})
+	if reconcileResource(DefaultPartition, srcAdc, render("rule1", "rule2")) != nil {
+		t.Errorf("the tenant is up to date, nothing should be declared")
+	}
+
+	decl = reconcileResource(DefaultPartition, srcAdc, render("rule1"))
+	if decl == nil {
+		t.Fatalf("rule2 should be removed")
+	}
+	app = toAdc(decl).getAS3SharedApp(DefaultPartition)
+	for _, attr := range []string{getAs3RuleListAttr("ns", "project1", "rule2", "saas"), getAs3DestAddrAttr("ns", "project1", "rule2", "saas")} {
+		if _, ok := app[attr]; ok {
+			t.Errorf("%s of the removed rule should be deleted", attr)
+		}
+	}
+	for _, attr := range []string{getAs3RuleListAttr("ns", "project1", "rule1", "saas"), otherList, getAllDenyRuleListAttr()} {
+		if _, ok := app[attr]; !ok {
+			t.Errorf("%s should be kept", attr)
+		}
+	}
+	uses := []string{}
+	for _, rule := range app[policyAttr].(map[string]interface{})["rules"].([]interface{}) {
+		uses = append(uses, getOriginAttrOfUsePath(rule.(map[string]interface{})["use"].(string)))
+	}
+	expected := []string{getAs3RuleListAttr("ns", "project1", "rule1", "saas"), otherList}
+	if !reflect.DeepEqual(uses, expected) {
+		t.Errorf("expected policy rules %v, got %v", expected, uses)
+	}
+}
+
+func TestGetDrifts(t *testing.T) {
+	initTenantConfig(As3Config{
+		ClusterName:         "k8s",
+		ExternalIPAddresses: []string{"192.168.1.1"},
+		Tenant:              []TenantConfig{{Name: DefaultPartition, Namespaces: "project1"}},
+	}, "kube-system")
+	tntcfg := GetTenantConfigForParttition(DefaultPartition)
+	nsRules := &kubeovnv1alpha1.NamespaceEgressRuleList{
+		Items: []kubeovnv1alpha1.NamespaceEgressRule{{
+			ObjectMeta: metav1.ObjectMeta{Name: "rule1", Namespace: "project1"},
+			Spec:       kubeovnv1alpha1.NamespaceEgressRuleSpec{Action: "accept", ExternalServices: []string{"saas"}},
+		}},
+	}
+	exsvcs := &kubeovnv1alpha1.ExternalServiceList{
+		Items: []kubeovnv1alpha1.ExternalService{{
+			ObjectMeta: metav1.ObjectMeta{Name: "saas", Namespace: "project1"},
+			Spec:       kubeovnv1alpha1.ExternalServiceSpec{Addresses: []string{"1.1.1.1"}},
+		}},
+	}
+	desiredAdc := as3ADC{}
+	newAs3Post(nil, nsRules, nil, exsvcs, nil, nil, nil, nil, tntcfg).generateAS3ResourceDeclaration(desiredAdc)
+	desired := desiredAdc.getAS3SharedApp(DefaultPartition)
+
+	originApp, reconciledApp := reconcileSharedApp(DefaultPartition, as3Application{}, desired)
+	if drifts := getDrifts(DefaultPartition, reconciledApp, reconciledApp); len(drifts) != 0 {
+		t.Errorf("expected no drift, got %v", drifts)
+	}
+	if len(originApp) != 0 || len(getDrifts(DefaultPartition, originApp, reconciledApp)) != len(reconciledApp)-2 {
+		t.Errorf("every object should be missing on an empty tenant")
+	}
+
+	//edited on BIG-IP
+	src := as3Application{}
+	for attr, value := range reconciledApp {
+		src[attr] = value
+	}
+	addrAttr := getAs3DestAddrAttr("ns", "project1", "rule1", "saas")
+	ruleListAttr := getAs3RuleListAttr("ns", "project1", "rule1", "saas")
+	staleAttr := getAs3RuleListAttr("ns", "project1", "gone", "saas")
+	src[addrAttr] = map[string]interface{}{"class": ClassFirewallAddressList, "addresses": []interface{}{"2.2.2.2"}}
+	delete(src, ruleListAttr)
+	src[staleAttr] = map[string]interface{}{"class": ClassFirewallRuleList, "rules": []interface{}{}}
+	originApp, reconciledApp = reconcileSharedApp(DefaultPartition, src, desired)
+	expected := []Drift{
+		{Path: getAs3UsePathForPartition(DefaultPartition, staleAttr), Type: DriftUnexpected},
+		{Path: getAs3UsePathForPartition(DefaultPartition, addrAttr), Type: DriftModified},
+		{Path: getAs3UsePathForPartition(DefaultPartition, ruleListAttr), Type: DriftMissing},
+	}
+	if drifts := getDrifts(DefaultPartition, originApp, reconciledApp); !reflect.DeepEqual(drifts, expected) {
+		t.Errorf("expected drifts %v, got %v", expected, drifts)
+	}
+}
+
 func TestLogLevel(t *testing.T) {
 	klog.InitFlags(nil)
 	flag.Set("v", "3")
@@ -3023,10 +3483,9 @@ func TestSupportRouteDomain(t *testing.T) {
 	//as3 := initDefaultAS3()
 	adc := as3ADC{}
 	printObj(adc)
-	post := newAs3Post(&svcgrList, nil, nil, &exsvcList, nil, &epList, nil, tntcfg)
+	post := newAs3Post(&svcgrList, nil, nil, &exsvcList, nil, &epList, nil, nil, tntcfg)
 	delta := as3ADC{}
 	post.generateAS3ResourceDeclaration(delta)
 	printObj(delta)
-	body := fullResource("dwb-test", false, adc, delta)
-	printObj(body)
+	reconcileMockResource(t, "dwb-test", adc, delta)
 }
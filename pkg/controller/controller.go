@@ -22,13 +22,19 @@ import (
 	"time"
 
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	genericinformers "k8s.io/client-go/informers"
 	kubeinformers "k8s.io/client-go/informers/core/v1"
+	discoveryinformers "k8s.io/client-go/informers/discovery/v1beta1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
 	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	listersv1 "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1beta1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
@@ -37,6 +43,7 @@ import (
 	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
 	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/as3"
+	"github.com/kubeovn/ces-controller/pkg/dns"
 	clientset "github.com/kubeovn/ces-controller/pkg/generated/clientset/versioned"
 	as3scheme "github.com/kubeovn/ces-controller/pkg/generated/clientset/versioned/scheme"
 	snatinformers "github.com/kubeovn/ces-controller/pkg/generated/informers/externalversions/bigip.io/v1alpha1"
@@ -51,13 +58,25 @@ const (
 	// SuccessSynced is used as part of the Event 'reason' when a resource is synced
 	SuccessSynced = "Synced"
 
-	FailedSynced = "Failed Synced"
+	// FailedSynced is used as part of the Event 'reason' when a resource fails to be synced
+	FailedSynced = "FailedSynced"
 
 	// MessageResourceSynced is the message used for an Event fired when a resource
 	// is synced successfully
 	MessageResourceSynced = "synced successfully"
 
 	MessageResourceFailedSynced = "synced Failed"
+
+	// RuleExpired is used as part of the Event 'reason' when an egress rule expires
+	RuleExpired = "Expired"
+
+	// MessageRuleExpired is the message used for an Event fired when an egress rule
+	// expires and is removed from BIG-IP
+	MessageRuleExpired = "expired and removed from BIG-IP"
+
+	// Drifted is used as part of the Event 'reason' when the BIG-IP objects of a resource drift
+	// from the desired state
+	Drifted = "Drifted"
 )
 
 // Controller is the controller implementation for related resources
@@ -65,41 +84,74 @@ type Controller struct {
 	kubeclientset kubernetes.Interface
 	as3clientset  clientset.Interface
 
-	endpointsLister              listersv1.EndpointsLister
-	endpointsSynced              cache.InformerSynced
-	endpointsWorkqueue           workqueue.RateLimitingInterface
-	externalServicesLister       listers.ExternalServiceLister
-	externalServicesSynced       cache.InformerSynced
-	externalServiceWorkqueue     workqueue.RateLimitingInterface
-	clusterEgressRuleLister      listers.ClusterEgressRuleLister
-	clusterEgressRuleSynced      cache.InformerSynced
-	clusterEgressRuleWorkqueue   workqueue.RateLimitingInterface
-	namespaceEgressRuleLister    listers.NamespaceEgressRuleLister
-	namespaceEgressRuleSynced    cache.InformerSynced
-	namespaceEgressRuleWorkqueue workqueue.RateLimitingInterface
-	seviceEgressRuleLister       listers.ServiceEgressRuleLister
-	seviceEgressRuleSynced       cache.InformerSynced
-	seviceEgressRuleWorkqueue    workqueue.RateLimitingInterface
-	recorder                     record.EventRecorder
-	as3Client                    *as3.Client
+	endpointsLister            listersv1.EndpointsLister
+	endpointSliceLister        discoverylisters.EndpointSliceLister
+	endpointsSynced            cache.InformerSynced
+	endpointsWorkqueue         workqueue.RateLimitingInterface
+	podsLister                 listersv1.PodLister
+	podsSynced                 cache.InformerSynced
+	namespacesLister           listersv1.NamespaceLister
+	namespacesSynced           cache.InformerSynced
+	externalServicesLister     listers.ExternalServiceLister
+	externalServicesSynced     cache.InformerSynced
+	clusterEgressRuleLister    listers.ClusterEgressRuleLister
+	clusterEgressRuleIndexer   cache.Indexer
+	clusterEgressRuleSynced    cache.InformerSynced
+	namespaceEgressRuleLister  listers.NamespaceEgressRuleLister
+	namespaceEgressRuleIndexer cache.Indexer
+	namespaceEgressRuleSynced  cache.InformerSynced
+	seviceEgressRuleLister     listers.ServiceEgressRuleLister
+	seviceEgressRuleIndexer    cache.Indexer
+	seviceEgressRuleSynced     cache.InformerSynced
+	tenantWorkqueue            workqueue.RateLimitingInterface
+	recorder                   record.EventRecorder
+	as3Client                  *as3.Client
+	addressListBatcher         *as3.AddressListBatcher
+	resolver                   dns.Resolver
+	fqdnRefreshes              map[string]fqdnRefresh
+	driftInterval              time.Duration
+	driftMode                  string
+	workerStuckPeriod          time.Duration
+	gcInterval                 time.Duration
+	gcDryRun                   bool
+	endpointsProgress          workerProgress
+	tenantProgress             workerProgress
+	startup                    startupReconcile
+	ipPoolLister               cache.GenericLister
+	ipPoolsSynced              cache.InformerSynced
+	subnetLister               cache.GenericLister
+	subnetsSynced              cache.InformerSynced
 
 	// snat相关
-	externalIPRuleLister    snatlisters.ExternalIPRuleLister
-	externalIPRuleSynced    cache.InformerSynced
-	externalIPRuleWorkQueue workqueue.RateLimitingInterface
+	externalIPRuleLister snatlisters.ExternalIPRuleLister
+	externalIPRuleSynced cache.InformerSynced
 }
 
-// NewController returns a new CES controller
+// NewController returns a new CES controller, the endpoints are watched by endpointSliceInformer if it is not nil,
+// or by endpointsInformer, the calico ip pools and the kube-ovn subnets are watched by ipPoolInformer and
+// subnetInformer if they are not nil
 func NewController(
 	kubeclientset kubernetes.Interface,
 	as3clientset clientset.Interface,
 	endpointsInformer kubeinformers.EndpointsInformer,
+	endpointSliceInformer discoveryinformers.EndpointSliceInformer,
+	podInformer kubeinformers.PodInformer,
+	namespaceInformer kubeinformers.NamespaceInformer,
 	externalServiceInformer informers.ExternalServiceInformer,
 	clusterEgressRuleInformer informers.ClusterEgressRuleInformer,
 	namespaceEgressRuleInformer informers.NamespaceEgressRuleInformer,
 	seviceEgressRuleInformer informers.ServiceEgressRuleInformer,
 	externalIPRuleInformer snatinformers.ExternalIPRuleInformer,
-	as3Client *as3.Client) *Controller {
+	ipPoolInformer genericinformers.GenericInformer,
+	subnetInformer genericinformers.GenericInformer,
+	as3Client *as3.Client,
+	resolver dns.Resolver,
+	driftInterval time.Duration,
+	driftMode string,
+	workerStuckPeriod time.Duration,
+	addressListBatchWindow time.Duration,
+	gcInterval time.Duration,
+	gcDryRun bool) *Controller {
 
 	utilruntime.Must(as3scheme.AddToScheme(scheme.Scheme))
 	klog.V(4).Info("Creating event broadcaster")
@@ -109,55 +161,115 @@ func NewController(
 	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: ControllerAgentName})
 
 	controller := &Controller{
-		kubeclientset:                kubeclientset,
-		as3clientset:                 as3clientset,
-		endpointsLister:              endpointsInformer.Lister(),
-		endpointsSynced:              endpointsInformer.Informer().HasSynced,
-		endpointsWorkqueue:           workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Services"),
-		externalServicesLister:       externalServiceInformer.Lister(),
-		externalServicesSynced:       externalServiceInformer.Informer().HasSynced,
-		externalServiceWorkqueue:     workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ExternalServices"),
-		clusterEgressRuleLister:      clusterEgressRuleInformer.Lister(),
-		clusterEgressRuleSynced:      clusterEgressRuleInformer.Informer().HasSynced,
-		clusterEgressRuleWorkqueue:   workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ClusterEgressRules"),
-		namespaceEgressRuleLister:    namespaceEgressRuleInformer.Lister(),
-		namespaceEgressRuleSynced:    namespaceEgressRuleInformer.Informer().HasSynced,
-		namespaceEgressRuleWorkqueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "NamespaceEgressRules"),
-		seviceEgressRuleLister:       seviceEgressRuleInformer.Lister(),
-		seviceEgressRuleSynced:       seviceEgressRuleInformer.Informer().HasSynced,
-		seviceEgressRuleWorkqueue:    workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "SeviceEgressRules"),
-		recorder:                     recorder,
-		as3Client:                    as3Client,
-
-		externalIPRuleLister:    externalIPRuleInformer.Lister(),
-		externalIPRuleSynced:    externalIPRuleInformer.Informer().HasSynced,
-		externalIPRuleWorkQueue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "ExternalIPRules"),
+		kubeclientset:              kubeclientset,
+		as3clientset:               as3clientset,
+		endpointsWorkqueue:         workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Endpoints"),
+		podsLister:                 podInformer.Lister(),
+		podsSynced:                 podInformer.Informer().HasSynced,
+		namespacesLister:           namespaceInformer.Lister(),
+		namespacesSynced:           namespaceInformer.Informer().HasSynced,
+		externalServicesLister:     externalServiceInformer.Lister(),
+		externalServicesSynced:     externalServiceInformer.Informer().HasSynced,
+		clusterEgressRuleLister:    clusterEgressRuleInformer.Lister(),
+		clusterEgressRuleIndexer:   clusterEgressRuleInformer.Informer().GetIndexer(),
+		clusterEgressRuleSynced:    clusterEgressRuleInformer.Informer().HasSynced,
+		namespaceEgressRuleLister:  namespaceEgressRuleInformer.Lister(),
+		namespaceEgressRuleIndexer: namespaceEgressRuleInformer.Informer().GetIndexer(),
+		namespaceEgressRuleSynced:  namespaceEgressRuleInformer.Informer().HasSynced,
+		seviceEgressRuleLister:     seviceEgressRuleInformer.Lister(),
+		seviceEgressRuleIndexer:    seviceEgressRuleInformer.Informer().GetIndexer(),
+		seviceEgressRuleSynced:     seviceEgressRuleInformer.Informer().HasSynced,
+		tenantWorkqueue:            workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), "Tenants"),
+		recorder:                   recorder,
+		as3Client:                  as3Client,
+		resolver:                   resolver,
+		fqdnRefreshes:              make(map[string]fqdnRefresh),
+		driftInterval:              driftInterval,
+		driftMode:                  driftMode,
+		workerStuckPeriod:          workerStuckPeriod,
+		gcInterval:                 gcInterval,
+		gcDryRun:                   gcDryRun,
+
+		externalIPRuleLister: externalIPRuleInformer.Lister(),
+		externalIPRuleSynced: externalIPRuleInformer.Informer().HasSynced,
+	}
+
+	//the tenant failing to update its address lists by the endpoints is declared as a whole
+	controller.addressListBatcher = as3.NewAddressListBatcher(as3Client, addressListBatchWindow, func(partition string, err error) {
+		controller.enqueueTenant(partition)
+	})
+
+	//an external service change is fanned out to the referencing rules of every kind by the reverse indexes
+	for _, informer := range []cache.SharedIndexInformer{clusterEgressRuleInformer.Informer(),
+		namespaceEgressRuleInformer.Informer(), seviceEgressRuleInformer.Informer()} {
+		utilruntime.Must(informer.AddIndexers(ruleExternalServiceIndexers))
 	}
 
 	klog.Info("Setting up event handlers")
 
-	endpointsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		//AddFunc: controller.enqueueEndpoints,
+	if endpointSliceInformer != nil {
+		controller.endpointSliceLister = endpointSliceInformer.Lister()
+		controller.endpointsSynced = endpointSliceInformer.Informer().HasSynced
+		endpointSliceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.enqueueEndpointSlice,
+			UpdateFunc: func(old, new interface{}) {
+				if !controller.isUpdate(old, new) {
+					return
+				}
+				controller.enqueueEndpointSlice(new)
+			},
+			DeleteFunc: controller.enqueueEndpointSlice,
+		})
+	} else {
+		controller.endpointsLister = endpointsInformer.Lister()
+		controller.endpointsSynced = endpointsInformer.Informer().HasSynced
+		endpointsInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.enqueueEndpoints,
+			UpdateFunc: func(old, new interface{}) {
+				if !controller.isUpdate(old, new) {
+					return
+				}
+				controller.enqueueEndpoints(new)
+			},
+			DeleteFunc: controller.enqueueEndpoints,
+		})
+	}
+
+	podInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueuePod,
 		UpdateFunc: func(old, new interface{}) {
 			if !controller.isUpdate(old, new) {
 				return
 			}
-			controller.enqueueEndpoints(new)
+			// labels may change, sync the rules selecting either version
+			controller.enqueuePod(old)
+			controller.enqueuePod(new)
 		},
-		DeleteFunc: controller.enqueueEndpoints,
+		DeleteFunc: controller.enqueuePod,
 	})
 
-	externalServiceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
-		//AddFunc: controller.enqueueExternalService,
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueNamespace,
 		UpdateFunc: func(old, new interface{}) {
 			if !controller.isUpdate(old, new) {
+				return
+			}
+			// labels may change, sync the rules selecting either version
+			controller.enqueueNamespace(old)
+			controller.enqueueNamespace(new)
+		},
+		DeleteFunc: controller.enqueueNamespace,
+	})
 
+	externalServiceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.enqueueExternalService,
+		UpdateFunc: func(old, new interface{}) {
+			if !controller.isUpdate(old, new) {
 				return
 			}
 			controller.enqueueExternalService(new)
 		},
-		// todo: fix delele egressrule & externalservice bug?
-		// DeleteFunc: controller.enqueueExternalService,
+		DeleteFunc: controller.enqueueExternalService,
 	})
 
 	clusterEgressRuleInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -204,17 +316,44 @@ func NewController(
 		DeleteFunc: controller.enqueueExternalIPRule,
 	})
 
+	if ipPoolInformer != nil {
+		controller.ipPoolLister = ipPoolInformer.Lister()
+		controller.ipPoolsSynced = ipPoolInformer.Informer().HasSynced
+		ipPoolInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.enqueueIPPool,
+			UpdateFunc: func(old, new interface{}) {
+				if !controller.isUpdate(old, new) {
+					return
+				}
+				controller.enqueueIPPool(new)
+			},
+			DeleteFunc: controller.enqueueIPPool,
+		})
+	}
+	if subnetInformer != nil {
+		controller.subnetLister = subnetInformer.Lister()
+		controller.subnetsSynced = subnetInformer.Informer().HasSynced
+		subnetInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc: controller.enqueueSubnet,
+			UpdateFunc: func(old, new interface{}) {
+				if !controller.isUpdate(old, new) {
+					return
+				}
+				// the namespaces may change, sync the namespaces bound to either version
+				controller.enqueueSubnet(old)
+				controller.enqueueSubnet(new)
+			},
+			DeleteFunc: controller.enqueueSubnet,
+		})
+	}
+
 	return controller
 }
 
 func (c *Controller) Run(stopCh <-chan struct{}) error {
 	defer utilruntime.HandleCrash()
 	defer c.endpointsWorkqueue.ShutDown()
-	defer c.externalServiceWorkqueue.ShutDown()
-	defer c.clusterEgressRuleWorkqueue.ShutDown()
-	defer c.namespaceEgressRuleWorkqueue.ShutDown()
-	defer c.seviceEgressRuleWorkqueue.ShutDown()
-	defer c.externalIPRuleWorkQueue.ShutDown()
+	defer c.tenantWorkqueue.ShutDown()
 
 	klog.Info("Starting CES controller")
 
@@ -222,6 +361,12 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 	if ok := cache.WaitForCacheSync(stopCh, c.endpointsSynced); !ok {
 		return fmt.Errorf("failed to wait for endpoints caches to sync")
 	}
+	if ok := cache.WaitForCacheSync(stopCh, c.podsSynced); !ok {
+		return fmt.Errorf("failed to wait for pods caches to sync")
+	}
+	if ok := cache.WaitForCacheSync(stopCh, c.namespacesSynced); !ok {
+		return fmt.Errorf("failed to wait for namespaces caches to sync")
+	}
 	if ok := cache.WaitForCacheSync(stopCh, c.externalServicesSynced); !ok {
 		return fmt.Errorf("failed to wait for external service caches to sync")
 	}
@@ -237,19 +382,48 @@ func (c *Controller) Run(stopCh <-chan struct{}) error {
 	if ok := cache.WaitForCacheSync(stopCh, c.externalIPRuleSynced); !ok {
 		return fmt.Errorf("failed to wait for snat external ip rule caches to sync")
 	}
+	if c.ipPoolsSynced != nil {
+		if ok := cache.WaitForCacheSync(stopCh, c.ipPoolsSynced); !ok {
+			return fmt.Errorf("failed to wait for calico ip pool caches to sync")
+		}
+	}
+	if c.subnetsSynced != nil {
+		if ok := cache.WaitForCacheSync(stopCh, c.subnetsSynced); !ok {
+			return fmt.Errorf("failed to wait for kube-ovn subnet caches to sync")
+		}
+	}
+
+	c.reconcileAllTenants()
 
 	klog.Info("Starting workers")
+	c.endpointsProgress.start()
+	c.tenantProgress.start()
 	go wait.Until(c.runEndpointsWorker, 5*time.Second, stopCh)
-	go wait.Until(c.runExternalServiceWorker, 5*time.Second, stopCh)
-	go wait.Until(c.runClusterEgressRuleWorker, 5*time.Second, stopCh)
-	go wait.Until(c.runNamespaceEgressRuleWorker, 5*time.Second, stopCh)
-	go wait.Until(c.runSeviceEgressRuleWorker, 5*time.Second, stopCh)
-	go wait.Until(c.runExternalIPRuleWorker, 5*time.Second, stopCh)
+	go wait.Until(c.runTenantWorker, 5*time.Second, stopCh)
+	go wait.Until(c.resolveExternalServices, 5*time.Second, stopCh)
+	if c.driftInterval > 0 {
+		//the tenants are declared at start before their drift is checked
+		go func() {
+			select {
+			case <-stopCh:
+			case <-time.After(c.driftInterval):
+				wait.Until(c.checkDrift, c.driftInterval, stopCh)
+			}
+		}()
+	}
+	if c.gcInterval > 0 {
+		//the objects of the rules deleted while the controller was down are removed by the startup reconcile
+		go func() {
+			select {
+			case <-stopCh:
+			case <-time.After(c.gcInterval):
+				wait.Until(c.collectGarbage, c.gcInterval, stopCh)
+			}
+		}()
+	}
 
 	klog.Info("Started workers")
-	for i := 0; i < 6; i++ {
-		<-stopCh
-	}
+	<-stopCh
 
 	klog.Info("Shutting down workers")
 
@@ -261,53 +435,78 @@ func (c *Controller) runEndpointsWorker() {
 	}
 }
 
-func (c *Controller) runExternalServiceWorker() {
-	for c.processNextExternalServiceWorkItem() {
+func (c *Controller) runTenantWorker() {
+	for c.processNextTenantWorkItem() {
 	}
 }
 
-func (c *Controller) runClusterEgressRuleWorker() {
-	for c.processNextClusterEgressRuleWorkerItem() {
+func (c *Controller) enqueueEndpoints(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
 	}
+	c.endpointsWorkqueue.Add(key)
 }
 
-func (c *Controller) runNamespaceEgressRuleWorker() {
-	for c.processNextNamespaceEgressRuleWorkerItem() {
-	}
+// enqueueTenant enqueues the tenant of partition, which is declared from all of its resources
+func (c *Controller) enqueueTenant(partition string) {
+	c.tenantWorkqueue.Add(partition)
 }
 
-func (c *Controller) runSeviceEgressRuleWorker() {
-	for c.processNextSeviceEgressRuleWorkerItem() {
+// enqueueNamespaceTenant enqueues the tenant namespace is mapped to, if any
+func (c *Controller) enqueueNamespaceTenant(namespace string) {
+	if tntcfg := as3.GetTenantConfigForNamespace(namespace); tntcfg != nil {
+		c.enqueueTenant(tntcfg.Name)
 	}
 }
 
-func (c *Controller) runExternalIPRuleWorker() {
-	for c.processNextExternalIPRuleWorkItem() {
+// enqueueNamespacedObject enqueues the tenant of the namespace of obj, or of its tombstone
+func (c *Controller) enqueueNamespacedObject(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
 	}
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.enqueueNamespaceTenant(namespace)
 }
 
-func (c *Controller) enqueueEndpoints(obj interface{}) {
-	c.endpointsWorkqueue.Add(obj)
-}
-
+// enqueueExternalService enqueues the tenants of the egress rules which may reference the external service
 func (c *Controller) enqueueExternalService(obj interface{}) {
-	c.externalServiceWorkqueue.Add(obj)
+	exsvc, ok := getExternalService(obj)
+	if !ok {
+		return
+	}
+	if exsvc.Namespace == as3.GetClusterSvcExtNamespace() {
+		c.enqueueTenant(as3.DefaultPartition)
+	}
+	c.enqueueNamespaceTenant(exsvc.Namespace)
 }
 
 func (c *Controller) enqueueClusterEgressRule(obj interface{}) {
-	c.clusterEgressRuleWorkqueue.Add(obj)
+	c.enqueueTenant(as3.DefaultPartition)
 }
 
 func (c *Controller) enqueueNamespaceEgressRule(obj interface{}) {
-	c.namespaceEgressRuleWorkqueue.Add(obj)
+	c.enqueueNamespacedObject(obj)
 }
 
 func (c *Controller) enqueueSeviceEgressRule(obj interface{}) {
-	c.seviceEgressRuleWorkqueue.Add(obj)
+	c.enqueueNamespacedObject(obj)
 }
 
 func (c *Controller) enqueueExternalIPRule(obj interface{}) {
-	c.externalIPRuleWorkQueue.Add(obj)
+	c.enqueueNamespacedObject(obj)
+}
+
+// hasExpired returns whether expiresAt of egress rule is reached
+func hasExpired(expiresAt *metav1.Time) bool {
+	return expiresAt != nil && !time.Now().Before(expiresAt.Time)
 }
 
 func (c *Controller) isUpdate(old, new interface{}) bool {
@@ -319,15 +518,33 @@ func (c *Controller) isUpdate(old, new interface{}) bool {
 		if oldRule.ResourceVersion == newRule.ResourceVersion {
 			return false
 		}
+		if !reflect.DeepEqual(oldRule.DeletionTimestamp, newRule.DeletionTimestamp) {
+			return true
+		}
 		if oldRule.Spec.Action != newRule.Spec.Action {
 			return true
 		}
 		if oldRule.Spec.Logging != newRule.Spec.Logging {
 			return true
 		}
+		if oldRule.Spec.Priority != newRule.Spec.Priority {
+			return true
+		}
+		if !reflect.DeepEqual(oldRule.Spec.Schedule, newRule.Spec.Schedule) {
+			return true
+		}
+		if !reflect.DeepEqual(oldRule.Spec.ExpiresAt, newRule.Spec.ExpiresAt) {
+			return true
+		}
+		if !reflect.DeepEqual(oldRule.Spec.NamespaceSelector, newRule.Spec.NamespaceSelector) {
+			return true
+		}
 		if !reflect.DeepEqual(oldRule.Spec.ExternalServices, newRule.Spec.ExternalServices) {
 			return true
 		}
+		if !reflect.DeepEqual(oldRule.Spec.ExternalServiceSelector, newRule.Spec.ExternalServiceSelector) {
+			return true
+		}
 	case *kubeovn.NamespaceEgressRule:
 		oldNsRule := old.(*kubeovn.NamespaceEgressRule)
 		newNsRule := new.(*kubeovn.NamespaceEgressRule)
@@ -340,15 +557,30 @@ func (c *Controller) isUpdate(old, new interface{}) bool {
 		if oldNsRule.ResourceVersion == newNsRule.ResourceVersion {
 			return false
 		}
+		if !reflect.DeepEqual(oldNsRule.DeletionTimestamp, newNsRule.DeletionTimestamp) {
+			return true
+		}
 		if oldNsRule.Spec.Action != newNsRule.Spec.Action {
 			return true
 		}
 		if oldNsRule.Spec.Logging != newNsRule.Spec.Logging {
 			return true
 		}
+		if oldNsRule.Spec.Priority != newNsRule.Spec.Priority {
+			return true
+		}
+		if !reflect.DeepEqual(oldNsRule.Spec.Schedule, newNsRule.Spec.Schedule) {
+			return true
+		}
+		if !reflect.DeepEqual(oldNsRule.Spec.ExpiresAt, newNsRule.Spec.ExpiresAt) {
+			return true
+		}
 		if !reflect.DeepEqual(oldNsRule.Spec.ExternalServices, newNsRule.Spec.ExternalServices) {
 			return true
 		}
+		if !reflect.DeepEqual(oldNsRule.Spec.ExternalServiceSelector, newNsRule.Spec.ExternalServiceSelector) {
+			return true
+		}
 	case *kubeovn.ServiceEgressRule:
 		oldSvcRule := old.(*kubeovn.ServiceEgressRule)
 		newSvcRule := new.(*kubeovn.ServiceEgressRule)
@@ -360,31 +592,56 @@ func (c *Controller) isUpdate(old, new interface{}) bool {
 		if oldSvcRule.ResourceVersion == newSvcRule.ResourceVersion {
 			return false
 		}
+		if !reflect.DeepEqual(oldSvcRule.DeletionTimestamp, newSvcRule.DeletionTimestamp) {
+			return true
+		}
 		if oldSvcRule.Spec.Action != newSvcRule.Spec.Action {
 			return true
 		}
 		if oldSvcRule.Spec.Logging != newSvcRule.Spec.Logging {
 			return true
 		}
-		if oldSvcRule.Spec.Service != oldSvcRule.Spec.Service {
+		if oldSvcRule.Spec.Priority != newSvcRule.Spec.Priority {
+			return true
+		}
+		if !reflect.DeepEqual(oldSvcRule.Spec.Schedule, newSvcRule.Spec.Schedule) {
+			return true
+		}
+		if !reflect.DeepEqual(oldSvcRule.Spec.ExpiresAt, newSvcRule.Spec.ExpiresAt) {
+			return true
+		}
+		if oldSvcRule.Spec.Service != newSvcRule.Spec.Service {
+			return true
+		}
+		if !reflect.DeepEqual(oldSvcRule.Spec.PodSelector, newSvcRule.Spec.PodSelector) {
 			return true
 		}
 		if !reflect.DeepEqual(oldSvcRule.Spec.ExternalServices, newSvcRule.Spec.ExternalServices) {
 			return true
 		}
+		if !reflect.DeepEqual(oldSvcRule.Spec.ExternalServiceSelector, newSvcRule.Spec.ExternalServiceSelector) {
+			return true
+		}
 	case *kubeovn.ExternalService:
 		oldExt := old.(*kubeovn.ExternalService)
 		newExt := new.(*kubeovn.ExternalService)
 		if oldExt.ResourceVersion == newExt.ResourceVersion {
 			return false
 		}
-		if oldExt.ResourceVersion != newExt.ResourceVersion {
+		if !reflect.DeepEqual(oldExt.Labels, newExt.Labels) {
+			return true
+		}
+		if !reflect.DeepEqual(oldExt.Spec, newExt.Spec) {
 			return true
 		}
-		if !reflect.DeepEqual(oldExt.Spec.Addresses, newExt.Spec.Addresses) {
+		// LastResolveTime only is not a change
+		if !reflect.DeepEqual(oldExt.Status.ResolvedAddresses, newExt.Status.ResolvedAddresses) {
 			return true
 		}
-		if !reflect.DeepEqual(oldExt.Spec.Ports, newExt.Spec.Ports) {
+		if !reflect.DeepEqual(oldExt.DeletionTimestamp, newExt.DeletionTimestamp) {
+			return true
+		}
+		if !reflect.DeepEqual(oldExt.Finalizers, newExt.Finalizers) {
 			return true
 		}
 	case *snat.ExternalIPRule:
@@ -393,9 +650,53 @@ func (c *Controller) isUpdate(old, new interface{}) bool {
 		if oldEipRule.ResourceVersion == newEipRule.ResourceVersion {
 			return false
 		}
+		if !reflect.DeepEqual(oldEipRule.DeletionTimestamp, newEipRule.DeletionTimestamp) {
+			return true
+		}
 		if !reflect.DeepEqual(oldEipRule.Spec, newEipRule.Spec) {
 			return true
 		}
+	case *corev1.Namespace:
+		oldNs := old.(*corev1.Namespace)
+		newNs := new.(*corev1.Namespace)
+		if oldNs.ResourceVersion == newNs.ResourceVersion {
+			return false
+		}
+		if !reflect.DeepEqual(oldNs.DeletionTimestamp, newNs.DeletionTimestamp) {
+			return true
+		}
+		if !reflect.DeepEqual(oldNs.Labels, newNs.Labels) {
+			return true
+		}
+		for _, key := range getNamespaceSourceAnnotations(newNs.Name) {
+			if oldNs.Annotations[key] != newNs.Annotations[key] {
+				return true
+			}
+		}
+	case *unstructured.Unstructured:
+		oldObj := old.(*unstructured.Unstructured)
+		newObj := new.(*unstructured.Unstructured)
+		if oldObj.GetResourceVersion() == newObj.GetResourceVersion() {
+			return false
+		}
+		if !reflect.DeepEqual(oldObj.Object["spec"], newObj.Object["spec"]) {
+			return true
+		}
+	case *corev1.Pod:
+		oldPod := old.(*corev1.Pod)
+		newPod := new.(*corev1.Pod)
+		if oldPod.ResourceVersion == newPod.ResourceVersion {
+			return false
+		}
+		if !reflect.DeepEqual(oldPod.Labels, newPod.Labels) {
+			return true
+		}
+		if oldPod.Status.Phase != newPod.Status.Phase || oldPod.Status.PodIP != newPod.Status.PodIP {
+			return true
+		}
+		if !reflect.DeepEqual(oldPod.Status.PodIPs, newPod.Status.PodIPs) {
+			return true
+		}
 	case *corev1.Endpoints:
 		oldEp := old.(*corev1.Endpoints)
 		newEp := new.(*corev1.Endpoints)
@@ -416,6 +717,23 @@ func (c *Controller) isUpdate(old, new interface{}) bool {
 		if !reflect.DeepEqual(oldEp.Subsets, newEp.Subsets) {
 			return true
 		}
+	case *discoveryv1beta1.EndpointSlice:
+		oldSlice := old.(*discoveryv1beta1.EndpointSlice)
+		newSlice := new.(*discoveryv1beta1.EndpointSlice)
+		if oldSlice.Namespace == "kube-system" {
+			return false
+		}
+		nsConfig := as3.GetTenantConfigForNamespace(oldSlice.Namespace)
+		if nsConfig == nil {
+			klog.V(5).Infof("namespace[%s] not in watch range ", oldSlice.Namespace)
+			return false
+		}
+		if oldSlice.ResourceVersion == newSlice.ResourceVersion {
+			return false
+		}
+		if !reflect.DeepEqual(oldSlice.Endpoints, newSlice.Endpoints) {
+			return true
+		}
 	}
 	return false
 }
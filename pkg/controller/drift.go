@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/klog/v2"
+
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+	"github.com/kubeovn/ces-controller/pkg/metrics"
+)
+
+const (
+	// DriftModeReport reports the drift of the tenants on BIG-IP by metrics and events
+	DriftModeReport = "report"
+	// DriftModeRepair reports the drift of the tenants, and declares the drifted tenants again
+	DriftModeRepair = "repair"
+)
+
+// checkDrift compares each tenant on BIG-IP with the desired state rendered from the informer caches
+func (c *Controller) checkDrift() {
+	for _, partition := range as3.GetTenantPartitions() {
+		if err := c.checkTenantDrift(partition); err != nil {
+			metrics.DriftChecks.WithLabelValues(partition, "error").Inc()
+			klog.Errorf("failed to check the drift of tenant[%s]: %v", partition, err)
+		}
+	}
+}
+
+func (c *Controller) checkTenantDrift(partition string) error {
+	tnt, err := c.getTenant(partition)
+	if err != nil || tnt == nil {
+		return err
+	}
+	res := &tnt.declared
+	drifts, err := c.as3Client.As3Drift(&res.serviceEgressRules, &res.namespaceEgressRules, &res.clusterEgressRules,
+		&res.externalServices, &res.externalIPRules, &res.endpoints, &res.pods, &res.namespaces, tnt.config)
+	if err != nil {
+		return err
+	}
+
+	counts := map[string]int{as3.DriftMissing: 0, as3.DriftModified: 0, as3.DriftUnexpected: 0}
+	for _, drift := range drifts {
+		counts[drift.Type]++
+	}
+	for ty, count := range counts {
+		metrics.DriftObjects.WithLabelValues(partition, ty).Set(float64(count))
+	}
+	if len(drifts) == 0 {
+		metrics.DriftChecks.WithLabelValues(partition, "in_sync").Inc()
+		klog.V(4).Infof("tenant[%s] is in sync with BIG-IP", partition)
+		return nil
+	}
+	metrics.DriftChecks.WithLabelValues(partition, "drifted").Inc()
+	for _, drift := range drifts {
+		klog.Warningf("tenant[%s] drifted on BIG-IP: %s is %s", partition, drift.Path, drift.Type)
+	}
+	c.recordDrifts(tnt, drifts)
+
+	if c.driftMode == DriftModeRepair {
+		klog.Infof("tenant[%s] drifted on BIG-IP, repair it", partition)
+		metrics.DriftRepairs.WithLabelValues(partition).Inc()
+		c.enqueueTenant(partition)
+	}
+	return nil
+}
+
+// recordDrifts records an event on each resource of the tenant whose BIG-IP objects in status drifted
+func (c *Controller) recordDrifts(tnt *tenant, drifts []as3.Drift) {
+	record := func(obj runtime.Object, status *common.SyncStatus) {
+		objects := make(map[string]bool, len(status.BigIPObjects))
+		for _, object := range status.BigIPObjects {
+			objects[object] = true
+		}
+		drifted := []string{}
+		for _, drift := range drifts {
+			if objects[drift.Path] {
+				drifted = append(drifted, fmt.Sprintf("%s is %s", drift.Path, drift.Type))
+			}
+		}
+		if len(drifted) != 0 {
+			c.recorder.Event(obj, corev1.EventTypeWarning, Drifted, strings.Join(drifted, ", "))
+		}
+	}
+	for _, rule := range tnt.clusterEgressRules {
+		record(rule, &rule.Status.SyncStatus)
+	}
+	for _, rule := range tnt.namespaceEgressRules {
+		record(rule, &rule.Status.SyncStatus)
+	}
+	for _, rule := range tnt.serviceEgressRules {
+		record(rule, &rule.Status.SyncStatus)
+	}
+	for _, rule := range tnt.externalIPRules {
+		record(rule, &rule.Status.SyncStatus)
+	}
+	for _, exsvc := range tnt.externalServices {
+		record(exsvc, &exsvc.Status.SyncStatus)
+	}
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// getEndpoints returns the endpoints of service in namespace, they are aggregated from the endpoint slices of
+// the service if the controller watches the endpoint slices
+func (c *Controller) getEndpoints(namespace, service string) (*corev1.Endpoints, error) {
+	if c.endpointSliceLister == nil {
+		return c.endpointsLister.Endpoints(namespace).Get(service)
+	}
+	slices, err := c.endpointSliceLister.EndpointSlices(namespace).List(
+		labels.SelectorFromSet(labels.Set{discoveryv1beta1.LabelServiceName: service}))
+	if err != nil {
+		return nil, err
+	}
+	if len(slices) == 0 {
+		return nil, errors.NewNotFound(corev1.Resource("endpoints"), service)
+	}
+	return getEndpointsFromSlices(namespace, service, slices), nil
+}
+
+// getEndpointsFromSlices aggregates the addresses of the endpoint slices of service into one subset, the slices
+// of both IPv4 and IPv6 are aggregated for the dual stack, and the FQDN slices are skipped
+func getEndpointsFromSlices(namespace, service string, slices []*discoveryv1beta1.EndpointSlice) *corev1.Endpoints {
+	sorted := append([]*discoveryv1beta1.EndpointSlice{}, slices...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Name < sorted[j].Name
+	})
+	ep := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: service},
+	}
+	//an address duplicated in the slices as they change is sending if any of them is
+	sending := map[string]bool{}
+	for _, slice := range sorted {
+		for _, endpoint := range slice.Endpoints {
+			for _, ip := range endpoint.Addresses {
+				sending[ip] = sending[ip] || isEndpointSending(endpoint.Conditions)
+			}
+		}
+	}
+	subset := corev1.EndpointSubset{}
+	seen := map[string]bool{}
+	for _, slice := range sorted {
+		if slice.AddressType != discoveryv1beta1.AddressTypeIPv4 && slice.AddressType != discoveryv1beta1.AddressTypeIPv6 {
+			continue
+		}
+		for _, endpoint := range slice.Endpoints {
+			for _, ip := range endpoint.Addresses {
+				if seen[ip] {
+					continue
+				}
+				seen[ip] = true
+				addr := corev1.EndpointAddress{IP: ip, TargetRef: endpoint.TargetRef}
+				if sending[ip] {
+					subset.Addresses = append(subset.Addresses, addr)
+				} else {
+					subset.NotReadyAddresses = append(subset.NotReadyAddresses, addr)
+				}
+			}
+		}
+	}
+	if len(subset.Addresses) != 0 || len(subset.NotReadyAddresses) != 0 {
+		ep.Subsets = []corev1.EndpointSubset{subset}
+	}
+	return ep
+}
+
+// isEndpointSending returns whether the pod of an endpoint may send egress traffic, it is ready, or serving as
+// it terminates so its connections drain, the unknown ready is interpreted as ready
+func isEndpointSending(conditions discoveryv1beta1.EndpointConditions) bool {
+	if conditions.Terminating != nil && *conditions.Terminating {
+		return conditions.Serving != nil && *conditions.Serving
+	}
+	return conditions.Ready == nil || *conditions.Ready
+}
+
+// enqueueEndpointSlice enqueues the endpoints of the service of the endpoint slice
+func (c *Controller) enqueueEndpointSlice(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	slice, ok := obj.(*discoveryv1beta1.EndpointSlice)
+	if !ok {
+		klog.Errorf("expected EndpointSlice but got %#v", obj)
+		return
+	}
+	service := slice.Labels[discoveryv1beta1.LabelServiceName]
+	if service == "" {
+		return
+	}
+	c.endpointsWorkqueue.Add(slice.Namespace + "/" + service)
+}
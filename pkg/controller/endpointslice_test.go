@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1beta1 "k8s.io/api/discovery/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGetEndpointsFromSlices(t *testing.T) {
+	yes, no := true, false
+	endpoint := func(ip string, ready, serving, terminating *bool) discoveryv1beta1.Endpoint {
+		return discoveryv1beta1.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: discoveryv1beta1.EndpointConditions{Ready: ready, Serving: serving, Terminating: terminating},
+		}
+	}
+	slices := []*discoveryv1beta1.EndpointSlice{
+		{
+			ObjectMeta:  metav1.ObjectMeta{Name: "web-v6"},
+			AddressType: discoveryv1beta1.AddressTypeIPv6,
+			Endpoints:   []discoveryv1beta1.Endpoint{endpoint("fd00::1", &yes, &yes, &no)},
+		},
+		{
+			ObjectMeta:  metav1.ObjectMeta{Name: "web-a"},
+			AddressType: discoveryv1beta1.AddressTypeIPv4,
+			Endpoints: []discoveryv1beta1.Endpoint{
+				endpoint("10.0.0.1", &yes, &yes, &no),
+				endpoint("10.0.0.2", nil, nil, nil),
+				endpoint("10.0.0.3", &no, &yes, &yes),
+				endpoint("10.0.0.4", &no, &no, &yes),
+				endpoint("10.0.0.5", &no, &no, &no),
+			},
+		},
+		{
+			ObjectMeta:  metav1.ObjectMeta{Name: "web-b"},
+			AddressType: discoveryv1beta1.AddressTypeIPv4,
+			//the pod moved between the slices
+			Endpoints: []discoveryv1beta1.Endpoint{endpoint("10.0.0.5", &yes, &yes, &no)},
+		},
+		{
+			ObjectMeta:  metav1.ObjectMeta{Name: "web-fqdn"},
+			AddressType: discoveryv1beta1.AddressTypeFQDN,
+			Endpoints:   []discoveryv1beta1.Endpoint{endpoint("web.example.com", &yes, &yes, &no)},
+		},
+	}
+
+	ep := getEndpointsFromSlices("project1", "web", slices)
+	expected := &corev1.Endpoints{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "project1", Name: "web"},
+		Subsets: []corev1.EndpointSubset{{
+			Addresses: []corev1.EndpointAddress{
+				{IP: "10.0.0.1"}, {IP: "10.0.0.2"}, {IP: "10.0.0.3"}, {IP: "10.0.0.5"}, {IP: "fd00::1"},
+			},
+			NotReadyAddresses: []corev1.EndpointAddress{{IP: "10.0.0.4"}},
+		}},
+	}
+	if !reflect.DeepEqual(ep, expected) {
+		t.Errorf("getEndpointsFromSlices() = %+v, expected %+v", ep, expected)
+	}
+
+	if ep = getEndpointsFromSlices("project1", "web", nil); len(ep.Subsets) != 0 {
+		t.Errorf("expected no subset without slices, got %+v", ep.Subsets)
+	}
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+)
+
+const (
+	// Finalizer keeps an egress rule or external ip rule until its BIG-IP objects recorded in status are removed
+	Finalizer = "ces.kubeovn.io/finalizer"
+
+	// externalServiceFinalizer was added to the external services by hand, the controller removes it as
+	// an external service is deleted, its BIG-IP objects are removed by syncing the referencing rules
+	externalServiceFinalizer = "finalizer.kubeovn.io"
+)
+
+func hasFinalizer(obj metav1.Object) bool {
+	for _, f := range obj.GetFinalizers() {
+		if f == Finalizer {
+			return true
+		}
+	}
+	return false
+}
+
+// addFinalizer adds Finalizer to obj, and returns whether obj is changed
+func addFinalizer(obj metav1.Object) bool {
+	if hasFinalizer(obj) {
+		return false
+	}
+	obj.SetFinalizers(append(obj.GetFinalizers(), Finalizer))
+	return true
+}
+
+// removeFinalizer removes Finalizer from obj, and returns whether obj is changed
+func removeFinalizer(obj metav1.Object) bool {
+	finalizers := []string{}
+	for _, f := range obj.GetFinalizers() {
+		if f != Finalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == len(obj.GetFinalizers()) {
+		return false
+	}
+	obj.SetFinalizers(finalizers)
+	return true
+}
+
+// removeExternalServiceFinalizer removes externalServiceFinalizer from exsvc, and returns whether exsvc is changed
+func removeExternalServiceFinalizer(exsvc *kubeovn.ExternalService) bool {
+	finalizers := []string{}
+	for _, f := range exsvc.Finalizers {
+		if f != externalServiceFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	if len(finalizers) == len(exsvc.Finalizers) {
+		return false
+	}
+	exsvc.Finalizers = finalizers
+	return true
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/klog/v2"
+
+	"github.com/kubeovn/ces-controller/pkg/as3"
+	"github.com/kubeovn/ces-controller/pkg/metrics"
+)
+
+// collectGarbage finds the objects of this cluster on BIG-IP whose rules are gone, they are reported if
+// gcDryRun, or removed
+func (c *Controller) collectGarbage() {
+	for _, partition := range as3.GetTenantPartitions() {
+		if err := c.collectTenantGarbage(partition); err != nil {
+			klog.Errorf("failed to collect the garbage of tenant[%s]: %v", partition, err)
+		}
+	}
+}
+
+func (c *Controller) collectTenantGarbage(partition string) error {
+	owners, err := c.as3Client.GetClusterObjectOwners(partition)
+	if err != nil {
+		return err
+	}
+	orphans := []string{}
+	counts := map[string]int{as3.OwnerClusterEgressRule: 0, as3.OwnerNamespaceEgressRule: 0,
+		as3.OwnerServiceEgressRule: 0, as3.OwnerExternalIPRule: 0}
+	for path, owner := range owners {
+		exists, err := c.isOwnerExists(partition, owner)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		klog.Warningf("tenant[%s] has orphaned object %s of %s[%s/%s]", partition, path, owner.Kind, owner.Namespace, owner.Name)
+		orphans = append(orphans, path)
+		counts[owner.Kind]++
+	}
+	for kind, count := range counts {
+		metrics.GCOrphans.WithLabelValues(partition, kind).Set(float64(count))
+	}
+	if len(orphans) == 0 || c.gcDryRun {
+		return nil
+	}
+	if err = c.as3Client.RemoveObjects(partition, orphans); err != nil {
+		return err
+	}
+	klog.Infof("removed %d orphaned objects from tenant[%s]", len(orphans), partition)
+	metrics.GCRemovals.WithLabelValues(partition).Add(float64(len(orphans)))
+	return nil
+}
+
+// isOwnerExists returns whether the owner of the objects in the tenant of partition is in the informer caches,
+// and is still declared in the tenant, the objects are left by the namespace mapped to another tenant if not
+func (c *Controller) isOwnerExists(partition string, owner as3.ObjectOwner) (bool, error) {
+	var err error
+	switch owner.Kind {
+	case as3.OwnerClusterEgressRule:
+		if partition != as3.DefaultPartition {
+			return false, nil
+		}
+		_, err = c.clusterEgressRuleLister.Get(owner.Name)
+	case as3.OwnerNamespaceEgressRule:
+		if !isTenantNamespace(owner.Namespace, partition) {
+			return false, nil
+		}
+		_, err = c.namespaceEgressRuleLister.NamespaceEgressRules(owner.Namespace).Get(owner.Name)
+	case as3.OwnerServiceEgressRule:
+		if !isTenantNamespace(owner.Namespace, partition) {
+			return false, nil
+		}
+		_, err = c.seviceEgressRuleLister.ServiceEgressRules(owner.Namespace).Get(owner.Name)
+	case as3.OwnerExternalIPRule:
+		if !isTenantNamespace(owner.Namespace, partition) {
+			return false, nil
+		}
+		_, err = c.externalIPRuleLister.ExternalIPRules(owner.Namespace).Get(owner.Name)
+	default:
+		return true, nil
+	}
+	if errors.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,111 @@
+package controller
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+	snatlisters "github.com/kubeovn/ces-controller/pkg/generated/listers/bigip.io/v1alpha1"
+	listers "github.com/kubeovn/ces-controller/pkg/generated/listers/kubeovn.io/v1alpha1"
+)
+
+func TestCollectTenantGarbage(t *testing.T) {
+	initTestTenantConfig()
+	kept := []string{
+		"k8s_ns_project1_rule1_ext_saas_rule_list",
+		"k8s_svc_project2_rule2_ext_saas_rule_list",
+		"k8s_snat_project1_eip1_rule_list",
+	}
+	orphans := []string{
+		//the rule is deleted
+		"k8s_ns_project1_deleted_ext_saas_rule_list",
+		//the namespace of the rule is mapped to another tenant
+		"k8s_svc_project4_rule4_ext_saas_rule_list",
+		//the cluster rules are declared in Common only
+		"k8s_global_crule_ext_saas_rule_list",
+	}
+	shared := map[string]interface{}{"class": "Application", "template": "shared"}
+	for _, attr := range append(append([]string{}, kept...), orphans...) {
+		shared[attr] = map[string]interface{}{"class": "Firewall_Rule_List", "rules": []interface{}{}}
+	}
+	declaration, _ := json.Marshal(map[string]interface{}{
+		"project1": map[string]interface{}{"class": "Tenant", "Shared": shared},
+	})
+
+	var lock sync.Mutex
+	posted := []string{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.Method {
+		case http.MethodGet:
+			w.Write(declaration)
+		case http.MethodPost:
+			posted = append(posted, string(body))
+			w.Write([]byte(`{}`))
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer srv.Close()
+
+	newIndexer := func(objs ...interface{}) cache.Indexer {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+		for _, obj := range objs {
+			if err := indexer.Add(obj); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return indexer
+	}
+	meta := func(namespace, name string) metav1.ObjectMeta {
+		return metav1.ObjectMeta{Namespace: namespace, Name: name}
+	}
+	c := &Controller{
+		as3Client:               as3.NewClient(strings.TrimPrefix(srv.URL, "https://"), "admin", "admin", true),
+		clusterEgressRuleLister: listers.NewClusterEgressRuleLister(newIndexer(&kubeovn.ClusterEgressRule{ObjectMeta: meta("", "crule")})),
+		namespaceEgressRuleLister: listers.NewNamespaceEgressRuleLister(newIndexer(
+			&kubeovn.NamespaceEgressRule{ObjectMeta: meta("project1", "rule1")})),
+		seviceEgressRuleLister: listers.NewServiceEgressRuleLister(newIndexer(
+			&kubeovn.ServiceEgressRule{ObjectMeta: meta("project2", "rule2")},
+			&kubeovn.ServiceEgressRule{ObjectMeta: meta("project4", "rule4")})),
+		externalIPRuleLister: snatlisters.NewExternalIPRuleLister(newIndexer(&snat.ExternalIPRule{ObjectMeta: meta("project1", "eip1")})),
+		gcDryRun:             true,
+	}
+
+	if err := c.collectTenantGarbage("project1"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(posted) != 0 {
+		t.Errorf("expected the orphans reported only in dry run, got %d declarations", len(posted))
+	}
+
+	c.gcDryRun = false
+	if err := c.collectTenantGarbage("project1"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(posted) != 1 {
+		t.Fatalf("expected one declaration, got %d", len(posted))
+	}
+	for _, attr := range kept {
+		if !strings.Contains(posted[0], `"`+attr+`"`) {
+			t.Errorf("expected %s kept", attr)
+		}
+	}
+	for _, attr := range orphans {
+		if strings.Contains(posted[0], `"`+attr+`"`) {
+			t.Errorf("expected %s removed", attr)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// workerProgress records when the worker of a workqueue got the item it is processing, between Get and Done,
+// or when it finished the last one
+type workerProgress struct {
+	lock     sync.Mutex
+	running  bool
+	inFlight time.Time
+	last     time.Time
+}
+
+// start marks the worker as running
+func (p *workerProgress) start() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.running = true
+	p.last = time.Now()
+}
+
+// begin records that the worker got an item from its workqueue
+func (p *workerProgress) begin() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.inFlight = time.Now()
+}
+
+// end records that the worker is done with its item
+func (p *workerProgress) end() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.inFlight = time.Time{}
+	p.last = time.Now()
+}
+
+// stalled returns how long the running worker is processing its item, or is idle since the last one
+func (p *workerProgress) stalled() (time.Duration, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if !p.running {
+		return 0, false
+	}
+	if !p.inFlight.IsZero() {
+		return time.Since(p.inFlight), true
+	}
+	return time.Since(p.last), false
+}
+
+// CheckCachesSynced returns an error until all of the informer caches are synced
+func (c *Controller) CheckCachesSynced() error {
+	type cacheSynced struct {
+		name      string
+		hasSynced cache.InformerSynced
+	}
+	synced := []cacheSynced{
+		{"endpoints", c.endpointsSynced},
+		{"pods", c.podsSynced},
+		{"namespaces", c.namespacesSynced},
+		{"externalServices", c.externalServicesSynced},
+		{"clusterEgressRules", c.clusterEgressRuleSynced},
+		{"namespaceEgressRules", c.namespaceEgressRuleSynced},
+		{"serviceEgressRules", c.seviceEgressRuleSynced},
+		{"externalIPRules", c.externalIPRuleSynced},
+	}
+	if c.ipPoolsSynced != nil {
+		synced = append(synced, cacheSynced{"ipPools", c.ipPoolsSynced})
+	}
+	if c.subnetsSynced != nil {
+		synced = append(synced, cacheSynced{"subnets", c.subnetsSynced})
+	}
+	for _, s := range synced {
+		if !s.hasSynced() {
+			return fmt.Errorf("%s cache is not synced", s.name)
+		}
+	}
+	return nil
+}
+
+// CheckWorkers returns an error if a worker is processing an item, or made no progress on its non-empty
+// workqueue, for the worker stuck period. The item in process is not counted by the workqueue, and the workers
+// of a standby are not checked as they do not run
+func (c *Controller) CheckWorkers() error {
+	if c.workerStuckPeriod <= 0 {
+		return nil
+	}
+	workers := []struct {
+		name     string
+		queue    workqueue.RateLimitingInterface
+		progress *workerProgress
+	}{
+		{"Endpoints", c.endpointsWorkqueue, &c.endpointsProgress},
+		{"Tenants", c.tenantWorkqueue, &c.tenantProgress},
+	}
+	for _, w := range workers {
+		stalled, inFlight := w.progress.stalled()
+		if stalled <= c.workerStuckPeriod {
+			continue
+		}
+		if inFlight {
+			return fmt.Errorf("%s worker is processing an item for %s", w.name, stalled.Round(time.Second))
+		}
+		if w.queue.Len() > 0 {
+			return fmt.Errorf("%s worker made no progress for %s with %d items queued", w.name, stalled.Round(time.Second), w.queue.Len())
+		}
+	}
+	return nil
+}
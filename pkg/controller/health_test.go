@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestCheckWorkers(t *testing.T) {
+	newController := func() *Controller {
+		c := &Controller{
+			endpointsWorkqueue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+			tenantWorkqueue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+			workerStuckPeriod:  time.Minute,
+		}
+		c.endpointsProgress.start()
+		c.tenantProgress.start()
+		return c
+	}
+
+	c := newController()
+	if err := c.CheckWorkers(); err != nil {
+		t.Errorf("unexpected error of the idle workers: %v", err)
+	}
+
+	//the item in process is not counted by the workqueue
+	c.tenantWorkqueue.Add("Common")
+	c.tenantWorkqueue.Get()
+	c.tenantProgress.begin()
+	c.tenantProgress.inFlight = time.Now().Add(-2 * time.Minute)
+	if c.tenantWorkqueue.Len() != 0 {
+		t.Fatalf("expected the empty workqueue")
+	}
+	if err := c.CheckWorkers(); err == nil {
+		t.Errorf("expected an error of the worker stuck in processing")
+	}
+	c.tenantProgress.end()
+	if err := c.CheckWorkers(); err != nil {
+		t.Errorf("unexpected error of the worker done: %v", err)
+	}
+
+	c = newController()
+	c.endpointsProgress.last = time.Now().Add(-2 * time.Minute)
+	if err := c.CheckWorkers(); err != nil {
+		t.Errorf("unexpected error of the worker idle on the empty workqueue: %v", err)
+	}
+	c.endpointsWorkqueue.Add("default/svc")
+	if err := c.CheckWorkers(); err == nil {
+		t.Errorf("expected an error of the worker not getting the queued items")
+	}
+
+	c.workerStuckPeriod = 0
+	if err := c.CheckWorkers(); err != nil {
+		t.Errorf("unexpected error with the check disabled: %v", err)
+	}
+}
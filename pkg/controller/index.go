@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/tools/cache"
+
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+)
+
+const (
+	// externalServiceNameIndex indexes the egress rules by the namespace/name of the external services
+	// they reference by externalServices
+	externalServiceNameIndex = "externalServiceName"
+
+	// externalServiceSelectorIndex indexes the egress rules with externalServiceSelector by the namespace
+	// of the external services they select
+	externalServiceSelectorIndex = "externalServiceSelector"
+)
+
+// ruleExternalServiceIndexers are the reverse indexes from the external services to the egress rules
+// referencing them, the rules of every kind referencing an external service are found by them
+var ruleExternalServiceIndexers = cache.Indexers{
+	externalServiceNameIndex:     ruleExternalServiceNameIndexFunc,
+	externalServiceSelectorIndex: ruleExternalServiceSelectorIndexFunc,
+}
+
+func externalServiceKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// getRuleExternalServices returns the namespace of the external services referenced by an egress rule,
+// its externalServices and externalServiceSelector
+func getRuleExternalServices(obj interface{}) (string, []string, bool, error) {
+	switch rule := obj.(type) {
+	case *kubeovn.ClusterEgressRule:
+		return as3.GetClusterSvcExtNamespace(), rule.Spec.ExternalServices, rule.Spec.ExternalServiceSelector != nil, nil
+	case *kubeovn.NamespaceEgressRule:
+		return rule.Namespace, rule.Spec.ExternalServices, rule.Spec.ExternalServiceSelector != nil, nil
+	case *kubeovn.ServiceEgressRule:
+		return rule.Namespace, rule.Spec.ExternalServices, rule.Spec.ExternalServiceSelector != nil, nil
+	}
+	return "", nil, false, fmt.Errorf("expected egress rule but got %#v", obj)
+}
+
+func ruleExternalServiceNameIndexFunc(obj interface{}) ([]string, error) {
+	namespace, names, _, err := getRuleExternalServices(obj)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(names))
+	for _, name := range names {
+		keys = append(keys, externalServiceKey(namespace, name))
+	}
+	return keys, nil
+}
+
+func ruleExternalServiceSelectorIndexFunc(obj interface{}) ([]string, error) {
+	namespace, _, hasSelector, err := getRuleExternalServices(obj)
+	if err != nil || !hasSelector {
+		return nil, err
+	}
+	return []string{namespace}, nil
+}
@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+)
+
+func initTestTenantConfig() {
+	as3.SetTenantConfig(as3.As3Config{
+		ClusterName:          "k8s",
+		IsSupportRouteDomain: true,
+		Tenant: []as3.TenantConfig{
+			{Name: as3.DefaultPartition},
+			{Name: "project1", Namespaces: "project1,project2"},
+			{Name: "project4", Namespaces: "project4"},
+		},
+	}, "kube-system")
+}
+
+func TestRuleExternalServiceIndexFuncs(t *testing.T) {
+	initTestTenantConfig()
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "saas"}}
+	tests := []struct {
+		name             string
+		rule             interface{}
+		expectedNames    []string
+		expectedSelector []string
+		invalid          bool
+	}{
+		{
+			name:             "cluster rule",
+			rule:             &kubeovn.ClusterEgressRule{Spec: kubeovn.ClusterEgressRuleSpec{ExternalServices: []string{"saas", "dns"}}},
+			expectedNames:    []string{"kube-system/saas", "kube-system/dns"},
+			expectedSelector: nil,
+		},
+		{
+			name:             "cluster rule with selector",
+			rule:             &kubeovn.ClusterEgressRule{Spec: kubeovn.ClusterEgressRuleSpec{ExternalServiceSelector: selector}},
+			expectedNames:    []string{},
+			expectedSelector: []string{"kube-system"},
+		},
+		{
+			name: "namespace rule",
+			rule: &kubeovn.NamespaceEgressRule{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "project1"},
+				Spec:       kubeovn.NamespaceEgressRuleSpec{ExternalServices: []string{"saas"}, ExternalServiceSelector: selector},
+			},
+			expectedNames:    []string{"project1/saas"},
+			expectedSelector: []string{"project1"},
+		},
+		{
+			name: "service rule",
+			rule: &kubeovn.ServiceEgressRule{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "project2"},
+				Spec:       kubeovn.ServiceEgressRuleSpec{ExternalServices: []string{"saas"}},
+			},
+			expectedNames: []string{"project2/saas"},
+		},
+		{
+			name:    "not a rule",
+			rule:    &kubeovn.ExternalService{},
+			invalid: true,
+		},
+	}
+	for _, test := range tests {
+		names, err := ruleExternalServiceNameIndexFunc(test.rule)
+		if (err != nil) != test.invalid {
+			t.Errorf("%s: name index error = %v, expected invalid %v", test.name, err, test.invalid)
+			continue
+		}
+		selectors, err := ruleExternalServiceSelectorIndexFunc(test.rule)
+		if (err != nil) != test.invalid {
+			t.Errorf("%s: selector index error = %v, expected invalid %v", test.name, err, test.invalid)
+			continue
+		}
+		if test.invalid {
+			continue
+		}
+		if !reflect.DeepEqual(names, test.expectedNames) {
+			t.Errorf("%s: name index = %v, expected %v", test.name, names, test.expectedNames)
+		}
+		if !reflect.DeepEqual(selectors, test.expectedSelector) {
+			t.Errorf("%s: selector index = %v, expected %v", test.name, selectors, test.expectedSelector)
+		}
+	}
+}
+
+func TestRangeExternalServiceRules(t *testing.T) {
+	initTestTenantConfig()
+	selector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "saas"}}
+	otherSelector := &metav1.LabelSelector{MatchLabels: map[string]string{"app": "other"}}
+	expired := metav1.NewTime(time.Now().Add(-time.Minute))
+	deleted := metav1.Now()
+
+	newIndexer := func(rules ...interface{}) cache.Indexer {
+		indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, ruleExternalServiceIndexers)
+		for _, rule := range rules {
+			if err := indexer.Add(rule); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return indexer
+	}
+	clusterRule := func(name string, names []string, selector *metav1.LabelSelector) *kubeovn.ClusterEgressRule {
+		return &kubeovn.ClusterEgressRule{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec:       kubeovn.ClusterEgressRuleSpec{ExternalServices: names, ExternalServiceSelector: selector},
+		}
+	}
+	nsRule := func(namespace, name string, names []string, selector *metav1.LabelSelector) *kubeovn.NamespaceEgressRule {
+		return &kubeovn.NamespaceEgressRule{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       kubeovn.NamespaceEgressRuleSpec{ExternalServices: names, ExternalServiceSelector: selector},
+		}
+	}
+	expiredRule := clusterRule("expired", []string{"saas"}, nil)
+	expiredRule.Spec.ExpiresAt = &expired
+	deletingRule := clusterRule("deleting", []string{"saas"}, nil)
+	deletingRule.DeletionTimestamp = &deleted
+
+	c := &Controller{
+		clusterEgressRuleIndexer: newIndexer(
+			clusterRule("by-name", []string{"saas"}, nil),
+			clusterRule("by-selector", nil, selector),
+			clusterRule("both", []string{"saas"}, selector),
+			clusterRule("other", []string{"other"}, otherSelector),
+			expiredRule,
+			deletingRule,
+		),
+		namespaceEgressRuleIndexer: newIndexer(
+			nsRule("project1", "by-name", []string{"saas"}, nil),
+			nsRule("project1", "other-selector", nil, otherSelector),
+			nsRule("project2", "by-name", []string{"saas"}, nil),
+			nsRule("project3", "by-name", []string{"saas"}, nil),
+		),
+		seviceEgressRuleIndexer: newIndexer(
+			&kubeovn.ServiceEgressRule{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "project1", Name: "both"},
+				Spec:       kubeovn.ServiceEgressRuleSpec{ExternalServices: []string{"saas"}, ExternalServiceSelector: selector},
+			},
+		),
+	}
+	exsvc := func(namespace string) *kubeovn.ExternalService {
+		return &kubeovn.ExternalService{ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace, Name: "saas", Labels: map[string]string{"app": "saas"},
+		}}
+	}
+
+	tests := []struct {
+		name     string
+		exsvc    *kubeovn.ExternalService
+		byName   bool
+		expected []string
+	}{
+		{
+			name:     "cluster scope",
+			exsvc:    exsvc("kube-system"),
+			byName:   true,
+			expected: []string{"global/both", "global/by-name", "global/by-selector"},
+		},
+		{
+			name:     "cluster scope by selector",
+			exsvc:    exsvc("kube-system"),
+			expected: []string{"global/both", "global/by-selector"},
+		},
+		{
+			name:     "namespace scope",
+			exsvc:    exsvc("project1"),
+			byName:   true,
+			expected: []string{"ns/by-name", "svc/both"},
+		},
+		{
+			name:     "namespace scope by selector",
+			exsvc:    exsvc("project1"),
+			expected: []string{"svc/both"},
+		},
+		{
+			name:     "namespace without tenant",
+			exsvc:    exsvc("project3"),
+			byName:   true,
+			expected: []string{},
+		},
+	}
+	for _, test := range tests {
+		found := []string{}
+		err := c.rangeExternalServiceRules(test.exsvc, test.byName, func(rule interface{}, ty, name string) {
+			found = append(found, ty+"/"+name)
+		})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		//a rule matching by both name and selector is found once
+		sort.Strings(found)
+		if !reflect.DeepEqual(found, test.expected) {
+			t.Errorf("%s: rules = %v, expected %v", test.name, found, test.expected)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+)
+
+// IPPoolResource is the calico resource of the ip pools watched by the calico namespace source
+var IPPoolResource = schema.GroupVersionResource{Group: "crd.projectcalico.org", Version: "v1", Resource: "ippools"}
+
+const (
+	// the calico ipam assigns the pod addresses of a namespace from the pools of these annotations, by their
+	// names or cidrs in a json list
+	calicoIPv4PoolsAnnotation = "cni.projectcalico.org/ipv4pools"
+	calicoIPv6PoolsAnnotation = "cni.projectcalico.org/ipv6pools"
+	// calico selects a namespace by its name as a label
+	calicoNamespaceNameLabel = "projectcalico.org/name"
+)
+
+// namespaceSource provides the source addresses of the pods of a namespace, they are the sources of the
+// namespace egress rules of the namespace and of the cluster egress rules selecting it
+type namespaceSource interface {
+	addresses(ns *corev1.Namespace) ([]string, error)
+}
+
+// getNamespaceSource returns the namespace source of the tenant of tntcfg
+func (c *Controller) getNamespaceSource(tntcfg *as3.TenantConfig) (namespaceSource, error) {
+	switch tntcfg.NamespaceSource.Type {
+	case "", as3.NamespaceSourceKubeOVN:
+		if c.subnetLister != nil {
+			return kubeOVNSubnetSource{lister: c.subnetLister}, nil
+		}
+		return annotationSource{key: as3.NamespaceCidr}, nil
+	case as3.NamespaceSourceAnnotation:
+		if tntcfg.NamespaceSource.Annotation == "" {
+			return nil, fmt.Errorf("the annotation of namespace source %s is not configured", as3.NamespaceSourceAnnotation)
+		}
+		return annotationSource{key: tntcfg.NamespaceSource.Annotation}, nil
+	case as3.NamespaceSourceCalico:
+		if c.ipPoolLister == nil {
+			return nil, fmt.Errorf("calico ip pools are not watched, restart the controller to watch them")
+		}
+		return calicoIPPoolSource{lister: c.ipPoolLister}, nil
+	case as3.NamespaceSourcePodIP:
+		return podIPSource{lister: c.podsLister}, nil
+	}
+	return nil, fmt.Errorf("unknown namespace source %q", tntcfg.NamespaceSource.Type)
+}
+
+// getNamespaceSourceConfig returns the config of the tenant namespace is mapped to, or of Common the
+// cluster egress rules selecting the unmapped namespaces are declared in
+func getNamespaceSourceConfig(namespace string) *as3.TenantConfig {
+	if tntcfg := as3.GetTenantConfigForNamespace(namespace); tntcfg != nil {
+		return tntcfg
+	}
+	return as3.GetTenantConfigForParttition(as3.DefaultPartition)
+}
+
+// getNamespaceSourceAnnotations returns the annotations of namespace its source addresses depend on
+func getNamespaceSourceAnnotations(namespace string) []string {
+	keys := []string{as3.NamespaceCidr, calicoIPv4PoolsAnnotation, calicoIPv6PoolsAnnotation}
+	if tntcfg := getNamespaceSourceConfig(namespace); tntcfg != nil && tntcfg.NamespaceSource.Annotation != "" {
+		keys = append(keys, tntcfg.NamespaceSource.Annotation)
+	}
+	return keys
+}
+
+// setNamespaceSourceAddresses sets the cidrs of the namespaces of the tenant of partition to the source
+// addresses provided by the sources of their tenants, the as3 declaration is rendered from them
+func (c *Controller) setNamespaceSourceAddresses(partition string, namespaces []as3.Namespace) error {
+	for i := range namespaces {
+		ns := &namespaces[i]
+		//the namespaces of other tenants are not declared in this one, but Common selects any of them
+		if partition != as3.DefaultPartition && !isTenantNamespace(ns.Name, partition) {
+			continue
+		}
+		addrs, err := c.getNamespaceSourceAddresses(&ns.Namespace)
+		if err != nil {
+			return err
+		}
+		ns.Cidrs = addrs
+	}
+	return nil
+}
+
+// getNamespaceSourceAddresses returns the source addresses of ns provided by the source of its tenant
+func (c *Controller) getNamespaceSourceAddresses(ns *corev1.Namespace) ([]string, error) {
+	tntcfg := getNamespaceSourceConfig(ns.Name)
+	if tntcfg == nil {
+		return nil, nil
+	}
+	source, err := c.getNamespaceSource(tntcfg)
+	if err != nil {
+		return nil, fmt.Errorf("tenant[%s]: %v", tntcfg.Name, err)
+	}
+	addrs, err := source.addresses(ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the source addresses of namespace[%s]: %v", ns.Name, err)
+	}
+	return addrs, nil
+}
+
+// annotationSource provides the cidrs in an annotation of the namespace, separated by comma
+type annotationSource struct {
+	key string
+}
+
+func (s annotationSource) addresses(ns *corev1.Namespace) ([]string, error) {
+	return as3.SplitNamespaceCidr(ns.Annotations[s.key]), nil
+}
+
+// podIPSource provides the addresses of the pods of the namespace, the host network pods are excluded as
+// they have the addresses of the nodes
+type podIPSource struct {
+	lister listersv1.PodLister
+}
+
+func (s podIPSource) addresses(ns *corev1.Namespace) ([]string, error) {
+	pods, err := s.lister.Pods(ns.Name).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	addrs := []string{}
+	for _, pod := range pods {
+		if pod.Spec.HostNetwork || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		ips := []string{pod.Status.PodIP}
+		for _, podIP := range pod.Status.PodIPs {
+			ips = append(ips, podIP.IP)
+		}
+		for _, ip := range ips {
+			if ip != "" && !seen[ip] {
+				seen[ip] = true
+				addrs = append(addrs, ip)
+			}
+		}
+	}
+	//the order of the pods in the cache is random
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// calicoIPPoolSource provides the cidrs of the calico ip pools the namespace is assigned addresses from, by
+// the pool annotations of the namespace, or else by the namespaceSelector of the enabled pools
+type calicoIPPoolSource struct {
+	lister cache.GenericLister
+}
+
+func (s calicoIPPoolSource) addresses(ns *corev1.Namespace) ([]string, error) {
+	objs, err := s.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	pools := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if pool, ok := obj.(*unstructured.Unstructured); ok {
+			pools = append(pools, pool)
+		}
+	}
+	sort.Slice(pools, func(i, j int) bool {
+		return pools[i].GetName() < pools[j].GetName()
+	})
+
+	cidrs := []string{}
+	annotated := false
+	for _, key := range []string{calicoIPv4PoolsAnnotation, calicoIPv6PoolsAnnotation} {
+		value, ok := ns.Annotations[key]
+		if !ok {
+			continue
+		}
+		annotated = true
+		names := []string{}
+		if err = json.Unmarshal([]byte(value), &names); err != nil {
+			return nil, fmt.Errorf("invalid annotation %s: %v", key, err)
+		}
+		for _, name := range names {
+			cidrs = append(cidrs, getIPPoolCidr(pools, name))
+		}
+	}
+	if annotated {
+		return as3.SplitNamespaceCidr(strings.Join(cidrs, ",")), nil
+	}
+
+	set := map[string]string{calicoNamespaceNameLabel: ns.Name}
+	for k, v := range ns.Labels {
+		set[k] = v
+	}
+	for _, pool := range pools {
+		if disabled, _, _ := unstructured.NestedBool(pool.Object, "spec", "disabled"); disabled {
+			continue
+		}
+		selector, _, _ := unstructured.NestedString(pool.Object, "spec", "namespaceSelector")
+		matched, err := matchCalicoSelector(selector, set)
+		if err != nil {
+			return nil, fmt.Errorf("ippool[%s] has invalid namespaceSelector: %v", pool.GetName(), err)
+		}
+		if !matched {
+			continue
+		}
+		if cidr, _, _ := unstructured.NestedString(pool.Object, "spec", "cidr"); cidr != "" {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs, nil
+}
+
+// getIPPoolCidr returns the cidr of the pool named name, the pool annotations may refer to a pool by its cidr
+func getIPPoolCidr(pools []*unstructured.Unstructured, name string) string {
+	for _, pool := range pools {
+		if pool.GetName() == name {
+			cidr, _, _ := unstructured.NestedString(pool.Object, "spec", "cidr")
+			return cidr
+		}
+	}
+	if strings.Contains(name, "/") {
+		return name
+	}
+	return ""
+}
+
+var (
+	calicoAllRegex      = regexp.MustCompile(`^all\(\s*\)$`)
+	calicoHasRegex      = regexp.MustCompile(`^(!?)\s*has\(\s*([\w./-]+)\s*\)$`)
+	calicoEqualRegex    = regexp.MustCompile(`^([\w./-]+)\s*(==|!=)\s*(?:'([^']*)'|"([^"]*)")$`)
+	calicoInRegex       = regexp.MustCompile(`^([\w./-]+)\s+(in|not\s+in)\s*\{(.*)\}$`)
+	calicoSelectorValue = regexp.MustCompile(`^(?:'([^']*)'|"([^"]*)")$`)
+)
+
+// matchCalicoSelector returns whether the labels of set match the calico selector, the expressions all(),
+// has(k), !has(k), k == 'v', k != 'v', k in {'v1','v2'} and k not in {'v1','v2'} joined by && are supported,
+// an empty selector matches all
+func matchCalicoSelector(selector string, set map[string]string) (bool, error) {
+	if strings.TrimSpace(selector) == "" {
+		return true, nil
+	}
+	matched := true
+	for _, expr := range strings.Split(selector, "&&") {
+		expr = strings.TrimSpace(expr)
+		switch {
+		case calicoAllRegex.MatchString(expr):
+		case calicoHasRegex.MatchString(expr):
+			m := calicoHasRegex.FindStringSubmatch(expr)
+			_, ok := set[m[2]]
+			matched = matched && ok == (m[1] == "")
+		case calicoEqualRegex.MatchString(expr):
+			m := calicoEqualRegex.FindStringSubmatch(expr)
+			value, ok := set[m[1]]
+			equal := ok && value == m[3]+m[4]
+			matched = matched && equal == (m[2] == "==")
+		case calicoInRegex.MatchString(expr):
+			m := calicoInRegex.FindStringSubmatch(expr)
+			value, ok := set[m[1]]
+			in := false
+			for _, v := range strings.Split(m[3], ",") {
+				if v = strings.TrimSpace(v); v == "" {
+					continue
+				}
+				vm := calicoSelectorValue.FindStringSubmatch(v)
+				if vm == nil {
+					return false, fmt.Errorf("invalid value %s in %q", v, expr)
+				}
+				in = in || (ok && value == vm[1]+vm[2])
+			}
+			matched = matched && in == (m[2] == "in")
+		default:
+			return false, fmt.Errorf("unsupported expression %q", expr)
+		}
+	}
+	return matched, nil
+}
+
+// enqueueIPPool enqueues every tenant, as the namespaces of any of them may be assigned addresses from the pool
+func (c *Controller) enqueueIPPool(obj interface{}) {
+	for _, partition := range as3.GetTenantPartitions() {
+		c.enqueueTenant(partition)
+	}
+}
+
+// enqueuePodNamespace queues the namespace of the pod by name on the address list queue if its tenant provides
+// the namespace addresses by the pod addresses, so the source address lists of the namespace are patched in
+// batches like the ones of the endpoints
+func (c *Controller) enqueuePodNamespace(pod *corev1.Pod) {
+	tntcfg := getNamespaceSourceConfig(pod.Namespace)
+	if tntcfg == nil || tntcfg.NamespaceSource.Type != as3.NamespaceSourcePodIP {
+		return
+	}
+	c.endpointsWorkqueue.Add(pod.Namespace)
+}
+
+// podNamespaceSyncHandler patches the source address lists of the namespace egress rules of namespace, and of
+// the cluster egress rules selecting it, to the pod addresses. The tenant is declared as a whole if a rule is
+// not synced yet, or its address list is not patched
+func (c *Controller) podNamespaceSyncHandler(namespace string) error {
+	ns, err := c.namespacesLister.Get(namespace)
+	if err != nil {
+		//the rules of the deleted namespace are removed by the namespace handlers
+		return ignoreNotFound(err)
+	}
+	if ns.DeletionTimestamp != nil {
+		return nil
+	}
+	addrs, err := c.getNamespaceSourceAddresses(ns)
+	if err != nil {
+		return err
+	}
+
+	if nsConfig := as3.GetTenantConfigForNamespace(namespace); nsConfig != nil {
+		rules, err := c.namespaceEgressRuleLister.NamespaceEgressRules(namespace).List(labels.Everything())
+		if err != nil {
+			klog.Errorf("failed to list BIG-IP namespace egress rules: %v", err)
+			return err
+		}
+		for _, rule := range rules {
+			if rule.DeletionTimestamp != nil || hasExpired(rule.Spec.ExpiresAt) {
+				continue
+			}
+			//the rule of a namespace without addresses is declared without the source address list
+			if rule.Status.Phase != kubeovn.NamespaceEgressRuleSuccess || len(addrs) == 0 {
+				c.enqueueTenant(nsConfig.Name)
+				continue
+			}
+			if err = c.addressListBatcher.UpdateNamespaceSourceAddress(addrs, nsConfig, namespace, rule.Name); err != nil {
+				klog.Warningf("failed to update the source addresses of namespaceEgressRule[%s/%s]: %v", namespace, rule.Name, err)
+				c.enqueueTenant(nsConfig.Name)
+			}
+		}
+	}
+	return c.updateClusterSourceAddresses(ns)
+}
+
+// updateClusterSourceAddresses patches the source address lists of the cluster egress rules selecting ns to the
+// addresses of the namespaces they select
+func (c *Controller) updateClusterSourceAddresses(ns *corev1.Namespace) error {
+	tntcfg := as3.GetTenantConfigForParttition(as3.DefaultPartition)
+	if tntcfg == nil {
+		return nil
+	}
+	rules, err := c.clusterEgressRuleLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BIG-IP cluster egress rules: %v", err)
+		return err
+	}
+	for _, rule := range rules {
+		if rule.Spec.NamespaceSelector == nil || rule.DeletionTimestamp != nil || hasExpired(rule.Spec.ExpiresAt) {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(rule.Spec.NamespaceSelector)
+		if err != nil || !selector.Matches(labels.Set(ns.Labels)) {
+			continue
+		}
+		if rule.Status.Phase != kubeovn.ClusterEgressRuleSuccess {
+			c.enqueueTenant(tntcfg.Name)
+			continue
+		}
+		namespaces, err := c.listSelectedNamespaces(rule.Spec.NamespaceSelector)
+		if err != nil {
+			return err
+		}
+		sort.Slice(namespaces, func(i, j int) bool {
+			return namespaces[i].Name < namespaces[j].Name
+		})
+		addrs := []string{}
+		for i := range namespaces {
+			if namespaces[i].DeletionTimestamp != nil {
+				continue
+			}
+			nsAddrs, err := c.getNamespaceSourceAddresses(&namespaces[i])
+			if err != nil {
+				return err
+			}
+			addrs = append(addrs, nsAddrs...)
+		}
+		if err = c.addressListBatcher.UpdateClusterSourceAddress(addrs, tntcfg, rule.Name); err != nil {
+			klog.Warningf("failed to update the source addresses of clusterEgressRule[%s]: %v", rule.Name, err)
+			c.enqueueTenant(tntcfg.Name)
+		}
+	}
+	return nil
+}
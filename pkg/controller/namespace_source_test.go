@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestMatchCalicoSelector(t *testing.T) {
+	set := map[string]string{"env": "prod", "team": "a", calicoNamespaceNameLabel: "project1"}
+	tests := []struct {
+		selector string
+		matched  bool
+		invalid  bool
+	}{
+		{selector: "", matched: true},
+		{selector: "all()", matched: true},
+		{selector: "has(env)", matched: true},
+		{selector: "!has(env)", matched: false},
+		{selector: "env == 'prod' && team != \"b\"", matched: true},
+		{selector: "env == 'prod' && has(tier)", matched: false},
+		{selector: "projectcalico.org/name in {'project1', 'project2'}", matched: true},
+		{selector: "team not in {'a'}", matched: false},
+		{selector: "env == 'prod' || team == 'a'", invalid: true},
+	}
+	for _, test := range tests {
+		matched, err := matchCalicoSelector(test.selector, set)
+		if (err != nil) != test.invalid {
+			t.Errorf("matchCalicoSelector(%q) error = %v, expected invalid %v", test.selector, err, test.invalid)
+			continue
+		}
+		if err == nil && matched != test.matched {
+			t.Errorf("matchCalicoSelector(%q) = %v, expected %v", test.selector, matched, test.matched)
+		}
+	}
+}
+
+func TestCalicoIPPoolSource(t *testing.T) {
+	pool := func(name, cidr, selector string, disabled bool) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"cidr": cidr, "namespaceSelector": selector, "disabled": disabled},
+		}}
+		obj.SetName(name)
+		return obj
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, obj := range []*unstructured.Unstructured{
+		pool("default-ipv4", "10.16.0.0/16", "", false),
+		pool("prod-ipv4", "10.17.0.0/16", "env == 'prod'", false),
+		pool("prod-ipv6", "fd00:10:17::/64", "env == 'prod'", false),
+		pool("old-ipv4", "10.18.0.0/16", "all()", true),
+	} {
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := calicoIPPoolSource{lister: cache.NewGenericLister(indexer, IPPoolResource.GroupResource())}
+
+	tests := []struct {
+		name     string
+		ns       *corev1.Namespace
+		expected []string
+	}{
+		{
+			name:     "selected",
+			ns:       &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "project1", Labels: map[string]string{"env": "prod"}}},
+			expected: []string{"10.16.0.0/16", "10.17.0.0/16", "fd00:10:17::/64"},
+		},
+		{
+			name:     "unselected",
+			ns:       &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "project2"}},
+			expected: []string{"10.16.0.0/16"},
+		},
+		{
+			name: "annotated",
+			ns: &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "project3", Annotations: map[string]string{
+				calicoIPv4PoolsAnnotation: `["prod-ipv4", "10.19.0.0/16", "missing"]`,
+			}}},
+			expected: []string{"10.17.0.0/16", "10.19.0.0/16"},
+		},
+	}
+	for _, test := range tests {
+		addrs, err := source.addresses(test.ns)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, test.expected) {
+			t.Errorf("%s: addresses = %v, expected %v", test.name, addrs, test.expected)
+		}
+	}
+}
@@ -2,152 +2,101 @@ package controller
 
 import (
 	"context"
-	"fmt"
+	"sort"
 
 	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/as3"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 )
 
-func (c *Controller) processNextClusterEgressRuleWorkerItem() bool {
-	obj, shutdown := c.clusterEgressRuleWorkqueue.Get()
-	if shutdown {
-		return false
+// listClusterEgressRules returns the copies of the clusterEgressRules sorted by name
+func (c *Controller) listClusterEgressRules() ([]*kubeovn.ClusterEgressRule, error) {
+	list, err := c.clusterEgressRuleLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BIG-IP cluster egress rules: %v", err)
+		return nil, err
 	}
+	rules := make([]*kubeovn.ClusterEgressRule, 0, len(list))
+	for _, r := range list {
+		rules = append(rules, r.DeepCopy())
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
+}
 
-	err := func(obj interface{}) error {
-		defer c.clusterEgressRuleWorkqueue.Done(obj)
-
-		key, err := cache.MetaNamespaceKeyFunc(obj)
-		if err != nil {
-			c.clusterEgressRuleWorkqueue.Forget(obj)
-			utilruntime.HandleError(err)
-			return err
-		}
+// addClusterEgressRuleFinalizer adds Finalizer to the undeleted rule, and returns the updated one
+func (c *Controller) addClusterEgressRuleFinalizer(rule *kubeovn.ClusterEgressRule) (*kubeovn.ClusterEgressRule, error) {
+	if rule.DeletionTimestamp != nil || !addFinalizer(rule) {
+		return rule, nil
+	}
+	return c.as3clientset.KubeovnV1alpha1().ClusterEgressRules().Update(context.Background(), rule, metav1.UpdateOptions{})
+}
 
-		var rule *kubeovn.ClusterEgressRule
-		var ok bool
-		if rule, ok = obj.(*kubeovn.ClusterEgressRule); !ok {
-			c.clusterEgressRuleWorkqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected clusterEgressRule in workqueue but got %#v", obj))
+// updateClusterEgressRule updates the rule as the tenant is declared from res, or failed to for syncErr,
+// the finalizer of the deleting rule is released as it is removed from BIG-IP
+func (c *Controller) updateClusterEgressRule(rule *kubeovn.ClusterEgressRule, res *tenantResources, tntcfg *as3.TenantConfig, syncErr error) error {
+	if rule.DeletionTimestamp != nil {
+		if syncErr != nil || !removeFinalizer(rule) {
 			return nil
 		}
-
-		if err := c.f5ClusterEgressRuleSyncHandler(key, rule); err != nil {
-			c.clusterEgressRuleWorkqueue.AddRateLimited(rule)
-			return fmt.Errorf("error syncing clusterEgressRule[%s]: %s, requeuing", key, err.Error())
+		if _, err := c.as3clientset.KubeovnV1alpha1().ClusterEgressRules().Update(context.Background(), rule, metav1.UpdateOptions{}); err != nil {
+			return ignoreNotFound(err)
 		}
-
-		c.clusterEgressRuleWorkqueue.Forget(obj)
-		klog.Infof("Successfully synced clusterEgressRule[%s]", key)
-		return nil
-	}(obj)
-
-	if err != nil {
-		utilruntime.HandleError(err)
-		return true
-	}
-	return true
-}
-
-func (c *Controller) f5ClusterEgressRuleSyncHandler(key string, rule *kubeovn.ClusterEgressRule) error {
-	_, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+		klog.Infof("clusterEgressRule[%s] is removed from BIG-IP", rule.Name)
 		return nil
 	}
-	klog.Infof("===============================>start sync clusterEgressRule[%s]", name)
-	defer klog.Infof("===============================>end sync clusterEgressRule[%s]", name)
-
-	var isDelete bool
-	var r *kubeovn.ClusterEgressRule
-	if r, err = c.clusterEgressRuleLister.Get(name); err != nil {
-		if !errors.IsNotFound(err) {
-			return err
+	//the expired rule is removed from BIG-IP, and kept
+	if hasExpired(rule.Spec.ExpiresAt) {
+		if syncErr != nil || rule.Status.Phase == kubeovn.ClusterEgressRuleExpired {
+			return nil
 		}
-		isDelete = true
-	} else {
-		rule = r
+		klog.Infof("clusterEgressRule[%s] expired at %s, removed", rule.Name, rule.Spec.ExpiresAt)
+		return c.expireClusterEgressRule(rule)
 	}
 
-	defer func() {
-		if err != nil {
-			c.recorder.Event(rule, corev1.EventTypeWarning, err.Error(), MessageResourceFailedSynced)
-		}
-	}()
-
-	externalServicesList := kubeovn.ExternalServiceList{}
-	for _, exsvcName := range rule.Spec.ExternalServices {
-		exsvc, err := c.externalServicesLister.ExternalServices(as3.GetClusterSvcExtNamespace()).Get(exsvcName)
+	status := rule.Status.DeepCopy()
+	if syncErr != nil {
+		rule.Status.Phase = kubeovn.ClusterEgressRuleSyncing
+		setFailedStatus(&rule.Status.SyncStatus, rule.Generation, syncErr)
+	} else {
+		exsvcs, err := c.listRuleExternalServices(as3.GetClusterSvcExtNamespace(), rule.Spec.ExternalServices, rule.Spec.ExternalServiceSelector)
 		if err != nil {
-			if !errors.IsNotFound(err) {
-				return err
-			}
-			klog.Warningf("externalService[%s/%s] does not exist", as3.GetClusterSvcExtNamespace(), exsvcName)
-			continue
-		}
-
-		//update ext ruleType namespace
-		if exsvc.Labels == nil {
-			exsvc.Labels = make(map[string]string, 1)
-		}
-		//delete ruleType
-		if isDelete {
-			delete(exsvc.Labels, as3.RuleTypeLabel)
-			_, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).Update(context.Background(), exsvc,
-				metav1.UpdateOptions{})
-			if err != nil {
-				return err
-			}
-		} else {
-			if exsvc.Labels[as3.RuleTypeLabel] != as3.RuleTypeGlobal {
-				exsvc.Labels[as3.RuleTypeLabel] = as3.RuleTypeGlobal
-				_, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).Update(context.Background(), exsvc,
-					metav1.UpdateOptions{})
-				if err != nil {
-					return err
-				}
-			}
+			return err
 		}
-		externalServicesList.Items = append(externalServicesList.Items, *exsvc)
+		degradedReason, degradedMessage := getExternalServicesDegraded(rule.Spec.ExternalServices, exsvcs)
+		objects := as3.GetObjectPaths(nil, nil, &kubeovn.ClusterEgressRuleList{Items: []kubeovn.ClusterEgressRule{*rule}},
+			&res.externalServices, nil, nil, nil, &res.namespaces, tntcfg)
+		rule.Status.Phase = kubeovn.ClusterEgressRuleSuccess
+		setSyncedStatus(&rule.Status.SyncStatus, rule.Generation, objects, degradedReason, degradedMessage)
 	}
-	if len(externalServicesList.Items) == 0 {
-		klog.Warningf("ExternalServices is not found in clusterEgressRule[%s/%s], no need synchronize", rule.Namespace, rule.Name)
+	if status.Phase == rule.Status.Phase && !isStatusChanged(status.SyncStatus, rule.Status.SyncStatus) {
 		return nil
 	}
-	if !isDelete && rule.Status.Phase != kubeovn.ClusterEgressRuleSyncing {
-		rule.Status.Phase = kubeovn.ClusterEgressRuleSyncing
-		rule, err = c.as3clientset.KubeovnV1alpha1().ClusterEgressRules().UpdateStatus(context.Background(), rule,
-			metav1.UpdateOptions{})
-		if err != nil {
-			return err
-		}
+	if _, err := c.as3clientset.KubeovnV1alpha1().ClusterEgressRules().UpdateStatus(context.Background(), rule, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("failed to update clusterEgressRule[%s] status: %v", rule.Name, err)
+		return ignoreNotFound(err)
 	}
-	clusterEgressruleList := kubeovn.ClusterEgressRuleList{
-		Items: []kubeovn.ClusterEgressRule{
-			*rule,
-		},
+	if syncErr != nil {
+		c.recorder.Event(rule, corev1.EventTypeWarning, FailedSynced, syncErr.Error())
+	} else {
+		c.recorder.Event(rule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	}
-	tntcfg := as3.GetTenantConfigForParttition(as3.DefaultPartition)
-	err = c.as3Client.As3Request(nil, nil, &clusterEgressruleList, &externalServicesList, nil, nil, nil,
-		tntcfg, as3.RuleTypeGlobal, isDelete)
+	return nil
+}
+
+// expireClusterEgressRule marks the removed rule as expired
+func (c *Controller) expireClusterEgressRule(rule *kubeovn.ClusterEgressRule) error {
+	rule.Status.Phase = kubeovn.ClusterEgressRuleExpired
+	setExpiredStatus(&rule.Status.SyncStatus, rule.Generation)
+	_, err := c.as3clientset.KubeovnV1alpha1().ClusterEgressRules().UpdateStatus(context.Background(), rule, metav1.UpdateOptions{})
 	if err != nil {
-		klog.Error(err)
 		return err
 	}
-
-	if !isDelete {
-		rule.Status.Phase = kubeovn.ClusterEgressRuleSuccess
-		_, err = c.as3clientset.KubeovnV1alpha1().ClusterEgressRules().UpdateStatus(context.Background(), rule, metav1.UpdateOptions{})
-		if err != nil {
-			return err
-		}
-		c.recorder.Event(rule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
-	}
+	c.recorder.Event(rule, corev1.EventTypeNormal, RuleExpired, MessageRuleExpired)
 	return nil
 }
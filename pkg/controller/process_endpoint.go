@@ -2,7 +2,10 @@ package controller
 
 import (
 	"fmt"
+	"net"
+	"strings"
 
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/as3"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
@@ -17,27 +20,22 @@ func (c *Controller) processNextEndpointsWorkItem() bool {
 	if shutdown {
 		return false
 	}
+	c.endpointsProgress.begin()
+	defer c.endpointsProgress.end()
 
 	err := func(obj interface{}) error {
 		defer c.endpointsWorkqueue.Done(obj)
 
-		key, err := cache.MetaNamespaceKeyFunc(obj)
-		if err != nil {
-			c.endpointsWorkqueue.Forget(obj)
-			utilruntime.HandleError(err)
-			return err
-		}
-
-		var ep *corev1.Endpoints
+		var key string
 		var ok bool
-		if ep, ok = obj.(*corev1.Endpoints); !ok {
+		if key, ok = obj.(string); !ok {
 			c.endpointsWorkqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected Endpoints in workqueue but got %#v", obj))
+			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
 			return nil
 		}
 
-		if err := c.endpointsSyncHandler(key, ep); err != nil {
-			c.endpointsWorkqueue.AddRateLimited(ep)
+		if err := c.endpointsSyncHandler(key); err != nil {
+			c.endpointsWorkqueue.AddRateLimited(key)
 			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
 		}
 
@@ -53,7 +51,14 @@ func (c *Controller) processNextEndpointsWorkItem() bool {
 	return true
 }
 
-func (c *Controller) endpointsSyncHandler(key string, endpoints *corev1.Endpoints) error {
+// endpointsSyncHandler patches the source address lists of the rules selecting the endpoints, the endpoints
+// without ready addresses patch the placeholders. The tenant is declared as a whole if the address list is
+// not patched
+func (c *Controller) endpointsSyncHandler(key string) error {
+	//the namespaces of the pod-ip source are queued by name
+	if !strings.Contains(key, "/") {
+		return c.podNamespaceSyncHandler(key)
+	}
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
 		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
@@ -64,14 +69,15 @@ func (c *Controller) endpointsSyncHandler(key string, endpoints *corev1.Endpoint
 		klog.Infof("namespace[%s] not in watch range ", namespace)
 		return nil
 	}
-	ep, err := c.endpointsLister.Endpoints(namespace).Get(name)
+	ep, err := c.getEndpoints(namespace, name)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			// todo: 清空as3 ip列表和端口列表?
+			//the rules of the deleted endpoints are declared without it
 			klog.Errorf("endpoint [%s/%s] not found", namespace, name)
+			c.enqueueTenant(nsConfig.Name)
 			return nil
 		}
-		klog.Errorf("failed to get endpoint [%s/%s],due to: %v", ep.Namespace, ep.Name, err)
+		klog.Errorf("failed to get endpoint [%s/%s],due to: %v", namespace, name, err)
 		return err
 	}
 	defer func() {
@@ -96,15 +102,17 @@ func (c *Controller) endpointsSyncHandler(key string, endpoints *corev1.Endpoint
 
 	nameInRule := name
 	for _, rule := range as3Rules {
-		if rule.Spec.Service == nameInRule {
-			if len(as3BigIPAddressList.Addresses) == 0 {
-				err = fmt.Errorf("endpoint[%s] subsets.addresses is nil", key)
-				klog.Error(err)
-				return err
+		if rule.Spec.Service == nameInRule && !hasExpired(rule.Spec.ExpiresAt) && rule.DeletionTimestamp == nil {
+			//the rule not declared yet for its missing endpoints has no address list to patch
+			if rule.Status.Phase != kubeovn.ServiceEgressRuleSuccess {
+				klog.Infof("serviceEgressRule[%s/%s] is not synced, declare it with endpoints[%s]", namespace, rule.Name, key)
+				c.enqueueTenant(nsConfig.Name)
+				break
 			}
 			klog.Infof("===============================>start sync endpoints[%s/%s]", namespace, name)
-			if err = c.as3Client.UpdateBigIPSourceAddress(as3BigIPAddressList, nsConfig, namespace, rule.Name, ep.Name); err != nil {
+			if err = c.addressListBatcher.UpdateBigIPSourceAddress(as3BigIPAddressList, nsConfig, namespace, rule.Name, ep.Name); err != nil {
 				klog.Warningf("===============================>end sync endpoints[%s/%s] failed: %s", namespace, name, err.Error())
+				c.enqueueTenant(nsConfig.Name)
 			} else {
 				klog.Infof("===============================>end sync endpoints[%s/%s] success", namespace, name)
 			}
@@ -113,20 +121,18 @@ func (c *Controller) endpointsSyncHandler(key string, endpoints *corev1.Endpoint
 	}
 
 	for _, eipRule := range eipRules {
+		if eipRule.DeletionTimestamp != nil {
+			continue
+		}
 		for _, svcName := range eipRule.Spec.Services {
 			if svcName != ep.Name {
 				continue
 			}
 
-			if len(as3BigIPAddressList.Addresses) == 0 {
-				err := fmt.Errorf("endpoint[%s] subsets.addresses is nil", key)
-				klog.Error(err)
-				return err
-			}
-
 			klog.Infof("===============================>start sync eipRule endpoints[%s/%s]", namespace, name)
-			if err = c.as3Client.UpdateBigIPSnatSourceAddress(as3BigIPAddressList, nsConfig, namespace, eipRule.Name, ep.Name); err != nil {
+			if err = c.addressListBatcher.UpdateBigIPSnatSourceAddress(as3BigIPAddressList, nsConfig, namespace, eipRule.Name, ep.Name); err != nil {
 				klog.Warningf("===============================>end sync eipRule endpoints[%s/%s] failed: %s", namespace, name, err.Error())
+				c.enqueueTenant(nsConfig.Name)
 			} else {
 				klog.Infof("===============================>end sync eipRule endpoints[%s/%s] success", namespace, name)
 			}
@@ -138,10 +144,17 @@ func (c *Controller) endpointsSyncHandler(key string, endpoints *corev1.Endpoint
 
 func getBigIpAddressListFromEndpoint(ep *corev1.Endpoints) as3.BigIpAddressList {
 	var list as3.BigIpAddressList
+	seen := make(map[string]bool)
 	for _, subset := range ep.Subsets {
 		for _, addr := range subset.Addresses {
+			// BIG-IP keeps IPv6 addresses in the canonical form
+			ip := net.ParseIP(addr.IP)
+			if ip == nil || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
 			list.Addresses = append(list.Addresses, as3.BigIpAddresses{
-				Name: addr.IP,
+				Name: ip.String(),
 			})
 		}
 	}
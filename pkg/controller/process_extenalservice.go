@@ -3,210 +3,220 @@ package controller
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
 	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/as3"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/api/meta"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 )
 
-func (c *Controller) processNextExternalServiceWorkItem() bool {
-	obj, shutdown := c.externalServiceWorkqueue.Get()
-	if shutdown {
-		return false
+// updateExternalService updates the external service as its tenant is declared, or failed to for syncErr,
+// the legacy finalizer of the deleting one is released as it is removed from BIG-IP
+func (c *Controller) updateExternalService(exsvc *kubeovn.ExternalService, syncErr error) error {
+	if exsvc.DeletionTimestamp != nil {
+		if syncErr != nil || !removeExternalServiceFinalizer(exsvc) {
+			return nil
+		}
+		if _, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).Update(context.Background(), exsvc, metav1.UpdateOptions{}); err != nil {
+			klog.Errorf("failed to update ExternalService [%s/%s],due to: %v", exsvc.Namespace, exsvc.Name, err)
+			return ignoreNotFound(err)
+		}
+		return nil
 	}
 
-	err := func(obj interface{}) error {
-		defer c.externalServiceWorkqueue.Done(obj)
-
-		key, err := cache.MetaNamespaceKeyFunc(obj)
+	status := exsvc.Status.DeepCopy()
+	if !verifyExtenalService(exsvc) {
+		syncErr = fmt.Errorf("The bandwidth field is invalid, one of them should be filled in %s", as3.GetIRules())
+	}
+	if syncErr != nil {
+		setFailedStatus(&exsvc.Status.SyncStatus, exsvc.Generation, syncErr)
+	} else {
+		objects, err := c.getExternalServiceObjects(exsvc)
 		if err != nil {
-			c.externalServiceWorkqueue.Forget(obj)
-			utilruntime.HandleError(err)
 			return err
 		}
-
-		var es *kubeovn.ExternalService
-		var ok bool
-		if es, ok = obj.(*kubeovn.ExternalService); !ok {
-			c.externalServiceWorkqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected ExternalService in workqueue but got %#v", obj))
-			return nil
-		}
-
-		if err := c.externalServiceSyncHandler(key, es); err != nil {
-			c.externalServiceWorkqueue.AddRateLimited(es)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		//keep the resolve failure of the dns refresher
+		degradedReason, degradedMessage := "", ""
+		if cond := meta.FindStatusCondition(exsvc.Status.Conditions, common.ConditionDegraded); cond != nil &&
+			cond.Status == metav1.ConditionTrue && cond.Reason == ReasonResolveFailed {
+			degradedReason, degradedMessage = cond.Reason, cond.Message
 		}
-
-		c.externalServiceWorkqueue.Forget(obj)
-		klog.Infof("Successfully synced '%s'", key)
+		setSyncedStatus(&exsvc.Status.SyncStatus, exsvc.Generation, objects, degradedReason, degradedMessage)
+	}
+	if !isStatusChanged(status.SyncStatus, exsvc.Status.SyncStatus) {
 		return nil
-	}(obj)
-
-	if err != nil {
-		utilruntime.HandleError(err)
-		return true
 	}
-
-	return true
+	if _, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).UpdateStatus(context.Background(), exsvc, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("failed to update externalService[%s/%s] status: %v", exsvc.Namespace, exsvc.Name, err)
+		return ignoreNotFound(err)
+	}
+	if syncErr != nil {
+		c.recorder.Event(exsvc, corev1.EventTypeWarning, FailedSynced, syncErr.Error())
+	} else {
+		c.recorder.Event(exsvc, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
+	}
+	return nil
 }
 
-func (c *Controller) externalServiceSyncHandler(key string, service *kubeovn.ExternalService) error {
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
-		return nil
+// getExternalService returns the external service of an informer event, or of its tombstone
+func getExternalService(obj interface{}) (*kubeovn.ExternalService, bool) {
+	exsvc, ok := obj.(*kubeovn.ExternalService)
+	if ok {
+		return exsvc, true
 	}
-
-	klog.Infof("===============================>start sync externalService[%s]", name)
-	defer klog.Infof("===============================>end sync externalService[%s]", name)
-
-	var isDelete bool
-	var es *kubeovn.ExternalService
-	if es, err = c.externalServicesLister.ExternalServices(namespace).Get(name); err != nil {
-		if !errors.IsNotFound(err) {
-			return err
-		}
-		isDelete = true
-		err = nil
-	} else {
-		service = es.DeepCopy()
+	tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("expected ExternalService but got %#v", obj))
+		return nil, false
+	}
+	if exsvc, ok = tombstone.Obj.(*kubeovn.ExternalService); !ok {
+		utilruntime.HandleError(fmt.Errorf("expected ExternalService in tombstone but got %#v", tombstone.Obj))
+		return nil, false
 	}
+	return exsvc, true
+}
 
-	defer func() {
-		if err != nil {
-			c.recorder.Event(service, corev1.EventTypeWarning, err.Error(), MessageResourceFailedSynced)
+// rangeExternalServiceRules calls f with the unexpired and undeleted egress rules referencing the external service by
+// externalServiceSelector, and by externalServices if byName, ty of a rule is global, ns or svc
+func (c *Controller) rangeExternalServiceRules(exsvc *kubeovn.ExternalService, byName bool, f func(rule interface{}, ty, name string)) error {
+	ruleIndexers := []struct {
+		ty      string
+		indexer cache.Indexer
+	}{
+		{"global", c.clusterEgressRuleIndexer},
+		{"ns", c.namespaceEgressRuleIndexer},
+		{"svc", c.seviceEgressRuleIndexer},
+	}
+	for _, ri := range ruleIndexers {
+		//the namespace and service egress rules are not synced without tenant
+		if ri.ty != "global" && as3.GetTenantConfigForNamespace(exsvc.Namespace) == nil {
+			continue
 		}
-	}()
-	//verify bandwidth
-	if !verifyExtenalService(service) {
-		err = fmt.Errorf("The bandwidth field is invalid, one of them should be filled in %s", as3.GetIRules())
-		return err
-	}
-	ruleType := service.Labels[as3.RuleTypeLabel]
-	find := false
-	clusterEgressruleList := kubeovn.ClusterEgressRuleList{}
-	namespaceEgressRuleList := kubeovn.NamespaceEgressRuleList{}
-	serviceEgressRuleList := kubeovn.ServiceEgressRuleList{}
-	externalServicesList := kubeovn.ExternalServiceList{
-		Items: []kubeovn.ExternalService{
-			*service,
-		},
-	}
-	namespaceList := corev1.NamespaceList{}
-	endpointList := corev1.EndpointsList{}
-	tntcfg := &as3.TenantConfig{}
-	switch ruleType {
-	case as3.RuleTypeGlobal:
-		ruleList, err := c.clusterEgressRuleLister.List(labels.Everything())
-
+		rules, err := ri.indexer.ByIndex(externalServiceSelectorIndex, exsvc.Namespace)
 		if err != nil {
 			return err
 		}
-		for _, rule := range ruleList {
-			if find {
-				break
+		if byName {
+			named, err := ri.indexer.ByIndex(externalServiceNameIndex, externalServiceKey(exsvc.Namespace, exsvc.Name))
+			if err != nil {
+				return err
 			}
-			for _, exSvc := range rule.Spec.ExternalServices {
-				if exSvc == service.Name {
-					find = true
-					clusterEgressruleList.Items = append(clusterEgressruleList.Items, *rule)
-					break
-				}
+			rules = append(rules, named...)
+		}
+		found := map[string]bool{}
+		for _, rule := range rules {
+			var names []string
+			var selector *metav1.LabelSelector
+			var expiresAt *metav1.Time
+			var meta metav1.Object
+			switch r := rule.(type) {
+			case *kubeovn.ClusterEgressRule:
+				names, selector, expiresAt, meta = r.Spec.ExternalServices, r.Spec.ExternalServiceSelector, r.Spec.ExpiresAt, r
+			case *kubeovn.NamespaceEgressRule:
+				names, selector, expiresAt, meta = r.Spec.ExternalServices, r.Spec.ExternalServiceSelector, r.Spec.ExpiresAt, r
+			case *kubeovn.ServiceEgressRule:
+				names, selector, expiresAt, meta = r.Spec.ExternalServices, r.Spec.ExternalServiceSelector, r.Spec.ExpiresAt, r
+			default:
+				continue
 			}
-		}
-		tntcfg = as3.GetTenantConfigForParttition(as3.DefaultPartition)
-	case as3.RuleTypeNamespace:
-		ruleList, err := c.namespaceEgressRuleLister.NamespaceEgressRules(service.Namespace).List(labels.Everything())
-		if err != nil {
-			return err
-		}
-		for _, rule := range ruleList {
-			if find {
-				break
+			if found[meta.GetName()] || hasExpired(expiresAt) || meta.GetDeletionTimestamp() != nil {
+				continue
 			}
-			for _, exSvc := range rule.Spec.ExternalServices {
-				if exSvc == service.Name {
-					find = true
-					namespaceEgressRuleList.Items = append(namespaceEgressRuleList.Items, *rule)
-					break
-				}
+			if !byName {
+				names = nil
+			}
+			if as3.MatchExternalService(names, selector, exsvc) {
+				found[meta.GetName()] = true
+				f(rule, ri.ty, meta.GetName())
 			}
 		}
-		ns, err := c.kubeclientset.CoreV1().Namespaces().Get(context.Background(), service.Namespace, metav1.GetOptions{})
-		if err != nil {
-			klog.Errorf("failed to get namespace[%s],due to: %v", service.Namespace, err)
-			return err
-		}
-		namespaceList.Items = []corev1.Namespace{
-			*ns,
+	}
+	return nil
+}
+
+// getExternalServiceObjects returns the paths of the BIG-IP objects declared for the external service
+// by the egress rules referencing it
+func (c *Controller) getExternalServiceObjects(exsvc *kubeovn.ExternalService) ([]string, error) {
+	var objects []string
+	err := c.rangeExternalServiceRules(exsvc, true, func(rule interface{}, ty, name string) {
+		objects = append(objects, as3.GetExternalServiceObjectPaths(ty, exsvc.Namespace, name, *exsvc)...)
+	})
+	sort.Strings(objects)
+	return objects, err
+}
+
+// getExternalServicesDegraded returns why an egress rule is degraded by the external services it references,
+// exsvcs are the ones found
+func getExternalServicesDegraded(names []string, exsvcs []*kubeovn.ExternalService) (string, string) {
+	found := make(map[string]bool, len(exsvcs))
+	for _, exsvc := range exsvcs {
+		found[exsvc.Name] = true
+	}
+	missing := []string{}
+	for _, name := range names {
+		if !found[name] {
+			missing = append(missing, name)
 		}
-		tntcfg = as3.GetTenantConfigForNamespace(service.Namespace)
-	case as3.RuleTypeService:
-		ruleList, err := c.seviceEgressRuleLister.ServiceEgressRules(service.Namespace).List(labels.Everything())
+	}
+	if len(missing) != 0 {
+		return ReasonExternalServiceNotFound, fmt.Sprintf("externalServices %s not found", strings.Join(missing, ","))
+	}
+	if len(exsvcs) == 0 {
+		return ReasonExternalServiceNotFound, "no externalService is referenced"
+	}
+	return "", ""
+}
+
+// listRuleExternalServices returns the external services in namespace referenced by names or selector of egress rule
+func (c *Controller) listRuleExternalServices(namespace string, names []string, selector *metav1.LabelSelector) ([]*kubeovn.ExternalService, error) {
+	exsvcs := []*kubeovn.ExternalService{}
+	found := map[string]bool{}
+	for _, exsvcName := range names {
+		exsvc, err := c.externalServicesLister.ExternalServices(namespace).Get(exsvcName)
 		if err != nil {
-			return err
-		}
-		for _, rule := range ruleList {
-			if find {
-				break
-			}
-			for _, exSvc := range rule.Spec.ExternalServices {
-				if exSvc == service.Name {
-					find = true
-					serviceEgressRuleList.Items = append(serviceEgressRuleList.Items, *rule)
-					break
-				}
+			if !errors.IsNotFound(err) {
+				return nil, err
 			}
+			klog.Warningf("externalService[%s/%s] does not exist", namespace, exsvcName)
+			continue
 		}
-		if find {
-			epName := serviceEgressRuleList.Items[0].Spec.Service
-			ep, err := c.endpointsLister.Endpoints(service.Namespace).Get(epName)
-			if err != nil {
-				klog.Errorf("failed to get endpoint [%s/%s],due to: %v", service.Namespace, epName, err)
-				return err
-			}
-			endpointList.Items = []corev1.Endpoints{
-				*ep,
-			}
+		//a deleting external service is removed from the rules at once
+		if exsvc.DeletionTimestamp != nil {
+			klog.Warningf("externalService[%s/%s] is deleting", namespace, exsvcName)
+			continue
 		}
-		tntcfg = as3.GetTenantConfigForNamespace(service.Namespace)
-	default:
-		if service.DeletionTimestamp != nil {
-			service.Finalizers = nil
-			_, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(service.Namespace).Update(context.Background(), service, metav1.UpdateOptions{})
-			if err != nil {
-				klog.Errorf("failed to update ExternalService [%s/%s],due to: %v", service.Namespace, service.Name, err)
-			}
+		if !found[exsvc.Name] {
+			found[exsvc.Name] = true
+			exsvcs = append(exsvcs, exsvc)
 		}
-		klog.Info("don,t neet sync!")
-		return nil
 	}
-	if service.DeletionTimestamp != nil {
-		klog.Info("wait egress rule update label!")
-		return fmt.Errorf("ExternalService[%s/%s] is deleting", service.Namespace, service.Name)
+	if selector == nil {
+		return exsvcs, nil
 	}
-
-	if len(serviceEgressRuleList.Items) == 0 && len(namespaceEgressRuleList.Items) == 0 && len(clusterEgressruleList.Items) == 0 {
-		klog.Info("not found Associated rules，don,t neet sync!!")
-		return nil
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid externalServiceSelector: %v", err)
 	}
-	err = c.as3Client.As3Request(&serviceEgressRuleList, &namespaceEgressRuleList, &clusterEgressruleList, &externalServicesList, nil, &endpointList, &namespaceList,
-		tntcfg, ruleType, isDelete)
+	selected, err := c.externalServicesLister.ExternalServices(namespace).List(sel)
 	if err != nil {
-		klog.Error(err)
-		return err
+		return nil, err
 	}
-	c.recorder.Event(service, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
-	return nil
+	for _, exsvc := range selected {
+		if !found[exsvc.Name] && exsvc.DeletionTimestamp == nil {
+			found[exsvc.Name] = true
+			exsvcs = append(exsvcs, exsvc)
+		}
+	}
+	return exsvcs, nil
 }
 
 func verifyExtenalService(exsvc *kubeovn.ExternalService) bool {
@@ -1,118 +1,84 @@
 package controller
 
 import (
-	"fmt"
+	"context"
+	"sort"
 
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/client-go/tools/cache"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 
 	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/as3"
 )
 
-func (c *Controller) processNextExternalIPRuleWorkItem() bool {
-	obj, shutdown := c.externalIPRuleWorkQueue.Get()
-	if shutdown {
-		return false
+// listExternalIPRules returns the copies of the externalIPRules of the tenant of partition sorted by namespace
+// and name
+func (c *Controller) listExternalIPRules(partition string) ([]*snat.ExternalIPRule, error) {
+	list, err := c.externalIPRuleLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BIG-IP external ip rules: %v", err)
+		return nil, err
 	}
-
-	err := func(obj interface{}) error {
-		defer c.externalIPRuleWorkQueue.Done(obj)
-
-		key, err := cache.MetaNamespaceKeyFunc(obj)
-		if err != nil {
-			c.externalIPRuleWorkQueue.Forget(obj)
-			utilruntime.HandleError(err)
-			return err
-		}
-
-		var eipRule *snat.ExternalIPRule
-		var ok bool
-		if eipRule, ok = obj.(*snat.ExternalIPRule); !ok {
-			c.externalIPRuleWorkQueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected ExternalIPRule in workqueue but got %#v", obj))
-			return nil
+	rules := make([]*snat.ExternalIPRule, 0, len(list))
+	for _, r := range list {
+		if !isTenantNamespace(r.Namespace, partition) {
+			continue
 		}
-
-		if err := c.externalIPRuleSyncHandler(key, eipRule); err != nil {
-			c.externalIPRuleWorkQueue.AddRateLimited(eipRule)
-			return fmt.Errorf("error syncing '%s': %s, requeuing", key, err.Error())
+		rules = append(rules, r.DeepCopy())
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Namespace != rules[j].Namespace {
+			return rules[i].Namespace < rules[j].Namespace
 		}
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
+}
 
-		c.externalIPRuleWorkQueue.Forget(obj)
-		klog.Infof("Successfully synced '%s'", key)
-		return nil
-	}(obj)
-
-	if err != nil {
-		utilruntime.HandleError(err)
-		return true
+// addExternalIPRuleFinalizer adds Finalizer to the undeleted rule, and returns the updated one
+func (c *Controller) addExternalIPRuleFinalizer(rule *snat.ExternalIPRule) (*snat.ExternalIPRule, error) {
+	if rule.DeletionTimestamp != nil || !addFinalizer(rule) {
+		return rule, nil
 	}
-
-	return true
+	return c.as3clientset.BigipV1alpha1().ExternalIPRules(rule.Namespace).Update(context.Background(), rule, metav1.UpdateOptions{})
 }
 
-func (c *Controller) externalIPRuleSyncHandler(key string, eipRule *snat.ExternalIPRule) error {
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
+// updateExternalIPRule updates the rule as the tenant is declared from res, or failed to for syncErr,
+// the finalizer of the deleting rule is released as it is removed from BIG-IP
+func (c *Controller) updateExternalIPRule(eipRule *snat.ExternalIPRule, res *tenantResources, tntcfg *as3.TenantConfig, syncErr error) error {
+	if eipRule.DeletionTimestamp != nil {
+		if syncErr != nil || !removeFinalizer(eipRule) {
+			return nil
+		}
+		if _, err := c.as3clientset.BigipV1alpha1().ExternalIPRules(eipRule.Namespace).Update(context.Background(), eipRule, metav1.UpdateOptions{}); err != nil {
+			return ignoreNotFound(err)
+		}
+		klog.Infof("externalIPRule[%s/%s] is removed from BIG-IP", eipRule.Namespace, eipRule.Name)
 		return nil
 	}
 
-	klog.Infof("===============================>start sync externalIPRule[%s]", name)
-	defer klog.Infof("===============================>end sync externalIPRule[%s]", name)
-
-	var isDelete bool
-	var rule *snat.ExternalIPRule
-	if rule, err = c.externalIPRuleLister.ExternalIPRules(namespace).Get(name); err != nil {
-		if !errors.IsNotFound(err) {
-			return err
-		}
-		isDelete = true
-		err = nil
+	status := eipRule.Status.DeepCopy()
+	if syncErr != nil {
+		setFailedStatus(&eipRule.Status.SyncStatus, eipRule.Generation, syncErr)
 	} else {
-		eipRule = rule
+		objects := as3.GetObjectPaths(nil, nil, nil, nil, &snat.ExternalIPRuleList{Items: []snat.ExternalIPRule{*eipRule}},
+			&res.endpoints, nil, nil, tntcfg)
+		setSyncedStatus(&eipRule.Status.SyncStatus, eipRule.Generation, objects, "", "")
 	}
-
-	defer func() {
-		if err != nil {
-			c.recorder.Event(eipRule, corev1.EventTypeWarning, err.Error(), MessageResourceFailedSynced)
-		}
-	}()
-
-	endpointList := &corev1.EndpointsList{
-		Items: make([]corev1.Endpoints, 0, len(eipRule.Spec.Services)),
-	}
-	for _, svcName := range eipRule.Spec.Services {
-		ep, err := c.endpointsLister.Endpoints(eipRule.Namespace).Get(svcName)
-		if err != nil {
-			klog.Errorf("get endpoint %s/%s error: %s", eipRule.Namespace, svcName, err.Error())
-			continue
-		}
-
-		epCopy := ep.DeepCopy()
-		endpointList.Items = append(endpointList.Items, *epCopy)
+	if !isStatusChanged(status.SyncStatus, eipRule.Status.SyncStatus) {
+		return nil
 	}
-
-	eipRuleCopy := eipRule.DeepCopy()
-	eipRuleList := &snat.ExternalIPRuleList{
-		Items: []snat.ExternalIPRule{
-			*eipRuleCopy,
-		},
+	if _, err := c.as3clientset.BigipV1alpha1().ExternalIPRules(eipRule.Namespace).UpdateStatus(context.Background(), eipRule, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("failed to update externalIPRule[%s/%s] status: %v", eipRule.Namespace, eipRule.Name, err)
+		return ignoreNotFound(err)
 	}
-
-	tntcfg := as3.GetTenantConfigForNamespace(namespace)
-	err = c.as3Client.As3Request(nil, nil, nil, nil, eipRuleList, endpointList, nil,
-		tntcfg, "", isDelete)
-	if err != nil {
-		klog.Error(err)
-		return err
+	if syncErr != nil {
+		c.recorder.Event(eipRule, corev1.EventTypeWarning, FailedSynced, syncErr.Error())
+	} else {
+		c.recorder.Event(eipRule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	}
-
-	c.recorder.Event(eipRule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	return nil
 }
 
@@ -121,7 +87,7 @@ func (c *Controller) getEndpointIPsWithExternalIPRule(eipRule *snat.ExternalIPRu
 	var ips []string
 	for _, svcName := range eipRule.Spec.Services {
 		// svcName和epName相同
-		ep, err := c.endpointsLister.Endpoints(eipRule.Namespace).Get(svcName)
+		ep, err := c.getEndpoints(eipRule.Namespace, svcName)
 		if err != nil {
 			// 这里报错一般是不存在，忽略即可
 			continue
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// enqueueNamespace enqueues the tenant the namespace is mapped to, whose rules use the cidr of the namespace and
+// are removed as it is deleted, and the clusterEgressRules whose namespaceSelector matches the namespace
+func (c *Controller) enqueueNamespace(obj interface{}) {
+	ns, ok := obj.(*corev1.Namespace)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("expected Namespace but got %#v", obj))
+			return
+		}
+		if ns, ok = tombstone.Obj.(*corev1.Namespace); !ok {
+			utilruntime.HandleError(fmt.Errorf("expected Namespace in tombstone but got %#v", tombstone.Obj))
+			return
+		}
+	}
+	c.enqueueNamespaceTenant(ns.Name)
+
+	rules, err := c.clusterEgressRuleLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BIG-IP cluster egress rules: %v", err)
+		return
+	}
+	for _, rule := range rules {
+		if rule.Spec.NamespaceSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(rule.Spec.NamespaceSelector)
+		if err != nil {
+			klog.Errorf("clusterEgressRule[%s] has invalid namespaceSelector: %v", rule.Name, err)
+			continue
+		}
+		if selector.Matches(labels.Set(ns.Labels)) {
+			c.enqueueClusterEgressRule(rule)
+		}
+	}
+}
+
+// listSelectedNamespaces returns the namespaces matched by namespaceSelector
+func (c *Controller) listSelectedNamespaces(namespaceSelector *metav1.LabelSelector) ([]corev1.Namespace, error) {
+	selector, err := metav1.LabelSelectorAsSelector(namespaceSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid namespaceSelector: %v", err)
+	}
+	nsList, err := c.namespacesLister.List(selector)
+	if err != nil {
+		klog.Errorf("failed to list namespaces,due to: %v", err)
+		return nil, err
+	}
+	items := make([]corev1.Namespace, 0, len(nsList))
+	for _, ns := range nsList {
+		items = append(items, *ns)
+	}
+	return items, nil
+}
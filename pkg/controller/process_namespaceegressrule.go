@@ -2,173 +2,108 @@ package controller
 
 import (
 	"context"
-	"fmt"
+	"sort"
 
 	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/as3"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 )
 
-func (c *Controller) processNextNamespaceEgressRuleWorkerItem() bool {
-	obj, shutdown := c.namespaceEgressRuleWorkqueue.Get()
-	if shutdown {
-		return false
+// listNamespaceEgressRules returns the copies of the namespaceEgressRules of the tenant of partition sorted
+// by namespace and name
+func (c *Controller) listNamespaceEgressRules(partition string) ([]*kubeovn.NamespaceEgressRule, error) {
+	list, err := c.namespaceEgressRuleLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BIG-IP namespace egress rules: %v", err)
+		return nil, err
 	}
-
-	err := func(obj interface{}) error {
-		defer c.namespaceEgressRuleWorkqueue.Done(obj)
-
-		key, err := cache.MetaNamespaceKeyFunc(obj)
-		if err != nil {
-			c.namespaceEgressRuleWorkqueue.Forget(obj)
-			utilruntime.HandleError(err)
-			return err
-		}
-
-		var rule *kubeovn.NamespaceEgressRule
-		var ok bool
-		if rule, ok = obj.(*kubeovn.NamespaceEgressRule); !ok {
-			c.namespaceEgressRuleWorkqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected NamespaceEgressRule in workqueue but got %#v", obj))
-			return nil
-		}
-
-		if err := c.namespaceEgressRuleSyncHandler(key, rule); err != nil {
-			c.namespaceEgressRuleWorkqueue.AddRateLimited(rule)
-			return fmt.Errorf("error syncing namespaceEgressRule[%s]: %s, requeuing", key, err.Error())
+	rules := make([]*kubeovn.NamespaceEgressRule, 0, len(list))
+	for _, r := range list {
+		if !isTenantNamespace(r.Namespace, partition) {
+			continue
 		}
-
-		c.namespaceEgressRuleWorkqueue.Forget(obj)
-		klog.Infof("Successfully synced namespaceEgressRule[%s]", key)
-		return nil
-	}(obj)
-
-	if err != nil {
-		utilruntime.HandleError(err)
-		return true
+		rules = append(rules, r.DeepCopy())
 	}
-	return true
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Namespace != rules[j].Namespace {
+			return rules[i].Namespace < rules[j].Namespace
+		}
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
 }
 
-func (c *Controller) namespaceEgressRuleSyncHandler(key string, rule *kubeovn.NamespaceEgressRule) error {
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
-		return nil
-	}
-
-	nsConfig := as3.GetTenantConfigForNamespace(namespace)
-	if nsConfig == nil {
-		klog.Infof("namespace[%s] not in watch range ", namespace)
-		return nil
+// addNamespaceEgressRuleFinalizer adds Finalizer to the undeleted rule, and returns the updated one
+func (c *Controller) addNamespaceEgressRuleFinalizer(rule *kubeovn.NamespaceEgressRule) (*kubeovn.NamespaceEgressRule, error) {
+	if rule.DeletionTimestamp != nil || !addFinalizer(rule) {
+		return rule, nil
 	}
+	return c.as3clientset.KubeovnV1alpha1().NamespaceEgressRules(rule.Namespace).Update(context.Background(), rule, metav1.UpdateOptions{})
+}
 
-	klog.Infof("===============================>start sync namespaceEgressRule[%s/%s]", namespace, name)
-	defer klog.Infof("===============================>end sync namespaceEgressRule[%s/%s]", namespace, name)
-
-	var isDelete bool
-	var r *kubeovn.NamespaceEgressRule
-	if r, err = c.namespaceEgressRuleLister.NamespaceEgressRules(namespace).Get(name); err != nil {
-		if !errors.IsNotFound(err) {
-			return err
+// updateNamespaceEgressRule updates the rule as the tenant is declared from res, or failed to for syncErr,
+// the finalizer of the deleting rule is released as it is removed from BIG-IP
+func (c *Controller) updateNamespaceEgressRule(rule *kubeovn.NamespaceEgressRule, res *tenantResources, tntcfg *as3.TenantConfig, syncErr error) error {
+	if rule.DeletionTimestamp != nil {
+		if syncErr != nil || !removeFinalizer(rule) {
+			return nil
 		}
-		isDelete = true
-	} else {
-		rule = r
+		if _, err := c.as3clientset.KubeovnV1alpha1().NamespaceEgressRules(rule.Namespace).Update(context.Background(), rule, metav1.UpdateOptions{}); err != nil {
+			return ignoreNotFound(err)
+		}
+		klog.Infof("namespaceEgressRule[%s/%s] is removed from BIG-IP", rule.Namespace, rule.Name)
+		return nil
 	}
-
-	defer func() {
-		if err != nil {
-			c.recorder.Event(rule, corev1.EventTypeWarning, err.Error(), MessageResourceFailedSynced)
+	//the expired rule is removed from BIG-IP, and kept
+	if hasExpired(rule.Spec.ExpiresAt) {
+		if syncErr != nil || rule.Status.Phase == kubeovn.NamespaceEgressRuleExpired {
+			return nil
 		}
-	}()
-
-	ns, err := c.kubeclientset.CoreV1().Namespaces().Get(context.Background(), namespace, metav1.GetOptions{})
-	if err != nil {
-		klog.Errorf("failed to get namespace[%s],due to: %v", namespace, err)
-		return err
+		klog.Infof("namespaceEgressRule[%s/%s] expired at %s, removed", rule.Namespace, rule.Name, rule.Spec.ExpiresAt)
+		return c.expireNamespaceEgressRule(rule)
 	}
-	externalServicesList := kubeovn.ExternalServiceList{}
-	//set source address, ns subnet
 
-	namespaceList := corev1.NamespaceList{
-		Items: []corev1.Namespace{
-			*ns,
-		},
-	}
-	for _, exsvcName := range rule.Spec.ExternalServices {
-		exsvc, err := c.externalServicesLister.ExternalServices(rule.Namespace).Get(exsvcName)
+	status := rule.Status.DeepCopy()
+	if syncErr != nil {
+		rule.Status.Phase = kubeovn.NamespaceEgressRuleSyncing
+		setFailedStatus(&rule.Status.SyncStatus, rule.Generation, syncErr)
+	} else {
+		exsvcs, err := c.listRuleExternalServices(rule.Namespace, rule.Spec.ExternalServices, rule.Spec.ExternalServiceSelector)
 		if err != nil {
-			if !errors.IsNotFound(err) {
-				return err
-			}
-			klog.Warningf("externalService[%s/%s] does not exist", rule.Namespace, exsvcName)
-			continue
-		}
-
-		//update ext ruleType namespace
-		if exsvc.Labels == nil {
-			exsvc.Labels = make(map[string]string, 1)
-		}
-
-		//delete ruleType
-		if isDelete {
-			delete(exsvc.Labels, as3.RuleTypeLabel)
-			_, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).Update(context.Background(), exsvc,
-				metav1.UpdateOptions{})
-			if err != nil {
-				return err
-			}
-		} else {
-			if exsvc.Labels[as3.RuleTypeLabel] != as3.RuleTypeNamespace {
-				exsvc.Labels[as3.RuleTypeLabel] = as3.RuleTypeNamespace
-				_, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).Update(context.Background(), exsvc,
-					metav1.UpdateOptions{})
-				if err != nil {
-					return err
-				}
-			}
+			return err
 		}
-		externalServicesList.Items = append(externalServicesList.Items, *exsvc)
+		degradedReason, degradedMessage := getExternalServicesDegraded(rule.Spec.ExternalServices, exsvcs)
+		objects := as3.GetObjectPaths(nil, &kubeovn.NamespaceEgressRuleList{Items: []kubeovn.NamespaceEgressRule{*rule}}, nil,
+			&res.externalServices, nil, nil, nil, &res.namespaces, tntcfg)
+		rule.Status.Phase = kubeovn.NamespaceEgressRuleSuccess
+		setSyncedStatus(&rule.Status.SyncStatus, rule.Generation, objects, degradedReason, degradedMessage)
 	}
-	if len(externalServicesList.Items) == 0 {
-		klog.Warningf("ExternalServices is not found in namespaceEgressRules[%s/%s], no need synchronize", rule.Namespace, rule.Name)
+	if status.Phase == rule.Status.Phase && !isStatusChanged(status.SyncStatus, rule.Status.SyncStatus) {
 		return nil
 	}
-	if !isDelete && rule.Status.Phase != kubeovn.NamespaceEgressRuleSyncing {
-		rule.Status.Phase = kubeovn.NamespaceEgressRuleSyncing
-		rule, err = c.as3clientset.KubeovnV1alpha1().NamespaceEgressRules(namespace).UpdateStatus(context.Background(), rule,
-			v1.UpdateOptions{})
-		if err != nil {
-			return err
-		}
+	if _, err := c.as3clientset.KubeovnV1alpha1().NamespaceEgressRules(rule.Namespace).UpdateStatus(context.Background(), rule, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("failed to update namespaceEgressRule[%s/%s] status: %v", rule.Namespace, rule.Name, err)
+		return ignoreNotFound(err)
 	}
-	namespaceEgressruleList := kubeovn.NamespaceEgressRuleList{
-		Items: []kubeovn.NamespaceEgressRule{
-			*rule,
-		},
+	if syncErr != nil {
+		c.recorder.Event(rule, corev1.EventTypeWarning, FailedSynced, syncErr.Error())
+	} else {
+		c.recorder.Event(rule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	}
-	tntcfg := as3.GetTenantConfigForNamespace(namespace)
-	err = c.as3Client.As3Request(nil, &namespaceEgressruleList, nil, &externalServicesList, nil, nil, &namespaceList,
-		tntcfg, as3.RuleTypeNamespace, isDelete)
+	return nil
+}
+
+// expireNamespaceEgressRule marks the removed rule as expired
+func (c *Controller) expireNamespaceEgressRule(rule *kubeovn.NamespaceEgressRule) error {
+	rule.Status.Phase = kubeovn.NamespaceEgressRuleExpired
+	setExpiredStatus(&rule.Status.SyncStatus, rule.Generation)
+	_, err := c.as3clientset.KubeovnV1alpha1().NamespaceEgressRules(rule.Namespace).UpdateStatus(context.Background(), rule, metav1.UpdateOptions{})
 	if err != nil {
-		klog.Error(err)
 		return err
 	}
-
-	if !isDelete {
-		rule.Status.Phase = kubeovn.NamespaceEgressRuleSuccess
-		_, err = c.as3clientset.KubeovnV1alpha1().NamespaceEgressRules(namespace).UpdateStatus(context.Background(), rule, v1.UpdateOptions{})
-		if err != nil {
-			return err
-		}
-		c.recorder.Event(rule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
-	}
+	c.recorder.Event(rule, corev1.EventTypeNormal, RuleExpired, MessageRuleExpired)
 	return nil
 }
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// enqueuePod enqueues the serviceEgressRules whose podSelector matches the pod, and the namespace of the pod
+// if its addresses are the source of the namespace
+func (c *Controller) enqueuePod(obj interface{}) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		tombstone, ok := obj.(cache.DeletedFinalStateUnknown)
+		if !ok {
+			utilruntime.HandleError(fmt.Errorf("expected Pod but got %#v", obj))
+			return
+		}
+		if pod, ok = tombstone.Obj.(*corev1.Pod); !ok {
+			utilruntime.HandleError(fmt.Errorf("expected Pod in tombstone but got %#v", tombstone.Obj))
+			return
+		}
+	}
+	c.enqueuePodNamespace(pod)
+	if as3.GetTenantConfigForNamespace(pod.Namespace) == nil {
+		return
+	}
+
+	rules, err := c.seviceEgressRuleLister.ServiceEgressRules(pod.Namespace).List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BIG-IP service egress rules: %v", err)
+		return
+	}
+	for _, rule := range rules {
+		if rule.Spec.PodSelector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(rule.Spec.PodSelector)
+		if err != nil {
+			klog.Errorf("serviceEgressRule[%s/%s] has invalid podSelector: %v", rule.Namespace, rule.Name, err)
+			continue
+		}
+		if selector.Matches(labels.Set(pod.Labels)) {
+			c.enqueueSeviceEgressRule(rule)
+		}
+	}
+}
+
+// listRulePods returns the pods selected by the podSelector of serviceEgressRule
+func (c *Controller) listRulePods(rule *kubeovn.ServiceEgressRule) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(rule.Spec.PodSelector)
+	if err != nil {
+		return nil, fmt.Errorf("serviceEgressRule[%s/%s] has invalid podSelector: %v", rule.Namespace, rule.Name, err)
+	}
+	pods, err := c.podsLister.Pods(rule.Namespace).List(selector)
+	if err != nil {
+		klog.Errorf("failed to list pods in namespace[%s],due to: %v", rule.Namespace, err)
+		return nil, err
+	}
+	items := make([]corev1.Pod, 0, len(pods))
+	for _, pod := range pods {
+		items = append(items, *pod)
+	}
+	return items, nil
+}
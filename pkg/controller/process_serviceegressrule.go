@@ -2,175 +2,108 @@ package controller
 
 import (
 	"context"
-	"fmt"
+	"sort"
 
 	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
 	"github.com/kubeovn/ces-controller/pkg/as3"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/client-go/tools/cache"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/klog/v2"
 )
 
-func (c *Controller) processNextSeviceEgressRuleWorkerItem() bool {
-	obj, shutdown := c.seviceEgressRuleWorkqueue.Get()
-	if shutdown {
-		return false
+// listServiceEgressRules returns the copies of the serviceEgressRules of the tenant of partition sorted
+// by namespace and name
+func (c *Controller) listServiceEgressRules(partition string) ([]*kubeovn.ServiceEgressRule, error) {
+	list, err := c.seviceEgressRuleLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list BIG-IP service egress rules: %v", err)
+		return nil, err
 	}
-
-	err := func(obj interface{}) error {
-		defer c.seviceEgressRuleWorkqueue.Done(obj)
-
-		key, err := cache.MetaNamespaceKeyFunc(obj)
-		if err != nil {
-			c.seviceEgressRuleWorkqueue.Forget(obj)
-			utilruntime.HandleError(err)
-			return err
-		}
-
-		var rule *kubeovn.ServiceEgressRule
-		var ok bool
-		if rule, ok = obj.(*kubeovn.ServiceEgressRule); !ok {
-			c.seviceEgressRuleWorkqueue.Forget(obj)
-			utilruntime.HandleError(fmt.Errorf("expected seviceEgressRuleWorkqueue in workqueue but got %#v", obj))
-			return nil
-		}
-
-		if err := c.serviceEgressRuleSyncHandler(key, rule); err != nil {
-			c.seviceEgressRuleWorkqueue.AddRateLimited(rule)
-			return fmt.Errorf("error syncing serviceEgressRule[%s]: %s, requeuing", key, err.Error())
+	rules := make([]*kubeovn.ServiceEgressRule, 0, len(list))
+	for _, r := range list {
+		if !isTenantNamespace(r.Namespace, partition) {
+			continue
 		}
-
-		c.seviceEgressRuleWorkqueue.Forget(obj)
-		klog.Infof("Successfully synced serviceEgressRule[%s]", key)
-		return nil
-	}(obj)
-
-	if err != nil {
-		utilruntime.HandleError(err)
-		return true
+		rules = append(rules, r.DeepCopy())
 	}
-
-	return true
+	sort.Slice(rules, func(i, j int) bool {
+		if rules[i].Namespace != rules[j].Namespace {
+			return rules[i].Namespace < rules[j].Namespace
+		}
+		return rules[i].Name < rules[j].Name
+	})
+	return rules, nil
 }
 
-func (c *Controller) serviceEgressRuleSyncHandler(key string, rule *kubeovn.ServiceEgressRule) error {
-	namespace, name, err := cache.SplitMetaNamespaceKey(key)
-	if err != nil {
-		utilruntime.HandleError(fmt.Errorf("invalid resource key: %s", key))
-		return nil
-	}
-
-	nsConfig := as3.GetTenantConfigForNamespace(namespace)
-	if nsConfig == nil {
-		klog.Infof("namespace[%s] not in watch range ", namespace)
-		return nil
+// addServiceEgressRuleFinalizer adds Finalizer to the undeleted rule, and returns the updated one
+func (c *Controller) addServiceEgressRuleFinalizer(rule *kubeovn.ServiceEgressRule) (*kubeovn.ServiceEgressRule, error) {
+	if rule.DeletionTimestamp != nil || !addFinalizer(rule) {
+		return rule, nil
 	}
+	return c.as3clientset.KubeovnV1alpha1().ServiceEgressRules(rule.Namespace).Update(context.Background(), rule, metav1.UpdateOptions{})
+}
 
-	klog.Infof("===============================>start sync serviceEgressRule[%s/%s]", namespace, name)
-	defer klog.Infof("===============================>end sync serviceEgressRule[%s/%s]", namespace, name)
-
-	var isDelete bool
-	var r *kubeovn.ServiceEgressRule
-	if r, err = c.seviceEgressRuleLister.ServiceEgressRules(namespace).Get(name); err != nil {
-		if !errors.IsNotFound(err) {
-			return err
+// updateServiceEgressRule updates the rule as the tenant is declared from res, or failed to for syncErr,
+// the finalizer of the deleting rule is released as it is removed from BIG-IP
+func (c *Controller) updateServiceEgressRule(rule *kubeovn.ServiceEgressRule, res *tenantResources, tntcfg *as3.TenantConfig, syncErr error) error {
+	if rule.DeletionTimestamp != nil {
+		if syncErr != nil || !removeFinalizer(rule) {
+			return nil
 		}
-		isDelete = true
-	} else {
-		rule = r
+		if _, err := c.as3clientset.KubeovnV1alpha1().ServiceEgressRules(rule.Namespace).Update(context.Background(), rule, metav1.UpdateOptions{}); err != nil {
+			return ignoreNotFound(err)
+		}
+		klog.Infof("serviceEgressRule[%s/%s] is removed from BIG-IP", rule.Namespace, rule.Name)
+		return nil
 	}
-
-	defer func() {
-		if err != nil {
-			c.recorder.Event(rule, corev1.EventTypeWarning, err.Error(), MessageResourceFailedSynced)
+	//the expired rule is removed from BIG-IP, and kept
+	if hasExpired(rule.Spec.ExpiresAt) {
+		if syncErr != nil || rule.Status.Phase == kubeovn.ServiceEgressRuleExpired {
+			return nil
 		}
-	}()
-
-	ep, err := c.endpointsLister.Endpoints(namespace).Get(rule.Spec.Service)
-	if err != nil {
-		klog.Errorf("failed to get endpoint [%s/%s],due to: %v", namespace, rule.Spec.Service, err)
-		return err
+		klog.Infof("serviceEgressRule[%s/%s] expired at %s, removed", rule.Namespace, rule.Name, rule.Spec.ExpiresAt)
+		return c.expireServiceEgressRule(rule)
 	}
 
-	externalServicesList := kubeovn.ExternalServiceList{}
-	//set source address, ns subnet
-
-	endpointsList := corev1.EndpointsList{
-		Items: []corev1.Endpoints{
-			*ep,
-		},
-	}
-	for _, exsvcName := range rule.Spec.ExternalServices {
-		exsvc, err := c.externalServicesLister.ExternalServices(rule.Namespace).Get(exsvcName)
+	status := rule.Status.DeepCopy()
+	if syncErr != nil {
+		rule.Status.Phase = kubeovn.ServiceEgressRuleSyncing
+		setFailedStatus(&rule.Status.SyncStatus, rule.Generation, syncErr)
+	} else {
+		exsvcs, err := c.listRuleExternalServices(rule.Namespace, rule.Spec.ExternalServices, rule.Spec.ExternalServiceSelector)
 		if err != nil {
-			if !errors.IsNotFound(err) {
-				return err
-			}
-			klog.Warningf("externalService[%s/%s] does not exist", rule.Namespace, exsvcName)
-			continue
-		}
-
-		//update ext ruleType namespace
-		if exsvc.Labels == nil {
-			exsvc.Labels = make(map[string]string, 1)
-		}
-
-		//delete ruleType
-		if isDelete {
-			delete(exsvc.Labels, as3.RuleTypeLabel)
-			_, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).Update(context.Background(), exsvc,
-				metav1.UpdateOptions{})
-			if err != nil {
-				return err
-			}
-		} else {
-			if exsvc.Labels[as3.RuleTypeLabel] != as3.RuleTypeService {
-				exsvc.Labels[as3.RuleTypeLabel] = as3.RuleTypeService
-				_, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(exsvc.Namespace).Update(context.Background(), exsvc,
-					metav1.UpdateOptions{})
-				if err != nil {
-					return err
-				}
-			}
+			return err
 		}
-		externalServicesList.Items = append(externalServicesList.Items, *exsvc)
+		degradedReason, degradedMessage := getExternalServicesDegraded(rule.Spec.ExternalServices, exsvcs)
+		objects := as3.GetObjectPaths(&kubeovn.ServiceEgressRuleList{Items: []kubeovn.ServiceEgressRule{*rule}}, nil, nil,
+			&res.externalServices, nil, &res.endpoints, &res.pods, nil, tntcfg)
+		rule.Status.Phase = kubeovn.ServiceEgressRuleSuccess
+		setSyncedStatus(&rule.Status.SyncStatus, rule.Generation, objects, degradedReason, degradedMessage)
 	}
-	if len(externalServicesList.Items) == 0 {
-		klog.Warningf("ExternalServices is not found in serviceEgressRules[%s/%s], no need synchronize", rule.Namespace, rule.Name)
+	if status.Phase == rule.Status.Phase && !isStatusChanged(status.SyncStatus, rule.Status.SyncStatus) {
 		return nil
 	}
-	if !isDelete && rule.Status.Phase != kubeovn.ServiceEgressRuleSyncing {
-		rule.Status.Phase = kubeovn.ServiceEgressRuleSyncing
-		rule, err = c.as3clientset.KubeovnV1alpha1().ServiceEgressRules(namespace).UpdateStatus(context.Background(), rule,
-			v1.UpdateOptions{})
-		if err != nil {
-			return err
-		}
+	if _, err := c.as3clientset.KubeovnV1alpha1().ServiceEgressRules(rule.Namespace).UpdateStatus(context.Background(), rule, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("failed to update serviceEgressRule[%s/%s] status: %v", rule.Namespace, rule.Name, err)
+		return ignoreNotFound(err)
 	}
-	serviceEgressruleList := kubeovn.ServiceEgressRuleList{
-		Items: []kubeovn.ServiceEgressRule{
-			*rule,
-		},
+	if syncErr != nil {
+		c.recorder.Event(rule, corev1.EventTypeWarning, FailedSynced, syncErr.Error())
+	} else {
+		c.recorder.Event(rule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
 	}
-	tntcfg := as3.GetTenantConfigForNamespace(namespace)
-	err = c.as3Client.As3Request(&serviceEgressruleList, nil, nil, &externalServicesList, nil, &endpointsList, nil,
-		tntcfg, as3.RuleTypeService, isDelete)
+	return nil
+}
+
+// expireServiceEgressRule marks the removed rule as expired
+func (c *Controller) expireServiceEgressRule(rule *kubeovn.ServiceEgressRule) error {
+	rule.Status.Phase = kubeovn.ServiceEgressRuleExpired
+	setExpiredStatus(&rule.Status.SyncStatus, rule.Generation)
+	_, err := c.as3clientset.KubeovnV1alpha1().ServiceEgressRules(rule.Namespace).UpdateStatus(context.Background(), rule, metav1.UpdateOptions{})
 	if err != nil {
-		klog.Error(err)
 		return err
 	}
-
-	if !isDelete {
-		rule.Status.Phase = kubeovn.ServiceEgressRuleSuccess
-		_, err = c.as3clientset.KubeovnV1alpha1().ServiceEgressRules(namespace).UpdateStatus(context.Background(), rule, v1.UpdateOptions{})
-		if err != nil {
-			return err
-		}
-		c.recorder.Event(rule, corev1.EventTypeNormal, SuccessSynced, MessageResourceSynced)
-	}
+	c.recorder.Event(rule, corev1.EventTypeNormal, RuleExpired, MessageRuleExpired)
 	return nil
 }
@@ -0,0 +1,368 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/klog/v2"
+
+	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+	"github.com/kubeovn/ces-controller/pkg/metrics"
+)
+
+// tenantResources are the resources a tenant is declared from, the deleting and expired rules are not
+// declared so their BIG-IP objects are removed
+type tenantResources struct {
+	serviceEgressRules   kubeovn.ServiceEgressRuleList
+	namespaceEgressRules kubeovn.NamespaceEgressRuleList
+	clusterEgressRules   kubeovn.ClusterEgressRuleList
+	externalServices     kubeovn.ExternalServiceList
+	externalIPRules      snat.ExternalIPRuleList
+	endpoints            corev1.EndpointsList
+	pods                 corev1.PodList
+	namespaces           as3.NamespaceList
+}
+
+func (c *Controller) processNextTenantWorkItem() bool {
+	obj, shutdown := c.tenantWorkqueue.Get()
+	if shutdown {
+		return false
+	}
+	c.tenantProgress.begin()
+	defer c.tenantProgress.end()
+
+	err := func(obj interface{}) error {
+		defer c.tenantWorkqueue.Done(obj)
+
+		var key string
+		var ok bool
+		if key, ok = obj.(string); !ok {
+			c.tenantWorkqueue.Forget(obj)
+			utilruntime.HandleError(fmt.Errorf("expected string in workqueue but got %#v", obj))
+			return nil
+		}
+
+		if err := c.tenantSyncHandler(key); err != nil {
+			c.tenantWorkqueue.AddRateLimited(key)
+			return fmt.Errorf("error syncing tenant[%s]: %s, requeuing", key, err.Error())
+		}
+
+		c.tenantWorkqueue.Forget(obj)
+		klog.Infof("Successfully synced tenant[%s]", key)
+		return nil
+	}(obj)
+
+	if err != nil {
+		utilruntime.HandleError(err)
+		return true
+	}
+	return true
+}
+
+// tenant is a tenant with its resources listed from the informer caches
+type tenant struct {
+	config               *as3.TenantConfig
+	clusterEgressRules   []*kubeovn.ClusterEgressRule
+	namespaceEgressRules []*kubeovn.NamespaceEgressRule
+	serviceEgressRules   []*kubeovn.ServiceEgressRule
+	externalIPRules      []*snat.ExternalIPRule
+	externalServices     []*kubeovn.ExternalService
+
+	//declared are the resources declared on BIG-IP, serviceEgressRuleErrs are why the service rules
+	//are not declared by namespace/name
+	declared              tenantResources
+	serviceEgressRuleErrs map[string]error
+}
+
+// tenantSyncHandler declares the tenant of partition on BIG-IP from all of its resources in the informer
+// caches, and updates their status as the tenant is declared
+func (c *Controller) tenantSyncHandler(partition string) error {
+	klog.Infof("===============================>start sync tenant[%s]", partition)
+	defer klog.Infof("===============================>end sync tenant[%s]", partition)
+
+	tnt, err := c.getTenant(partition)
+	if err != nil {
+		return err
+	}
+	if tnt == nil {
+		c.startup.synced(partition)
+		return nil
+	}
+	if err = c.addTenantFinalizers(tnt); err != nil {
+		return err
+	}
+	c.requeueTenantAtExpiry(partition, tnt)
+	res := &tnt.declared
+	tntcfg := tnt.config
+	syncErr := c.as3Client.As3Reconcile(&res.serviceEgressRules, &res.namespaceEgressRules, &res.clusterEgressRules,
+		&res.externalServices, &res.externalIPRules, &res.endpoints, &res.pods, &res.namespaces, tntcfg)
+	if syncErr != nil {
+		klog.Error(syncErr)
+	} else {
+		metrics.TenantRules.WithLabelValues(partition, "ClusterEgressRule").Set(float64(len(res.clusterEgressRules.Items)))
+		metrics.TenantRules.WithLabelValues(partition, "NamespaceEgressRule").Set(float64(len(res.namespaceEgressRules.Items)))
+		metrics.TenantRules.WithLabelValues(partition, "ServiceEgressRule").Set(float64(len(res.serviceEgressRules.Items)))
+		metrics.TenantRules.WithLabelValues(partition, "ExternalIPRule").Set(float64(len(res.externalIPRules.Items)))
+		metrics.SetTenantSynced(partition)
+		//the tenant is reconciled at startup once it is declared, the rules failed in their status do not
+		//keep the controller unready
+		c.startup.synced(partition)
+	}
+
+	//the status is updated as far as possible, the first error requeues the tenant. A service rule not
+	//declared for its missing endpoints or pods fails in its status only, the tenant is requeued by the
+	//endpoints and pod handlers as they are created
+	errs := []error{syncErr}
+	for _, rule := range tnt.clusterEgressRules {
+		errs = append(errs, c.updateClusterEgressRule(rule, res, tntcfg, syncErr))
+	}
+	for _, rule := range tnt.namespaceEgressRules {
+		errs = append(errs, c.updateNamespaceEgressRule(rule, res, tntcfg, syncErr))
+	}
+	for _, rule := range tnt.serviceEgressRules {
+		err := syncErr
+		if svcErr, ok := tnt.serviceEgressRuleErrs[rule.Namespace+"/"+rule.Name]; ok && err == nil {
+			err = svcErr
+		}
+		errs = append(errs, c.updateServiceEgressRule(rule, res, tntcfg, err))
+	}
+	for _, rule := range tnt.externalIPRules {
+		errs = append(errs, c.updateExternalIPRule(rule, res, tntcfg, syncErr))
+	}
+	for _, exsvc := range tnt.externalServices {
+		errs = append(errs, c.updateExternalService(exsvc, syncErr))
+	}
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getTenant lists the resources of the tenant of partition, and the ones declared on BIG-IP, it returns
+// nil if the tenant is not configured. It only reads the informer caches, so the drift check lists the
+// tenant by it too
+func (c *Controller) getTenant(partition string) (*tenant, error) {
+	tntcfg := as3.GetTenantConfigForParttition(partition)
+	if tntcfg == nil {
+		klog.Infof("tenant[%s] not in watch range", partition)
+		return nil, nil
+	}
+	tnt := &tenant{
+		config:                tntcfg,
+		serviceEgressRuleErrs: map[string]error{},
+	}
+	var err error
+	if partition == as3.DefaultPartition {
+		if tnt.clusterEgressRules, err = c.listClusterEgressRules(); err != nil {
+			return nil, err
+		}
+	}
+	if tnt.namespaceEgressRules, err = c.listNamespaceEgressRules(partition); err != nil {
+		return nil, err
+	}
+	if tnt.serviceEgressRules, err = c.listServiceEgressRules(partition); err != nil {
+		return nil, err
+	}
+	if tnt.externalIPRules, err = c.listExternalIPRules(partition); err != nil {
+		return nil, err
+	}
+	if tnt.externalServices, err = c.listTenantExternalServices(partition); err != nil {
+		return nil, err
+	}
+	namespaces, err := c.namespacesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list namespaces,due to: %v", err)
+		return nil, err
+	}
+
+	//the BIG-IP objects of a deleting namespace are removed, before its resources are deleted
+	deletedNamespaces := map[string]bool{}
+	res := &tnt.declared
+	for _, ns := range namespaces {
+		if ns.DeletionTimestamp != nil {
+			deletedNamespaces[ns.Name] = true
+			continue
+		}
+		res.namespaces.Items = append(res.namespaces.Items, as3.Namespace{Namespace: *ns})
+	}
+	if err = c.setNamespaceSourceAddresses(partition, res.namespaces.Items); err != nil {
+		return nil, err
+	}
+	isNamespaceDeleted := func(namespace string) bool {
+		if deletedNamespaces[namespace] {
+			return true
+		}
+		_, err := c.namespacesLister.Get(namespace)
+		return errors.IsNotFound(err)
+	}
+	for _, exsvc := range tnt.externalServices {
+		if exsvc.DeletionTimestamp == nil && !isNamespaceDeleted(exsvc.Namespace) && verifyExtenalService(exsvc) {
+			res.externalServices.Items = append(res.externalServices.Items, *exsvc)
+		}
+	}
+	for _, rule := range tnt.clusterEgressRules {
+		if isRuleDeclared(rule.DeletionTimestamp == nil, rule.Spec.ExpiresAt) {
+			res.clusterEgressRules.Items = append(res.clusterEgressRules.Items, *rule)
+		}
+	}
+	for _, rule := range tnt.namespaceEgressRules {
+		if isRuleDeclared(rule.DeletionTimestamp == nil && !isNamespaceDeleted(rule.Namespace), rule.Spec.ExpiresAt) {
+			res.namespaceEgressRules.Items = append(res.namespaceEgressRules.Items, *rule)
+		}
+	}
+	//a service rule without source addresses is not declared, or it would match every source
+	seenPods := map[string]bool{}
+	for _, rule := range tnt.serviceEgressRules {
+		if !isRuleDeclared(rule.DeletionTimestamp == nil && !isNamespaceDeleted(rule.Namespace), rule.Spec.ExpiresAt) {
+			continue
+		}
+		if rule.Spec.PodSelector != nil {
+			pods, err := c.listRulePods(rule)
+			if err != nil {
+				tnt.serviceEgressRuleErrs[rule.Namespace+"/"+rule.Name] = err
+				continue
+			}
+			for _, pod := range pods {
+				if key := pod.Namespace + "/" + pod.Name; !seenPods[key] {
+					seenPods[key] = true
+					res.pods.Items = append(res.pods.Items, pod)
+				}
+			}
+		} else if err = c.addTenantEndpoints(res, rule.Namespace, rule.Spec.Service); err != nil {
+			klog.Errorf("failed to get endpoint [%s/%s],due to: %v", rule.Namespace, rule.Spec.Service, err)
+			tnt.serviceEgressRuleErrs[rule.Namespace+"/"+rule.Name] = err
+			continue
+		}
+		res.serviceEgressRules.Items = append(res.serviceEgressRules.Items, *rule)
+	}
+	for _, rule := range tnt.externalIPRules {
+		if rule.DeletionTimestamp != nil || isNamespaceDeleted(rule.Namespace) {
+			continue
+		}
+		for _, svcName := range rule.Spec.Services {
+			if err = c.addTenantEndpoints(res, rule.Namespace, svcName); err != nil {
+				klog.Errorf("get endpoint %s/%s error: %s", rule.Namespace, svcName, err.Error())
+			}
+		}
+		res.externalIPRules.Items = append(res.externalIPRules.Items, *rule)
+	}
+	return tnt, nil
+}
+
+// isRuleDeclared returns whether an egress rule is declared on BIG-IP, the deleting and expired rules are
+// removed from it
+func isRuleDeclared(undeleted bool, expiresAt *metav1.Time) bool {
+	return undeleted && !hasExpired(expiresAt)
+}
+
+// addTenantFinalizers adds Finalizer to the undeleted rules of tnt, so they are removed from BIG-IP before
+// they are deleted
+func (c *Controller) addTenantFinalizers(tnt *tenant) error {
+	var err error
+	for i, rule := range tnt.clusterEgressRules {
+		if tnt.clusterEgressRules[i], err = c.addClusterEgressRuleFinalizer(rule); err != nil {
+			return err
+		}
+	}
+	for i, rule := range tnt.namespaceEgressRules {
+		if tnt.namespaceEgressRules[i], err = c.addNamespaceEgressRuleFinalizer(rule); err != nil {
+			return err
+		}
+	}
+	for i, rule := range tnt.serviceEgressRules {
+		if tnt.serviceEgressRules[i], err = c.addServiceEgressRuleFinalizer(rule); err != nil {
+			return err
+		}
+	}
+	for i, rule := range tnt.externalIPRules {
+		if tnt.externalIPRules[i], err = c.addExternalIPRuleFinalizer(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requeueTenantAtExpiry requeues the tenant of partition when its first undeleted egress rule expires
+func (c *Controller) requeueTenantAtExpiry(partition string, tnt *tenant) {
+	var next *metav1.Time
+	expiresAt := func(deleted bool, t *metav1.Time) {
+		if !deleted && t != nil && !hasExpired(t) && (next == nil || t.Before(next)) {
+			next = t
+		}
+	}
+	for _, rule := range tnt.clusterEgressRules {
+		expiresAt(rule.DeletionTimestamp != nil, rule.Spec.ExpiresAt)
+	}
+	for _, rule := range tnt.namespaceEgressRules {
+		expiresAt(rule.DeletionTimestamp != nil, rule.Spec.ExpiresAt)
+	}
+	for _, rule := range tnt.serviceEgressRules {
+		expiresAt(rule.DeletionTimestamp != nil, rule.Spec.ExpiresAt)
+	}
+	if next != nil {
+		c.tenantWorkqueue.AddAfter(partition, time.Until(next.Time))
+	}
+}
+
+// addTenantEndpoints adds the endpoints of service in namespace to res once
+func (c *Controller) addTenantEndpoints(res *tenantResources, namespace, service string) error {
+	for _, ep := range res.endpoints.Items {
+		if ep.Namespace == namespace && ep.Name == service {
+			return nil
+		}
+	}
+	ep, err := c.getEndpoints(namespace, service)
+	if err != nil {
+		return err
+	}
+	res.endpoints.Items = append(res.endpoints.Items, *ep)
+	return nil
+}
+
+// isTenantNamespace returns whether namespace is mapped to the tenant of partition
+func isTenantNamespace(namespace, partition string) bool {
+	tntcfg := as3.GetTenantConfigForNamespace(namespace)
+	return tntcfg != nil && tntcfg.Name == partition
+}
+
+// listTenantExternalServices returns the copies of the external services referenceable by the egress rules
+// of the tenant of partition, sorted by namespace and name
+func (c *Controller) listTenantExternalServices(partition string) ([]*kubeovn.ExternalService, error) {
+	all, err := c.externalServicesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list externalServices,due to: %v", err)
+		return nil, err
+	}
+	exsvcs := []*kubeovn.ExternalService{}
+	for _, exsvc := range all {
+		if isTenantNamespace(exsvc.Namespace, partition) ||
+			(partition == as3.DefaultPartition && exsvc.Namespace == as3.GetClusterSvcExtNamespace()) {
+			exsvcs = append(exsvcs, exsvc.DeepCopy())
+		}
+	}
+	sort.Slice(exsvcs, func(i, j int) bool {
+		if exsvcs[i].Namespace != exsvcs[j].Namespace {
+			return exsvcs[i].Namespace < exsvcs[j].Namespace
+		}
+		return exsvcs[i].Name < exsvcs[j].Name
+	})
+	return exsvcs, nil
+}
+
+// ignoreNotFound returns nil for a not found error
+func ignoreNotFound(err error) error {
+	if errors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/klog/v2"
+
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/dns"
+)
+
+const (
+	// FailedResolve is used as part of the Event 'reason' when the FQDNs of an ExternalService
+	// fail to be resolved
+	FailedResolve = "FailedResolve"
+
+	resolveTimeout = 10 * time.Second
+	// resolvedStatusRefresh is how often LastResolveTime of an unchanged ExternalService is refreshed at most
+	resolvedStatusRefresh = 10 * time.Minute
+)
+
+// fqdnRefresh is when the FQDNs of an ExternalService are resolved next
+type fqdnRefresh struct {
+	fqdns string
+	next  time.Time
+}
+
+// resolveExternalServices resolves the FQDNs of the ExternalServices resolved by the controller
+// whose TTLs expire, the changed addresses are written to status and synced by the
+// ExternalService update
+func (c *Controller) resolveExternalServices() {
+	exsvcs, err := c.externalServicesLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list externalServices: %v", err)
+		return
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+	for _, exsvc := range exsvcs {
+		if exsvc.Spec.DNSResolution != kubeovn.DNSResolutionController || exsvc.DeletionTimestamp != nil {
+			continue
+		}
+		key := exsvc.Namespace + "/" + exsvc.Name
+		fqdns := strings.Join(exsvc.Spec.FQDNs, ",")
+		seen[key] = true
+		// fqdns changed, resolve at once
+		if r, ok := c.fqdnRefreshes[key]; ok && r.fqdns == fqdns && now.Before(r.next) {
+			continue
+		}
+		c.fqdnRefreshes[key] = fqdnRefresh{
+			fqdns: fqdns,
+			next:  now.Add(c.resolveExternalService(exsvc)),
+		}
+	}
+	for key := range c.fqdnRefreshes {
+		if !seen[key] {
+			delete(c.fqdnRefreshes, key)
+		}
+	}
+}
+
+// resolveExternalService resolves the FQDNs of exsvc and returns when to resolve them again
+func (c *Controller) resolveExternalService(exsvc *kubeovn.ExternalService) time.Duration {
+	ttl := dns.MaxTTL
+	addrs := []string{}
+	for _, fqdn := range exsvc.Spec.FQDNs {
+		// wildcard is left to AFM
+		if dns.IsWildcard(fqdn) {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		resolved, t, err := c.resolver.Resolve(ctx, fqdn)
+		cancel()
+		if err != nil {
+			// keep the last resolved addresses
+			klog.Errorf("failed to resolve externalService[%s/%s]: %v", exsvc.Namespace, exsvc.Name, err)
+			c.recorder.Event(exsvc, corev1.EventTypeWarning, FailedResolve, err.Error())
+			newExsvc := exsvc.DeepCopy()
+			setDegradedCondition(&newExsvc.Status.SyncStatus, newExsvc.Generation, ReasonResolveFailed, err.Error())
+			c.updateResolvedStatus(exsvc, newExsvc, false)
+			return dns.MinTTL
+		}
+		addrs = append(addrs, resolved...)
+		if t < ttl {
+			ttl = t
+		}
+	}
+	addrs = sortAddresses(addrs)
+
+	newExsvc := exsvc.DeepCopy()
+	newExsvc.Status.ResolvedAddresses = addrs
+	if cond := meta.FindStatusCondition(newExsvc.Status.Conditions, common.ConditionDegraded); cond != nil && cond.Reason == ReasonResolveFailed {
+		setDegradedCondition(&newExsvc.Status.SyncStatus, newExsvc.Generation, "", "")
+	}
+	if !c.updateResolvedStatus(exsvc, newExsvc, true) {
+		return dns.MinTTL
+	}
+	if !reflect.DeepEqual(addrs, exsvc.Status.ResolvedAddresses) {
+		klog.Infof("externalService[%s/%s] resolved to %v", exsvc.Namespace, exsvc.Name, addrs)
+	}
+	return ttl
+}
+
+// updateResolvedStatus writes the status of newExsvc resolved from exsvc, resolved is whether all of its FQDNs
+// are resolved, see shouldUpdateResolvedStatus. It returns false if it fails
+func (c *Controller) updateResolvedStatus(exsvc, newExsvc *kubeovn.ExternalService, resolved bool) bool {
+	now := metav1.Now()
+	if !shouldUpdateResolvedStatus(exsvc.Status, newExsvc.Status, resolved, now.Time) {
+		return true
+	}
+	newExsvc.Status.LastResolveTime = &now
+	if _, err := c.as3clientset.KubeovnV1alpha1().ExternalServices(newExsvc.Namespace).UpdateStatus(context.Background(), newExsvc, metav1.UpdateOptions{}); err != nil {
+		klog.Errorf("failed to update externalService[%s/%s] status: %v", newExsvc.Namespace, newExsvc.Name, err)
+		return false
+	}
+	return true
+}
+
+// shouldUpdateResolvedStatus returns whether status resolved from old is written at now. An unchanged status
+// is not written at every refresh, but LastResolveTime of the resolved one is refreshed every
+// resolvedStatusRefresh, so the resolver is seen alive
+func shouldUpdateResolvedStatus(old, status kubeovn.ExternalServiceStatus, resolved bool, now time.Time) bool {
+	if isResolvedStatusChanged(old, status) {
+		return true
+	}
+	return resolved && (old.LastResolveTime == nil || now.Sub(old.LastResolveTime.Time) >= resolvedStatusRefresh)
+}
+
+// isResolvedStatusChanged returns whether the resolved addresses or the conditions of status are changed from old
+func isResolvedStatusChanged(old, status kubeovn.ExternalServiceStatus) bool {
+	return !reflect.DeepEqual(old.ResolvedAddresses, status.ResolvedAddresses) || isStatusChanged(old.SyncStatus, status.SyncStatus)
+}
+
+// sortAddresses sorts and dedups the addresses, to compare them with the last resolved
+func sortAddresses(addrs []string) []string {
+	set := make(map[string]bool)
+	sorted := []string{}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil {
+			addr = ip.String()
+		}
+		if !set[addr] {
+			set[addr] = true
+			sorted = append(sorted, addr)
+		}
+	}
+	sort.Strings(sorted)
+	return sorted
+}
@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+)
+
+func TestShouldUpdateResolvedStatus(t *testing.T) {
+	now := time.Now()
+	resolvedAt := func(ago time.Duration) kubeovn.ExternalServiceStatus {
+		last := metav1.NewTime(now.Add(-ago))
+		return kubeovn.ExternalServiceStatus{ResolvedAddresses: []string{"1.1.1.1"}, LastResolveTime: &last}
+	}
+	tests := []struct {
+		name     string
+		old      kubeovn.ExternalServiceStatus
+		status   kubeovn.ExternalServiceStatus
+		resolved bool
+		expected bool
+	}{
+		{
+			name:     "addresses changed",
+			old:      resolvedAt(time.Second),
+			status:   kubeovn.ExternalServiceStatus{ResolvedAddresses: []string{"2.2.2.2"}},
+			resolved: true,
+			expected: true,
+		},
+		{
+			name:     "never resolved",
+			old:      kubeovn.ExternalServiceStatus{ResolvedAddresses: []string{"1.1.1.1"}},
+			status:   kubeovn.ExternalServiceStatus{ResolvedAddresses: []string{"1.1.1.1"}},
+			resolved: true,
+			expected: true,
+		},
+		{
+			name:     "unchanged and refreshed recently",
+			old:      resolvedAt(time.Minute),
+			status:   kubeovn.ExternalServiceStatus{ResolvedAddresses: []string{"1.1.1.1"}},
+			resolved: true,
+			expected: false,
+		},
+		{
+			name:     "unchanged and refreshed long ago",
+			old:      resolvedAt(resolvedStatusRefresh),
+			status:   kubeovn.ExternalServiceStatus{ResolvedAddresses: []string{"1.1.1.1"}},
+			resolved: true,
+			expected: true,
+		},
+		{
+			name:     "unchanged and failed to resolve",
+			old:      resolvedAt(resolvedStatusRefresh),
+			status:   kubeovn.ExternalServiceStatus{ResolvedAddresses: []string{"1.1.1.1"}},
+			resolved: false,
+			expected: false,
+		},
+	}
+	for _, test := range tests {
+		test.status.LastResolveTime = test.old.LastResolveTime
+		if got := shouldUpdateResolvedStatus(test.old, test.status, test.resolved, now); got != test.expected {
+			t.Errorf("%s: shouldUpdateResolvedStatus = %v, expected %v", test.name, got, test.expected)
+		}
+	}
+}
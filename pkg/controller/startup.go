@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/klog/v2"
+
+	"github.com/kubeovn/ces-controller/pkg/as3"
+	"github.com/kubeovn/ces-controller/pkg/metrics"
+)
+
+// startupReconcile tracks the tenants to be synced once after the controller starts, so the changes made
+// while it was down are declared on BIG-IP
+type startupReconcile struct {
+	lock    sync.Mutex
+	started time.Time
+	total   int
+	pending map[string]bool
+}
+
+// begin starts tracking partitions
+func (s *startupReconcile) begin(partitions []string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.started = time.Now()
+	s.total = len(partitions)
+	s.pending = make(map[string]bool, len(partitions))
+	for _, partition := range partitions {
+		s.pending[partition] = true
+	}
+	metrics.StartupPendingTenants.Set(float64(len(s.pending)))
+}
+
+// synced records that the tenant of partition is declared on BIG-IP, whatever the status of its resources
+func (s *startupReconcile) synced(partition string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.pending[partition] {
+		return
+	}
+	delete(s.pending, partition)
+	metrics.StartupPendingTenants.Set(float64(len(s.pending)))
+	klog.Infof("startup reconcile: %d/%d tenants synced", s.total-len(s.pending), s.total)
+	if len(s.pending) == 0 {
+		klog.Infof("startup reconcile completed in %s", time.Since(s.started).Round(time.Millisecond))
+	}
+}
+
+// check returns an error until the tracked tenants are synced, the tenants of a standby are not tracked
+func (s *startupReconcile) check() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.pending) == 0 {
+		return nil
+	}
+	partitions := make([]string, 0, len(s.pending))
+	for partition := range s.pending {
+		partitions = append(partitions, partition)
+	}
+	sort.Strings(partitions)
+	return fmt.Errorf("%d/%d tenants are not synced since startup: %s", len(partitions), s.total, strings.Join(partitions, ","))
+}
+
+// reconcileAllTenants declares every tenant configured in ces-conf.yaml, the BIG-IP objects of the resources
+// deleted while the controller was down are removed as the tenants are declared as a whole
+func (c *Controller) reconcileAllTenants() {
+	partitions := as3.GetTenantPartitions()
+	klog.Infof("startup reconcile: syncing %d tenants: %s", len(partitions), strings.Join(partitions, ","))
+	c.startup.begin(partitions)
+	for _, partition := range partitions {
+		c.enqueueTenant(partition)
+	}
+}
+
+// CheckStartupReconciled returns an error until every tenant is synced once after the controller starts
+func (c *Controller) CheckStartupReconciled() error {
+	return c.startup.check()
+}
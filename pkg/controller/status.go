@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/kubeovn/ces-controller/pkg/apis/common"
+)
+
+// Reasons of the status conditions
+const (
+	ReasonSynced                  = "Synced"
+	ReasonSyncFailed              = "SyncFailed"
+	ReasonExpired                 = "Expired"
+	ReasonAsExpected              = "AsExpected"
+	ReasonExternalServiceNotFound = "ExternalServiceNotFound"
+	ReasonResolveFailed           = "ResolveFailed"
+)
+
+// setSyncedStatus records a successful sync of generation declaring objects on BIG-IP, the resource
+// is degraded for degradedReason if it is not empty
+func setSyncedStatus(status *common.SyncStatus, generation int64, objects []string, degradedReason, degradedMessage string) {
+	now := metav1.Now()
+	status.ObservedGeneration = generation
+	status.LastSyncTime = &now
+	status.LastError = ""
+	status.BigIPObjects = objects
+	setCondition(status, generation, common.ConditionSynced, metav1.ConditionTrue, ReasonSynced, MessageResourceSynced)
+	setCondition(status, generation, common.ConditionReady, metav1.ConditionTrue, ReasonSynced, MessageResourceSynced)
+	setDegradedCondition(status, generation, degradedReason, degradedMessage)
+}
+
+// setFailedStatus records a failed sync of generation, the objects declared by the last successful
+// sync are kept
+func setFailedStatus(status *common.SyncStatus, generation int64, err error) {
+	status.ObservedGeneration = generation
+	status.LastError = err.Error()
+	setCondition(status, generation, common.ConditionSynced, metav1.ConditionFalse, ReasonSyncFailed, err.Error())
+	setCondition(status, generation, common.ConditionReady, metav1.ConditionFalse, ReasonSyncFailed, err.Error())
+}
+
+// setExpiredStatus records an expired rule removed from BIG-IP
+func setExpiredStatus(status *common.SyncStatus, generation int64) {
+	now := metav1.Now()
+	status.ObservedGeneration = generation
+	status.LastSyncTime = &now
+	status.LastError = ""
+	status.BigIPObjects = nil
+	setCondition(status, generation, common.ConditionSynced, metav1.ConditionTrue, ReasonSynced, MessageResourceSynced)
+	setCondition(status, generation, common.ConditionReady, metav1.ConditionFalse, ReasonExpired, MessageRuleExpired)
+	setDegradedCondition(status, generation, "", "")
+}
+
+func setDegradedCondition(status *common.SyncStatus, generation int64, reason, message string) {
+	if reason == "" {
+		setCondition(status, generation, common.ConditionDegraded, metav1.ConditionFalse, ReasonAsExpected, "")
+		return
+	}
+	setCondition(status, generation, common.ConditionDegraded, metav1.ConditionTrue, reason, message)
+}
+
+func setCondition(status *common.SyncStatus, generation int64, ty string, s metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+		Type:               ty,
+		Status:             s,
+		ObservedGeneration: generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// isStatusChanged returns whether status is changed from old besides the time of the last sync, the status
+// of a resource is updated only when it is changed
+func isStatusChanged(old, status common.SyncStatus) bool {
+	old.LastSyncTime, status.LastSyncTime = nil, nil
+	if len(old.BigIPObjects) == 0 && len(status.BigIPObjects) == 0 {
+		old.BigIPObjects, status.BigIPObjects = nil, nil
+	}
+	return !reflect.DeepEqual(old, status)
+}
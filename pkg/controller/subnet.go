@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"fmt"
+	"math/big"
+	"net"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/kubeovn/ces-controller/pkg/as3"
+)
+
+// SubnetResource is the kube-ovn resource of the subnets watched by the kube-ovn namespace source
+var SubnetResource = schema.GroupVersionResource{Group: "kubeovn.io", Version: "v1", Resource: "subnets"}
+
+// kubeOVNSubnetSource provides the cidrs of the kube-ovn subnets bound to the namespace without their excludeIps,
+// the namespaces bound to no subnet are assigned addresses from the default subnet
+type kubeOVNSubnetSource struct {
+	lister cache.GenericLister
+}
+
+func (s kubeOVNSubnetSource) addresses(ns *corev1.Namespace) ([]string, error) {
+	objs, err := s.lister.List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+	subnets := make([]*unstructured.Unstructured, 0, len(objs))
+	for _, obj := range objs {
+		if subnet, ok := obj.(*unstructured.Unstructured); ok && subnet.GetDeletionTimestamp() == nil {
+			subnets = append(subnets, subnet)
+		}
+	}
+	sort.Slice(subnets, func(i, j int) bool {
+		return subnets[i].GetName() < subnets[j].GetName()
+	})
+
+	bound, defaults := []*unstructured.Unstructured{}, []*unstructured.Unstructured{}
+	for _, subnet := range subnets {
+		namespaces, _, _ := unstructured.NestedStringSlice(subnet.Object, "spec", "namespaces")
+		for _, namespace := range namespaces {
+			if namespace == ns.Name {
+				bound = append(bound, subnet)
+				break
+			}
+		}
+		if isDefault, _, _ := unstructured.NestedBool(subnet.Object, "spec", "default"); isDefault {
+			defaults = append(defaults, subnet)
+		}
+	}
+	if len(bound) == 0 {
+		bound = defaults
+	}
+	//the subnets may not be synced yet, the cidr annotation of kube-ovn is used until they are
+	if len(bound) == 0 {
+		return as3.SplitNamespaceCidr(ns.Annotations[as3.NamespaceCidr]), nil
+	}
+	cidrs := []string{}
+	for _, subnet := range bound {
+		cidrBlock, _, _ := unstructured.NestedString(subnet.Object, "spec", "cidrBlock")
+		excludeIps, _, _ := unstructured.NestedStringSlice(subnet.Object, "spec", "excludeIps")
+		subnetCidrs, err := getSubnetCidrs(cidrBlock, excludeIps)
+		if err != nil {
+			return nil, fmt.Errorf("subnet[%s]: %v", subnet.GetName(), err)
+		}
+		cidrs = append(cidrs, subnetCidrs...)
+	}
+	return cidrs, nil
+}
+
+// ipRange is an inclusive range of the addresses of a family, bits is the length of its addresses
+type ipRange struct {
+	start, end *big.Int
+	bits       int
+}
+
+// getSubnetCidrs returns the cidrs covering the cidrBlock of a subnet without its excludeIps, the cidrs of a
+// dual stack subnet are separated by comma, and an exclude ip is an address or a range as 10.16.0.1..10.16.0.10
+func getSubnetCidrs(cidrBlock string, excludeIps []string) ([]string, error) {
+	cidrs := []string{}
+	for _, cidr := range as3.SplitNamespaceCidr(cidrBlock) {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cidrBlock %s: %v", cidrBlock, err)
+		}
+		ones, bits := ipNet.Mask.Size()
+		start := ipToInt(ipNet.IP)
+		size := new(big.Int).Lsh(big.NewInt(1), uint(bits-ones))
+		block := ipRange{start: start, end: new(big.Int).Sub(new(big.Int).Add(start, size), big.NewInt(1)), bits: bits}
+
+		excluded := []ipRange{}
+		for _, exclude := range excludeIps {
+			r, err := parseIPRange(exclude)
+			if err != nil {
+				return nil, err
+			}
+			if r.bits == block.bits {
+				excluded = append(excluded, r)
+			}
+		}
+		for _, r := range subtractIPRanges(block, excluded) {
+			cidrs = append(cidrs, ipRangeToCidrs(r)...)
+		}
+	}
+	return cidrs, nil
+}
+
+// parseIPRange parses an address or a range of addresses as 10.16.0.1..10.16.0.10
+func parseIPRange(s string) (ipRange, error) {
+	parts := strings.SplitN(strings.TrimSpace(s), "..", 2)
+	if len(parts) == 1 {
+		parts = append(parts, parts[0])
+	}
+	start, end := net.ParseIP(strings.TrimSpace(parts[0])), net.ParseIP(strings.TrimSpace(parts[1]))
+	if start == nil || end == nil || (start.To4() == nil) != (end.To4() == nil) {
+		return ipRange{}, fmt.Errorf("invalid excludeIps %s", s)
+	}
+	r := ipRange{start: ipToInt(start), end: ipToInt(end), bits: 128}
+	if start.To4() != nil {
+		r.bits = 32
+	}
+	return r, nil
+}
+
+// subtractIPRanges returns the ranges of block without the excluded ranges, in order
+func subtractIPRanges(block ipRange, excluded []ipRange) []ipRange {
+	sort.Slice(excluded, func(i, j int) bool {
+		return excluded[i].start.Cmp(excluded[j].start) < 0
+	})
+	ranges := []ipRange{}
+	start := new(big.Int).Set(block.start)
+	for _, r := range excluded {
+		if r.end.Cmp(start) < 0 || r.start.Cmp(block.end) > 0 {
+			continue
+		}
+		if r.start.Cmp(start) > 0 {
+			ranges = append(ranges, ipRange{start: start, end: new(big.Int).Sub(r.start, big.NewInt(1)), bits: block.bits})
+		}
+		if next := new(big.Int).Add(r.end, big.NewInt(1)); next.Cmp(start) > 0 {
+			start = next
+		}
+	}
+	if start.Cmp(block.end) <= 0 {
+		ranges = append(ranges, ipRange{start: start, end: block.end, bits: block.bits})
+	}
+	return ranges
+}
+
+// ipRangeToCidrs returns the fewest cidrs covering the range
+func ipRangeToCidrs(r ipRange) []string {
+	cidrs := []string{}
+	start := new(big.Int).Set(r.start)
+	for start.Cmp(r.end) <= 0 {
+		//the largest block aligned at start and within the range
+		size := r.bits
+		if start.Sign() != 0 && int(start.TrailingZeroBits()) < size {
+			size = int(start.TrailingZeroBits())
+		}
+		for ; size > 0; size-- {
+			last := new(big.Int).Add(start, new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(size)), big.NewInt(1)))
+			if last.Cmp(r.end) <= 0 {
+				break
+			}
+		}
+		cidrs = append(cidrs, fmt.Sprintf("%s/%d", intToIP(start, r.bits), r.bits-size))
+		start.Add(start, new(big.Int).Lsh(big.NewInt(1), uint(size)))
+	}
+	return cidrs
+}
+
+func ipToInt(ip net.IP) *big.Int {
+	if v4 := ip.To4(); v4 != nil {
+		return new(big.Int).SetBytes(v4)
+	}
+	return new(big.Int).SetBytes(ip.To16())
+}
+
+func intToIP(i *big.Int, bits int) net.IP {
+	ip := make(net.IP, bits/8)
+	return i.FillBytes(ip)
+}
+
+// enqueueSubnet enqueues the namespaces bound to the subnet, or every tenant for the default subnet which the
+// unbound namespaces are assigned addresses from
+func (c *Controller) enqueueSubnet(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	subnet, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		utilruntime.HandleError(fmt.Errorf("expected Subnet but got %#v", obj))
+		return
+	}
+	if isDefault, _, _ := unstructured.NestedBool(subnet.Object, "spec", "default"); isDefault {
+		for _, partition := range as3.GetTenantPartitions() {
+			c.enqueueTenant(partition)
+		}
+		return
+	}
+	namespaces, _, _ := unstructured.NestedStringSlice(subnet.Object, "spec", "namespaces")
+	for _, namespace := range namespaces {
+		ns, err := c.namespacesLister.Get(namespace)
+		if err != nil {
+			c.enqueueNamespaceTenant(namespace)
+			continue
+		}
+		c.enqueueNamespace(ns)
+	}
+}
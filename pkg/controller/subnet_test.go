@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestGetSubnetCidrs(t *testing.T) {
+	tests := []struct {
+		name       string
+		cidrBlock  string
+		excludeIps []string
+		expected   []string
+	}{
+		{
+			name:      "no excludeIps",
+			cidrBlock: "10.16.0.0/16",
+			expected:  []string{"10.16.0.0/16"},
+		},
+		{
+			name:       "gateway",
+			cidrBlock:  "10.16.0.0/24",
+			excludeIps: []string{"10.16.0.1"},
+			expected: []string{"10.16.0.0/32", "10.16.0.2/31", "10.16.0.4/30", "10.16.0.8/29", "10.16.0.16/28",
+				"10.16.0.32/27", "10.16.0.64/26", "10.16.0.128/25"},
+		},
+		{
+			name:       "ranges",
+			cidrBlock:  "10.16.0.0/28",
+			excludeIps: []string{"10.16.0.0..10.16.0.7", "10.16.0.6..10.16.0.11", "10.15.0.1", "fd00::1"},
+			expected:   []string{"10.16.0.12/30"},
+		},
+		{
+			name:       "dual stack",
+			cidrBlock:  "10.16.0.0/30,fd00:10:16::/126",
+			excludeIps: []string{"10.16.0.3", "fd00:10:16::1"},
+			expected:   []string{"10.16.0.0/31", "10.16.0.2/32", "fd00:10:16::/128", "fd00:10:16::2/127"},
+		},
+		{
+			name:       "all excluded",
+			cidrBlock:  "10.16.0.0/31",
+			excludeIps: []string{"10.16.0.0..10.16.0.1"},
+			expected:   []string{},
+		},
+	}
+	for _, test := range tests {
+		cidrs, err := getSubnetCidrs(test.cidrBlock, test.excludeIps)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(cidrs, test.expected) {
+			t.Errorf("%s: getSubnetCidrs() = %v, expected %v", test.name, cidrs, test.expected)
+		}
+	}
+
+	if _, err := getSubnetCidrs("10.16.0.0/16", []string{"10.16.0.1..fd00::1"}); err == nil {
+		t.Errorf("expected an error for the excludeIps of mixed families")
+	}
+}
+
+func TestKubeOVNSubnetSource(t *testing.T) {
+	subnet := func(name, cidrBlock string, isDefault bool, namespaces ...interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"spec": map[string]interface{}{"cidrBlock": cidrBlock, "default": isDefault, "namespaces": namespaces},
+		}}
+		obj.SetName(name)
+		return obj
+	}
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, obj := range []*unstructured.Unstructured{
+		subnet("ovn-default", "10.16.0.0/16", true),
+		subnet("project1-a", "10.17.0.0/16", false, "project1"),
+		subnet("project1-b", "10.18.0.0/16,fd00:10:18::/64", false, "project1", "project2"),
+	} {
+		if err := indexer.Add(obj); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := kubeOVNSubnetSource{lister: cache.NewGenericLister(indexer, SubnetResource.GroupResource())}
+
+	tests := map[string][]string{
+		"project1": {"10.17.0.0/16", "10.18.0.0/16", "fd00:10:18::/64"},
+		"project2": {"10.18.0.0/16", "fd00:10:18::/64"},
+		"project3": {"10.16.0.0/16"},
+	}
+	for namespace, expected := range tests {
+		addrs, err := source.addresses(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", namespace, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, expected) {
+			t.Errorf("%s: addresses = %v, expected %v", namespace, addrs, expected)
+		}
+	}
+}
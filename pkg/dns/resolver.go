@@ -0,0 +1,212 @@
+package dns
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultResolvConf is where the nameservers are read from
+	DefaultResolvConf = "/etc/resolv.conf"
+
+	// MinTTL and MaxTTL bound how often resolved addresses are refreshed
+	MinTTL = 30 * time.Second
+	MaxTTL = time.Hour
+
+	dnsPort = "53"
+	// EDNS is not used, udp responses are limited to 512 bytes
+	maxUDPSize = 512
+)
+
+// Resolver resolves a domain name to its addresses
+type Resolver interface {
+	// Resolve returns the A and AAAA addresses of fqdn, and how long they are valid
+	Resolve(ctx context.Context, fqdn string) ([]string, time.Duration, error)
+}
+
+// IsWildcard returns whether fqdn is a wildcard domain name, eg: *.example.com
+func IsWildcard(fqdn string) bool {
+	return strings.HasPrefix(fqdn, "*")
+}
+
+type resolver struct {
+	servers []string
+	// err is why the nameservers can't be read, every resolution fails with it
+	err error
+}
+
+// NewResolver returns a Resolver querying the nameservers of resolvConf, the TTLs of the answers
+// are kept, unlike net.Resolver. If the nameservers can't be read, the error is returned with a
+// Resolver failing every resolution, so only the external services resolved by the controller fail
+func NewResolver(resolvConf string) (Resolver, error) {
+	servers, err := readNameservers(resolvConf)
+	if err != nil {
+		return &resolver{err: err}, err
+	}
+	return &resolver{servers: servers}, nil
+}
+
+func readNameservers(resolvConf string) ([]string, error) {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	servers := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		if net.ParseIP(fields[1]) != nil {
+			servers = append(servers, net.JoinHostPort(fields[1], dnsPort))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameserver in %s", resolvConf)
+	}
+	return servers, nil
+}
+
+func (r *resolver) Resolve(ctx context.Context, fqdn string) ([]string, time.Duration, error) {
+	if r.err != nil {
+		return nil, 0, fmt.Errorf("failed to resolve %s: %v", fqdn, r.err)
+	}
+	name, err := dnsmessage.NewName(strings.TrimSuffix(fqdn, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	var lastErr error
+	for _, server := range r.servers {
+		addrs, ttl, err := r.resolve(ctx, server, name)
+		if err == nil {
+			return addrs, ttl, nil
+		}
+		lastErr = err
+	}
+	return nil, 0, fmt.Errorf("failed to resolve %s: %v", fqdn, lastErr)
+}
+
+func (r *resolver) resolve(ctx context.Context, server string, name dnsmessage.Name) ([]string, time.Duration, error) {
+	addrs := []string{}
+	ttl := MaxTTL
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, err := r.exchange(ctx, server, name, qtype)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, answer := range answers {
+			var ip net.IP
+			switch body := answer.Body.(type) {
+			case *dnsmessage.AResource:
+				ip = body.A[:]
+			case *dnsmessage.AAAAResource:
+				ip = body.AAAA[:]
+			default:
+				// CNAMEs are followed by the nameserver
+				continue
+			}
+			addrs = append(addrs, ip.String())
+			if t := time.Duration(answer.Header.TTL) * time.Second; t < ttl {
+				ttl = t
+			}
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, 0, fmt.Errorf("no address from %s", server)
+	}
+	if ttl < MinTTL {
+		ttl = MinTTL
+	}
+	return addrs, ttl, nil
+}
+
+// exchange sends the question over udp, and retries over tcp if the answer is truncated
+func (r *resolver) exchange(ctx context.Context, server string, name dnsmessage.Name, qtype dnsmessage.Type) ([]dnsmessage.Resource, error) {
+	id := uint16(rand.Uint32())
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := r.roundTrip(ctx, "udp", server, query)
+	if err == nil && msg.Truncated {
+		msg, err = r.roundTrip(ctx, "tcp", server, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if msg.ID != id {
+		return nil, fmt.Errorf("mismatched answer id from %s", server)
+	}
+	// a name without addresses of qtype
+	if msg.RCode == dnsmessage.RCodeSuccess || msg.RCode == dnsmessage.RCodeNameError {
+		return msg.Answers, nil
+	}
+	return nil, fmt.Errorf("%s answered %s", server, msg.RCode)
+}
+
+func (r *resolver) roundTrip(ctx context.Context, network, server string, query []byte) (*dnsmessage.Message, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	var buf []byte
+	if network == "tcp" {
+		// tcp messages are prefixed with their length
+		req := make([]byte, 2+len(query))
+		binary.BigEndian.PutUint16(req, uint16(len(query)))
+		copy(req[2:], query)
+		if _, err := conn.Write(req); err != nil {
+			return nil, err
+		}
+		l := make([]byte, 2)
+		if _, err := io.ReadFull(conn, l); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(l))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(query); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, maxUDPSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	}
+
+	msg := &dnsmessage.Message{}
+	if err := msg.Unpack(buf); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
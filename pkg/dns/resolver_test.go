@@ -0,0 +1,260 @@
+package dns
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// fakeServer answers the questions over udp and tcp on the same port by answer
+type fakeServer struct {
+	addr   string
+	answer func(q dnsmessage.Question, tcp bool) (dnsmessage.RCode, bool, []dnsmessage.Resource)
+}
+
+func newFakeServer(t *testing.T, answer func(q dnsmessage.Question, tcp bool) (dnsmessage.RCode, bool, []dnsmessage.Resource)) *fakeServer {
+	s := &fakeServer{answer: answer}
+	var udp net.PacketConn
+	var tcp net.Listener
+	var err error
+	//the tcp port of the udp one may be taken
+	for i := 0; i < 10 && tcp == nil; i++ {
+		if udp, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if tcp, err = net.Listen("tcp", udp.LocalAddr().String()); err != nil {
+			udp.Close()
+		}
+	}
+	if tcp == nil {
+		t.Fatalf("failed to listen on tcp: %v", err)
+	}
+	s.addr = udp.LocalAddr().String()
+	t.Cleanup(func() {
+		udp.Close()
+		tcp.Close()
+	})
+
+	go func() {
+		buf := make([]byte, maxUDPSize)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := s.respond(buf[:n], false); resp != nil {
+				udp.WriteTo(resp, addr)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			l := make([]byte, 2)
+			if _, err = io.ReadFull(conn, l); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(l))
+				if _, err = io.ReadFull(conn, query); err == nil {
+					if resp := s.respond(query, true); resp != nil {
+						binary.BigEndian.PutUint16(l, uint16(len(resp)))
+						conn.Write(append(l, resp...))
+					}
+				}
+			}
+			conn.Close()
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) respond(query []byte, tcp bool) []byte {
+	msg := dnsmessage.Message{}
+	if err := msg.Unpack(query); err != nil || len(msg.Questions) != 1 {
+		return nil
+	}
+	rcode, truncated, answers := s.answer(msg.Questions[0], tcp)
+	resp, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: msg.ID, Response: true, RCode: rcode, Truncated: truncated},
+		Questions: msg.Questions,
+		Answers:   answers,
+	}).Pack()
+	if err != nil {
+		return nil
+	}
+	return resp
+}
+
+func resourceA(name string, ttl uint32, ip string) dnsmessage.Resource {
+	a := dnsmessage.AResource{}
+	copy(a.A[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &a,
+	}
+}
+
+func resourceAAAA(name string, ttl uint32, ip string) dnsmessage.Resource {
+	aaaa := dnsmessage.AAAAResource{}
+	copy(aaaa.AAAA[:], net.ParseIP(ip).To16())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &aaaa,
+	}
+}
+
+func resourceCNAME(name string, ttl uint32, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypeCNAME, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)},
+	}
+}
+
+func TestResolve(t *testing.T) {
+	var tcpQueries int32
+	server := newFakeServer(t, func(q dnsmessage.Question, tcp bool) (dnsmessage.RCode, bool, []dnsmessage.Resource) {
+		if tcp {
+			atomic.AddInt32(&tcpQueries, 1)
+		}
+		name := q.Name.String()
+		switch {
+		case name == "example.com." && q.Type == dnsmessage.TypeA:
+			return dnsmessage.RCodeSuccess, false, []dnsmessage.Resource{resourceA(name, 300, "192.0.2.1"), resourceA(name, 600, "192.0.2.2")}
+		case name == "example.com." && q.Type == dnsmessage.TypeAAAA:
+			return dnsmessage.RCodeSuccess, false, []dnsmessage.Resource{resourceAAAA(name, 200, "2001:db8::1")}
+		case name == "www.example.com.":
+			//the nameserver follows the chain
+			answers := []dnsmessage.Resource{resourceCNAME(name, 10, "edge.example.net."), resourceCNAME("edge.example.net.", 10, "cdn.example.org.")}
+			if q.Type == dnsmessage.TypeA {
+				answers = append(answers, resourceA("cdn.example.org.", 120, "198.51.100.1"))
+			}
+			return dnsmessage.RCodeSuccess, false, answers
+		case name == "big.example.com.":
+			if !tcp {
+				return dnsmessage.RCodeSuccess, true, nil
+			}
+			if q.Type == dnsmessage.TypeA {
+				return dnsmessage.RCodeSuccess, false, []dnsmessage.Resource{resourceA(name, 300, "203.0.113.1"), resourceA(name, 300, "203.0.113.2")}
+			}
+			return dnsmessage.RCodeSuccess, false, nil
+		case name == "short.example.com." && q.Type == dnsmessage.TypeA:
+			return dnsmessage.RCodeSuccess, false, []dnsmessage.Resource{resourceA(name, 5, "192.0.2.10")}
+		case name == "long.example.com." && q.Type == dnsmessage.TypeA:
+			return dnsmessage.RCodeSuccess, false, []dnsmessage.Resource{resourceA(name, 86400, "192.0.2.11")}
+		case name == "broken.example.com.":
+			return dnsmessage.RCodeServerFailure, false, nil
+		case name == "refused.example.com.":
+			return dnsmessage.RCodeRefused, false, nil
+		}
+		return dnsmessage.RCodeNameError, false, nil
+	})
+	r := &resolver{servers: []string{server.addr}}
+
+	tests := []struct {
+		name          string
+		fqdn          string
+		expectedAddrs []string
+		expectedTTL   time.Duration
+		expectedTCP   int32
+		expectedErr   string
+	}{
+		{name: "a and aaaa", fqdn: "example.com", expectedAddrs: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}, expectedTTL: 200 * time.Second},
+		{name: "trailing dot", fqdn: "example.com.", expectedAddrs: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}, expectedTTL: 200 * time.Second},
+		{name: "cname chain", fqdn: "www.example.com", expectedAddrs: []string{"198.51.100.1"}, expectedTTL: 120 * time.Second},
+		{name: "truncated", fqdn: "big.example.com", expectedAddrs: []string{"203.0.113.1", "203.0.113.2"}, expectedTTL: 300 * time.Second, expectedTCP: 2},
+		{name: "ttl floor", fqdn: "short.example.com", expectedAddrs: []string{"192.0.2.10"}, expectedTTL: MinTTL},
+		{name: "ttl ceiling", fqdn: "long.example.com", expectedAddrs: []string{"192.0.2.11"}, expectedTTL: MaxTTL},
+		{name: "server failure", fqdn: "broken.example.com", expectedErr: "ServerFailure"},
+		{name: "refused", fqdn: "refused.example.com", expectedErr: "Refused"},
+		{name: "no such name", fqdn: "missing.example.com", expectedErr: "no address"},
+	}
+	for _, test := range tests {
+		atomic.StoreInt32(&tcpQueries, 0)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		addrs, ttl, err := r.Resolve(ctx, test.fqdn)
+		cancel()
+		if test.expectedErr != "" {
+			if err == nil || !strings.Contains(strings.ToLower(err.Error()), strings.ToLower(test.expectedErr)) {
+				t.Errorf("%s: expected error %q, got %v", test.name, test.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, test.expectedAddrs) {
+			t.Errorf("%s: addresses = %v, expected %v", test.name, addrs, test.expectedAddrs)
+		}
+		if ttl != test.expectedTTL {
+			t.Errorf("%s: ttl = %s, expected %s", test.name, ttl, test.expectedTTL)
+		}
+		if n := atomic.LoadInt32(&tcpQueries); n != test.expectedTCP {
+			t.Errorf("%s: %d queries over tcp, expected %d", test.name, n, test.expectedTCP)
+		}
+	}
+}
+
+func TestResolveFallback(t *testing.T) {
+	failing := newFakeServer(t, func(q dnsmessage.Question, tcp bool) (dnsmessage.RCode, bool, []dnsmessage.Resource) {
+		return dnsmessage.RCodeServerFailure, false, nil
+	})
+	working := newFakeServer(t, func(q dnsmessage.Question, tcp bool) (dnsmessage.RCode, bool, []dnsmessage.Resource) {
+		if q.Type != dnsmessage.TypeA {
+			return dnsmessage.RCodeSuccess, false, nil
+		}
+		return dnsmessage.RCodeSuccess, false, []dnsmessage.Resource{resourceA(q.Name.String(), 60, "192.0.2.1")}
+	})
+	r := &resolver{servers: []string{failing.addr, working.addr}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	addrs, _, err := r.Resolve(ctx, "example.com")
+	if err != nil || !reflect.DeepEqual(addrs, []string{"192.0.2.1"}) {
+		t.Errorf("Resolve() = %v, %v, expected the addresses of the second nameserver", addrs, err)
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	dir, err := ioutil.TempDir("", "resolver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	resolvConf := filepath.Join(dir, "resolv.conf")
+	content := "search default.svc.cluster.local\nnameserver 10.96.0.10\nnameserver fd00::10\nnameserver invalid\noptions ndots:5\n"
+	if err = ioutil.WriteFile(resolvConf, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewResolver(resolvConf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if servers := r.(*resolver).servers; !reflect.DeepEqual(servers, []string{"10.96.0.10:53", "[fd00::10]:53"}) {
+		t.Errorf("unexpected nameservers %v", servers)
+	}
+
+	//the external services fail to resolve without nameservers, the controller keeps running
+	if err = ioutil.WriteFile(resolvConf, []byte("search default.svc.cluster.local\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err = NewResolver(resolvConf)
+	if err == nil || r == nil {
+		t.Fatalf("expected an error and a failing resolver, got %v, %v", r, err)
+	}
+	if _, _, err = r.Resolve(context.Background(), "example.com"); err == nil || !strings.Contains(err.Error(), "no nameserver") {
+		t.Errorf("expected the error of the missing nameservers, got %v", err)
+	}
+}
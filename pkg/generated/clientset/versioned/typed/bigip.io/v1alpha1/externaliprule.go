@@ -40,6 +40,7 @@ type ExternalIPRulesGetter interface {
 type ExternalIPRuleInterface interface {
 	Create(ctx context.Context, externalIPRule *v1alpha1.ExternalIPRule, opts v1.CreateOptions) (*v1alpha1.ExternalIPRule, error)
 	Update(ctx context.Context, externalIPRule *v1alpha1.ExternalIPRule, opts v1.UpdateOptions) (*v1alpha1.ExternalIPRule, error)
+	UpdateStatus(ctx context.Context, externalIPRule *v1alpha1.ExternalIPRule, opts v1.UpdateOptions) (*v1alpha1.ExternalIPRule, error)
 	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
 	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
 	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.ExternalIPRule, error)
@@ -135,6 +136,22 @@ func (c *externalIPRules) Update(ctx context.Context, externalIPRule *v1alpha1.E
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *externalIPRules) UpdateStatus(ctx context.Context, externalIPRule *v1alpha1.ExternalIPRule, opts v1.UpdateOptions) (result *v1alpha1.ExternalIPRule, err error) {
+	result = &v1alpha1.ExternalIPRule{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("externaliprules").
+		Name(externalIPRule.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(externalIPRule).
+		Do(ctx).
+		Into(result)
+	return
+}
+
 // Delete takes name of the externalIPRule and deletes it. Returns an error if one occurs.
 func (c *externalIPRules) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	return c.client.Delete().
@@ -102,6 +102,18 @@ func (c *FakeExternalIPRules) Update(ctx context.Context, externalIPRule *v1alph
 	return obj.(*v1alpha1.ExternalIPRule), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeExternalIPRules) UpdateStatus(ctx context.Context, externalIPRule *v1alpha1.ExternalIPRule, opts v1.UpdateOptions) (*v1alpha1.ExternalIPRule, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(externaliprulesResource, "status", c.ns, externalIPRule), &v1alpha1.ExternalIPRule{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ExternalIPRule), err
+}
+
 // Delete takes name of the externalIPRule and deletes it. Returns an error if one occurs.
 func (c *FakeExternalIPRules) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	_, err := c.Fake.
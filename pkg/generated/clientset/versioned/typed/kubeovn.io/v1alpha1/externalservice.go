@@ -40,6 +40,7 @@ type ExternalServicesGetter interface {
 type ExternalServiceInterface interface {
 	Create(ctx context.Context, externalService *v1alpha1.ExternalService, opts v1.CreateOptions) (*v1alpha1.ExternalService, error)
 	Update(ctx context.Context, externalService *v1alpha1.ExternalService, opts v1.UpdateOptions) (*v1alpha1.ExternalService, error)
+	UpdateStatus(ctx context.Context, externalService *v1alpha1.ExternalService, opts v1.UpdateOptions) (*v1alpha1.ExternalService, error)
 	Delete(ctx context.Context, name string, opts v1.DeleteOptions) error
 	DeleteCollection(ctx context.Context, opts v1.DeleteOptions, listOpts v1.ListOptions) error
 	Get(ctx context.Context, name string, opts v1.GetOptions) (*v1alpha1.ExternalService, error)
@@ -135,6 +136,22 @@ func (c *externalServices) Update(ctx context.Context, externalService *v1alpha1
 	return
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *externalServices) UpdateStatus(ctx context.Context, externalService *v1alpha1.ExternalService, opts v1.UpdateOptions) (result *v1alpha1.ExternalService, err error) {
+	result = &v1alpha1.ExternalService{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("externalservices").
+		Name(externalService.Name).
+		SubResource("status").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Body(externalService).
+		Do(ctx).
+		Into(result)
+	return
+}
+
 // Delete takes name of the externalService and deletes it. Returns an error if one occurs.
 func (c *externalServices) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	return c.client.Delete().
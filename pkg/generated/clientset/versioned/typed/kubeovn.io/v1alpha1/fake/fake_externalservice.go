@@ -102,6 +102,18 @@ func (c *FakeExternalServices) Update(ctx context.Context, externalService *v1al
 	return obj.(*v1alpha1.ExternalService), err
 }
 
+// UpdateStatus was generated because the type contains a Status member.
+// Add a +genclient:noStatus comment above the type to avoid generating UpdateStatus().
+func (c *FakeExternalServices) UpdateStatus(ctx context.Context, externalService *v1alpha1.ExternalService, opts v1.UpdateOptions) (*v1alpha1.ExternalService, error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateSubresourceAction(externalservicesResource, "status", c.ns, externalService), &v1alpha1.ExternalService{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ExternalService), err
+}
+
 // Delete takes name of the externalService and deletes it. Returns an error if one occurs.
 func (c *FakeExternalServices) Delete(ctx context.Context, name string, opts v1.DeleteOptions) error {
 	_, err := c.Fake.
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+const (
+	// LivenessPath is where the liveness is served
+	LivenessPath = "/healthz"
+	// ReadinessPath is where the readiness is served
+	ReadinessPath = "/readyz"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// Check is a named check, it returns an error if the check fails
+type Check struct {
+	Name  string
+	Check func() error
+}
+
+// handler responds 200 if all of the checks pass, or 503 with the failed checks
+func handler(checks []Check) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		failed := []string{}
+		for _, check := range checks {
+			if err := check.Check(); err != nil {
+				failed = append(failed, fmt.Sprintf("[-]%s failed: %v", check.Name, err))
+			}
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if len(failed) != 0 {
+			klog.V(3).Infof("%s check failed: %s", r.URL.Path, strings.Join(failed, ", "))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintln(w, strings.Join(failed, "\n"))
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// Serve serves the liveness and readiness of the checks on addr until stopCh is closed
+func Serve(addr string, liveness, readiness []Check, stopCh <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(LivenessPath, handler(liveness))
+	mux.Handle(ReadinessPath, handler(readiness))
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	klog.Infof("Starting health server on %s", addr)
+	err := srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// Path is where the metrics are served
+	Path = "/metrics"
+
+	namespace       = "ces"
+	shutdownTimeout = 5 * time.Second
+)
+
+var (
+	// DriftChecks counts the drift checks of the tenants by result, in_sync, drifted or error
+	DriftChecks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "drift",
+		Name:      "checks_total",
+		Help:      "Number of the drift checks of the tenants on BIG-IP by result.",
+	}, []string{"tenant", "result"})
+
+	// DriftObjects is the number of the BIG-IP objects of a tenant drifting from the desired state at the last
+	// check by drift type, missing, modified or unexpected
+	DriftObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "drift",
+		Name:      "objects",
+		Help:      "Number of the BIG-IP objects of the tenants drifting from the desired state by drift type.",
+	}, []string{"tenant", "type"})
+
+	// DriftRepairs counts the repairs of the drifted tenants
+	DriftRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "drift",
+		Name:      "repairs_total",
+		Help:      "Number of the repairs of the drifted tenants on BIG-IP.",
+	}, []string{"tenant"})
+
+	// AS3Requests counts the requests to BIG-IP by method and tenant, the tenant is empty for the requests
+	// not to a tenant
+	AS3Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "as3",
+		Name:      "requests_total",
+		Help:      "Number of the requests to BIG-IP by method and tenant.",
+	}, []string{"method", "tenant"})
+
+	// AS3RequestDuration is the latency of the requests to BIG-IP by method and tenant
+	AS3RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "as3",
+		Name:      "request_duration_seconds",
+		Help:      "Latency in seconds of the requests to BIG-IP by method and tenant.",
+		Buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"method", "tenant"})
+
+	// BigIPErrors counts the errors responded by BIG-IP by the HTTP status code, or the AS3 result code of
+	// each tenant
+	BigIPErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "bigip",
+		Name:      "errors_total",
+		Help:      "Number of the errors responded by BIG-IP by HTTP or AS3 status code.",
+	}, []string{"code"})
+
+	// TenantRules is the number of the rules declared in a tenant by kind
+	TenantRules = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "tenant",
+		Name:      "rules",
+		Help:      "Number of the rules declared in the tenants by kind.",
+	}, []string{"tenant", "kind"})
+
+	// TenantAddressLists is the number of the address lists declared in a tenant by this cluster
+	TenantAddressLists = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "tenant",
+		Name:      "address_lists",
+		Help:      "Number of the address lists declared in the tenants.",
+	}, []string{"tenant"})
+
+	// TenantAddresses is the number of the addresses and fqdns in the address lists of a tenant
+	TenantAddresses = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "tenant",
+		Name:      "addresses",
+		Help:      "Number of the addresses and fqdns in the address lists declared in the tenants.",
+	}, []string{"tenant"})
+
+	// EndpointUpdates counts the address lists of a tenant updated by the endpoints by result, success or error
+	EndpointUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "endpoints",
+		Name:      "address_list_updates_total",
+		Help:      "Number of the address list updates driven by the endpoints by tenant and result.",
+	}, []string{"tenant", "result"})
+
+	// StoreDisks counts the saves of the BIG-IP configuration to disk by result, success or error
+	StoreDisks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "bigip",
+		Name:      "store_disk_total",
+		Help:      "Number of the saves of the BIG-IP configuration to disk by result.",
+	}, []string{"result"})
+
+	// StartupPendingTenants is the number of the tenants not synced yet since the controller started
+	StartupPendingTenants = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "startup",
+		Name:      "pending_tenants",
+		Help:      "Number of the tenants not synced yet since the controller started.",
+	})
+
+	// GCOrphans is the number of the objects of a tenant whose rules are gone at the last garbage collection
+	// by the kind of the rules
+	GCOrphans = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "orphaned_objects",
+		Help:      "Number of the BIG-IP objects of the tenants whose rules are gone by rule kind.",
+	}, []string{"tenant", "kind"})
+
+	// GCRemovals counts the orphaned objects removed from a tenant
+	GCRemovals = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "gc",
+		Name:      "removed_objects_total",
+		Help:      "Number of the orphaned BIG-IP objects removed from the tenants.",
+	}, []string{"tenant"})
+
+	tenantSyncs = &tenantSyncCollector{
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "tenant", "last_sync_age_seconds"),
+			"Seconds since the last successful sync of the tenants.", []string{"tenant"}, nil),
+		synced: map[string]time.Time{},
+	}
+)
+
+func init() {
+	prometheus.MustRegister(DriftChecks, DriftObjects, DriftRepairs, AS3Requests, AS3RequestDuration, BigIPErrors,
+		TenantRules, TenantAddressLists, TenantAddresses, EndpointUpdates, StoreDisks, StartupPendingTenants,
+		GCOrphans, GCRemovals, tenantSyncs)
+}
+
+// Result returns the result label of err
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// SetTenantSynced records that the tenant is synced successfully now
+func SetTenantSynced(tenant string) {
+	tenantSyncs.Lock()
+	defer tenantSyncs.Unlock()
+	tenantSyncs.synced[tenant] = time.Now()
+}
+
+// tenantSyncCollector collects the age of the last successful sync of each tenant as it is scraped
+type tenantSyncCollector struct {
+	sync.Mutex
+	desc   *prometheus.Desc
+	synced map[string]time.Time
+}
+
+func (c *tenantSyncCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *tenantSyncCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	defer c.Unlock()
+	for tenant, synced := range c.synced {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, time.Since(synced).Seconds(), tenant)
+	}
+}
+
+// Serve serves the metrics on addr until stopCh is closed
+func Serve(addr string, stopCh <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle(Path, promhttp.Handler())
+	srv := &http.Server{Addr: addr, Handler: mux}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	klog.Infof("Starting metrics server on %s", addr)
+	err := srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+package webhook
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	"github.com/kubeovn/ces-controller/pkg/as3"
+)
+
+// ruleActions are the actions of a firewall rule accepted by AS3
+var ruleActions = []string{"accept", "accept-decisively", "drop", "reject"}
+
+func validateExternalService(exsvc *kubeovn.ExternalService) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if exsvc.Namespace != as3.GetClusterSvcExtNamespace() && as3.GetTenantConfigForNamespace(exsvc.Namespace) == nil {
+		allErrs = append(allErrs, field.Forbidden(field.NewPath("metadata", "namespace"),
+			fmt.Sprintf("namespace %s is not mapped to any tenant in ces-conf.yaml, and is not the cluster external service namespace %s",
+				exsvc.Namespace, as3.GetClusterSvcExtNamespace())))
+	}
+	irules := as3.GetIRuleList()
+	for i, port := range exsvc.Spec.Ports {
+		bandwidth := strings.TrimSpace(port.Bandwidth)
+		if bandwidth != "" && !sets.NewString(irules...).Has(bandwidth) {
+			allErrs = append(allErrs, field.NotSupported(field.NewPath("spec", "ports").Index(i).Child("bandwidth"), port.Bandwidth, irules))
+		}
+	}
+	return allErrs
+}
+
+func (s *Server) validateClusterEgressRule(rule *kubeovn.ClusterEgressRule) field.ErrorList {
+	allErrs := validateAction(rule.Spec.Action)
+	return append(allErrs, s.validateExternalServices(as3.GetClusterSvcExtNamespace(), rule.Spec.ExternalServices)...)
+}
+
+func (s *Server) validateNamespaceEgressRule(rule *kubeovn.NamespaceEgressRule) field.ErrorList {
+	allErrs := validateTenant(rule.Namespace)
+	allErrs = append(allErrs, validateAction(rule.Spec.Action)...)
+	return append(allErrs, s.validateExternalServices(rule.Namespace, rule.Spec.ExternalServices)...)
+}
+
+func (s *Server) validateServiceEgressRule(rule *kubeovn.ServiceEgressRule) field.ErrorList {
+	allErrs := validateTenant(rule.Namespace)
+	allErrs = append(allErrs, validateAction(rule.Spec.Action)...)
+	return append(allErrs, s.validateExternalServices(rule.Namespace, rule.Spec.ExternalServices)...)
+}
+
+func validateExternalIPRule(rule *snat.ExternalIPRule) field.ErrorList {
+	return validateTenant(rule.Namespace)
+}
+
+// validateTenant requires the namespace of a rule to be mapped to a tenant, otherwise the rule is never synced
+func validateTenant(namespace string) field.ErrorList {
+	if as3.GetTenantConfigForNamespace(namespace) != nil {
+		return nil
+	}
+	return field.ErrorList{field.Forbidden(field.NewPath("metadata", "namespace"),
+		fmt.Sprintf("namespace %s is not mapped to any tenant in ces-conf.yaml, add it to the namespaces of a tenant first", namespace))}
+}
+
+func validateAction(action string) field.ErrorList {
+	if sets.NewString(ruleActions...).Has(action) {
+		return nil
+	}
+	return field.ErrorList{field.NotSupported(field.NewPath("spec", "action"), action, ruleActions)}
+}
+
+// validateExternalServices requires the external services referenced by name to exist in namespace
+func (s *Server) validateExternalServices(namespace string, names []string) field.ErrorList {
+	allErrs := field.ErrorList{}
+	for i, name := range names {
+		_, err := s.externalServicesLister.ExternalServices(namespace).Get(name)
+		if err == nil {
+			continue
+		}
+		path := field.NewPath("spec", "externalServices").Index(i)
+		if errors.IsNotFound(err) {
+			allErrs = append(allErrs, field.Invalid(path, name,
+				fmt.Sprintf("externalService %s/%s not found, create it before the rule", namespace, name)))
+		} else {
+			allErrs = append(allErrs, field.InternalError(path, err))
+		}
+	}
+	return allErrs
+}
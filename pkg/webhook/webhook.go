@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+
+	snat "github.com/kubeovn/ces-controller/pkg/apis/bigip.io/v1alpha1"
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	informers "github.com/kubeovn/ces-controller/pkg/generated/informers/externalversions/kubeovn.io/v1alpha1"
+	listers "github.com/kubeovn/ces-controller/pkg/generated/listers/kubeovn.io/v1alpha1"
+)
+
+const (
+	// ValidatePath is where the ValidatingWebhookConfiguration sends the admission reviews
+	ValidatePath = "/validate"
+
+	// certFile and keyFile are the names of the serving certificate in the cert dir,
+	// as the keys of a kubernetes.io/tls secret
+	certFile = "tls.crt"
+	keyFile  = "tls.key"
+
+	shutdownTimeout = 5 * time.Second
+)
+
+// Server validates the CES resources at create and update, with the tenants and iRules of ces-conf.yaml
+type Server struct {
+	addr    string
+	certDir string
+
+	externalServicesLister listers.ExternalServiceLister
+	externalServicesSynced cache.InformerSynced
+}
+
+// NewServer returns a Server serving https on addr with the certificate in certDir
+func NewServer(addr, certDir string, externalServiceInformer informers.ExternalServiceInformer) *Server {
+	return &Server{
+		addr:                   addr,
+		certDir:                certDir,
+		externalServicesLister: externalServiceInformer.Lister(),
+		externalServicesSynced: externalServiceInformer.Informer().HasSynced,
+	}
+}
+
+// Run serves the admission reviews until stopCh is closed
+func (s *Server) Run(stopCh <-chan struct{}) error {
+	klog.Info("Waiting for webhook informer caches to sync")
+	if ok := cache.WaitForCacheSync(stopCh, s.externalServicesSynced); !ok {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(ValidatePath, s)
+	srv := &http.Server{Addr: s.addr, Handler: mux}
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	klog.Infof("Starting webhook server on %s", s.addr)
+	err := srv.ListenAndServeTLS(filepath.Join(s.certDir, certFile), filepath.Join(s.certDir, keyFile))
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return err
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	review := &admissionv1.AdmissionReview{}
+	if err = json.Unmarshal(body, review); err != nil || review.Request == nil {
+		http.Error(w, fmt.Sprintf("invalid admission review: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	review.Response = s.review(review.Request)
+	review.Response.UID = review.Request.UID
+	review.Request = nil
+	resp, err := json.Marshal(review)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp)
+}
+
+// review decodes the object of req and validates it
+func (s *Server) review(req *admissionv1.AdmissionRequest) *admissionv1.AdmissionResponse {
+	var obj metav1.Object
+	var validate func() field.ErrorList
+	switch req.Kind.Kind {
+	case "ExternalService":
+		exsvc := &kubeovn.ExternalService{}
+		obj, validate = exsvc, func() field.ErrorList { return validateExternalService(exsvc) }
+	case "ClusterEgressRule":
+		rule := &kubeovn.ClusterEgressRule{}
+		obj, validate = rule, func() field.ErrorList { return s.validateClusterEgressRule(rule) }
+	case "NamespaceEgressRule":
+		rule := &kubeovn.NamespaceEgressRule{}
+		obj, validate = rule, func() field.ErrorList { return s.validateNamespaceEgressRule(rule) }
+	case "ServiceEgressRule":
+		rule := &kubeovn.ServiceEgressRule{}
+		obj, validate = rule, func() field.ErrorList { return s.validateServiceEgressRule(rule) }
+	case "ExternalIPRule":
+		rule := &snat.ExternalIPRule{}
+		obj, validate = rule, func() field.ErrorList { return validateExternalIPRule(rule) }
+	default:
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	if err := json.Unmarshal(req.Object.Raw, obj); err != nil {
+		return denied(metav1.StatusReasonBadRequest, fmt.Sprintf("failed to decode %s: %v", req.Kind.Kind, err))
+	}
+	// the finalizers of a deleting resource must be removable whatever it references
+	if obj.GetDeletionTimestamp() != nil {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	// the metadata changes, eg: finalizers and labels by the controller, are not validated again
+	if req.Operation == admissionv1.Update && sameSpec(req.OldObject.Raw, req.Object.Raw) {
+		return &admissionv1.AdmissionResponse{Allowed: true}
+	}
+	if errs := validate(); len(errs) != 0 {
+		klog.Infof("denied %s %s[%s/%s]: %v", req.Operation, req.Kind.Kind, req.Namespace, req.Name, errs.ToAggregate())
+		return denied(metav1.StatusReasonInvalid, fmt.Sprintf("%s %s is invalid: %v", req.Kind.Kind, req.Name, errs.ToAggregate()))
+	}
+	return &admissionv1.AdmissionResponse{Allowed: true}
+}
+
+// sameSpec returns whether the objects of old and new have the same spec
+func sameSpec(old, new []byte) bool {
+	var oldObj, newObj struct {
+		Spec interface{} `json:"spec"`
+	}
+	if json.Unmarshal(old, &oldObj) != nil || json.Unmarshal(new, &newObj) != nil {
+		return false
+	}
+	return reflect.DeepEqual(oldObj.Spec, newObj.Spec)
+}
+
+func denied(reason metav1.StatusReason, message string) *admissionv1.AdmissionResponse {
+	return &admissionv1.AdmissionResponse{
+		Allowed: false,
+		Result: &metav1.Status{
+			Status:  metav1.StatusFailure,
+			Reason:  reason,
+			Message: message,
+		},
+	}
+}
@@ -0,0 +1,110 @@
+package webhook
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
+
+	kubeovn "github.com/kubeovn/ces-controller/pkg/apis/kubeovn.io/v1alpha1"
+	listers "github.com/kubeovn/ces-controller/pkg/generated/listers/kubeovn.io/v1alpha1"
+)
+
+func newTestServer(exsvcs ...*kubeovn.ExternalService) *Server {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, exsvc := range exsvcs {
+		indexer.Add(exsvc)
+	}
+	return &Server{externalServicesLister: listers.NewExternalServiceLister(indexer)}
+}
+
+func review(t *testing.T, s *Server, kind string, obj interface{}) *admissionv1.AdmissionResponse {
+	raw, err := json.Marshal(obj)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(&admissionv1.AdmissionReview{
+		Request: &admissionv1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Kind: kind},
+			Operation: admissionv1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("POST", ValidatePath, bytes.NewReader(body)))
+	resp := &admissionv1.AdmissionReview{}
+	if err = json.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatalf("invalid response %s: %v", w.Body.String(), err)
+	}
+	if resp.Response == nil || resp.Response.UID != "uid" {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+	return resp.Response
+}
+
+func TestValidateClusterEgressRule(t *testing.T) {
+	s := newTestServer(&kubeovn.ExternalService{ObjectMeta: metav1.ObjectMeta{Name: "saas", Namespace: "kube-system"}})
+	rule := &kubeovn.ClusterEgressRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "rule"},
+		Spec: kubeovn.ClusterEgressRuleSpec{
+			Action:           "accept",
+			ExternalServices: []string{"saas"},
+		},
+	}
+	if resp := review(t, s, "ClusterEgressRule", rule); !resp.Allowed {
+		t.Errorf("rule should be allowed, got %s", resp.Result.Message)
+	}
+
+	rule.Spec.Action = "allow"
+	rule.Spec.ExternalServices = []string{"saas", "missing"}
+	resp := review(t, s, "ClusterEgressRule", rule)
+	if resp.Allowed {
+		t.Fatalf("rule should be denied")
+	}
+	for _, msg := range []string{"spec.action", "spec.externalServices[1]", "kube-system/missing not found"} {
+		if !strings.Contains(resp.Result.Message, msg) {
+			t.Errorf("message should contain %q, got %s", msg, resp.Result.Message)
+		}
+	}
+
+	now := metav1.Now()
+	rule.DeletionTimestamp = &now
+	if resp := review(t, s, "ClusterEgressRule", rule); !resp.Allowed {
+		t.Errorf("deleting rule should be allowed, got %s", resp.Result.Message)
+	}
+}
+
+func TestValidateNamespaceEgressRule(t *testing.T) {
+	rule := &kubeovn.NamespaceEgressRule{
+		ObjectMeta: metav1.ObjectMeta{Name: "rule", Namespace: "unmapped"},
+		Spec:       kubeovn.NamespaceEgressRuleSpec{Action: "drop"},
+	}
+	resp := review(t, newTestServer(), "NamespaceEgressRule", rule)
+	if resp.Allowed || !strings.Contains(resp.Result.Message, "not mapped to any tenant") {
+		t.Errorf("rule in a namespace without tenant should be denied, got %v", resp.Result)
+	}
+}
+
+func TestValidateExternalService(t *testing.T) {
+	exsvc := &kubeovn.ExternalService{
+		ObjectMeta: metav1.ObjectMeta{Name: "saas", Namespace: "kube-system"},
+		Spec: kubeovn.ExternalServiceSpec{
+			Addresses: []string{"1.1.1.2"},
+			Ports:     []kubeovn.ExternalServicePort{{Name: "https", Protocol: "tcp", Port: "443", Bandwidth: "bwc_1mbps_irule"}},
+		},
+	}
+	resp := review(t, newTestServer(), "ExternalService", exsvc)
+	if resp.Allowed || !strings.Contains(resp.Result.Message, "spec.ports[0].bandwidth") {
+		t.Errorf("unknown bandwidth iRule should be denied, got %v", resp.Result)
+	}
+}